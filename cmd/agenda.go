@@ -0,0 +1,284 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"captain/logbook"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var (
+	dueStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("216"))
+	scheduledStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("117"))
+	todayStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("205")).Bold(true).Underline(true)
+	cursorStyle    = lipgloss.NewStyle().Reverse(true)
+)
+
+type agendaKind string
+
+const (
+	agendaDue       agendaKind = "due"
+	agendaScheduled agendaKind = "scheduled"
+	agendaDone      agendaKind = "done"
+)
+
+type agendaEntry struct {
+	Kind agendaKind
+	Do   Do
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+func sameDay(a *time.Time, day time.Time) bool {
+	if a == nil {
+		return false
+	}
+	return startOfDay(a.In(day.Location())).Equal(startOfDay(day))
+}
+
+// agendaFor lists what was due, scheduled or completed on a day. Completed
+// dos are only listed as done, not as due or scheduled.
+func agendaFor(dos []Do, day time.Time) []agendaEntry {
+	var entries []agendaEntry
+	for _, do := range dos {
+		switch {
+		case do.Completed && sameDay(do.CompletedAt, day):
+			entries = append(entries, agendaEntry{agendaDone, do})
+		case do.Completed:
+		case sameDay(do.DueAt, day):
+			entries = append(entries, agendaEntry{agendaDue, do})
+		case sameDay(do.ScheduledAt, day):
+			entries = append(entries, agendaEntry{agendaScheduled, do})
+		}
+	}
+	return entries
+}
+
+// overdue lists open dos that were due before day
+func overdue(dos []Do, day time.Time) []Do {
+	var late []Do
+	for _, do := range dos {
+		if !do.Completed && do.DueAt != nil && do.DueAt.Before(startOfDay(day)) {
+			late = append(late, do)
+		}
+	}
+	return late
+}
+
+func fmtAgendaEntry(entry agendaEntry, unhide bool) string {
+	description := entry.Do.Description
+	if entry.Do.Sensitive && !unhide {
+		description = strings.Repeat("⠿", len(entry.Do.Description))
+	}
+
+	var kind string
+	switch entry.Kind {
+	case agendaDue:
+		kind = dueStyle.Render(fmt.Sprintf("%-9s", entry.Kind))
+	case agendaScheduled:
+		kind = scheduledStyle.Render(fmt.Sprintf("%-9s", entry.Kind))
+	default:
+		kind = greenStyle.Render(fmt.Sprintf("%-9s", entry.Kind))
+	}
+
+	return fmt.Sprintf("  %s %s %-4d %s %s", fmtBox(entry.Do), kind, entry.Do.ID, fmtDo(entry.Do), description)
+}
+
+// renderAgenda prints each day between from and to (inclusive) with its
+// entries, highlighting today and listing anything overdue first.
+func renderAgenda(dos []Do, from, to, today time.Time, unhide bool) string {
+	var b strings.Builder
+
+	if day := startOfDay(today); !day.Before(startOfDay(from)) && !day.After(startOfDay(to)) {
+		if late := overdue(dos, today); len(late) > 0 {
+			b.WriteString(redStyle.Render("Overdue"))
+			b.WriteString("\n")
+			for _, do := range late {
+				b.WriteString(fmtAgendaEntry(agendaEntry{agendaDue, do}, unhide))
+				b.WriteString(normalStyle.Render(" " + fmtDay(do.DueAt)))
+				b.WriteString("\n")
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	for day := startOfDay(from); !day.After(to); day = day.AddDate(0, 0, 1) {
+		heading := day.Format("Mon 02-Jan-06")
+		if day.Equal(startOfDay(today)) {
+			b.WriteString(todayStyle.Render(heading + " (today)"))
+		} else {
+			b.WriteString(highlightStyle.Render(heading))
+		}
+		b.WriteString("\n")
+
+		entries := agendaFor(dos, day)
+		if len(entries) == 0 {
+			b.WriteString(normalStyle.Render("  -"))
+			b.WriteString("\n")
+		}
+		for _, entry := range entries {
+			b.WriteString(fmtAgendaEntry(entry, unhide))
+			b.WriteString("\n")
+		}
+	}
+
+	return b.String()
+}
+
+type monthGridModel struct {
+	dos    []Do
+	cursor time.Time
+	today  time.Time
+	unhide bool
+}
+
+func newMonthGridModel(dos []Do, today time.Time, unhide bool) monthGridModel {
+	return monthGridModel{dos: dos, cursor: startOfDay(today), today: startOfDay(today), unhide: unhide}
+}
+
+func (m monthGridModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m monthGridModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "left", "h":
+			m.cursor = m.cursor.AddDate(0, 0, -1)
+		case "right", "l":
+			m.cursor = m.cursor.AddDate(0, 0, 1)
+		case "up", "k":
+			m.cursor = m.cursor.AddDate(0, 0, -7)
+		case "down", "j":
+			m.cursor = m.cursor.AddDate(0, 0, 7)
+		case "p", "pgup":
+			m.cursor = m.cursor.AddDate(0, -1, 0)
+		case "n", "pgdown":
+			m.cursor = m.cursor.AddDate(0, 1, 0)
+		case "t":
+			m.cursor = m.today
+		case "q", "esc", "ctrl+c", "enter":
+			return m, tea.Quit
+		}
+	}
+	return m, nil
+}
+
+func (m monthGridModel) View() string {
+	var b strings.Builder
+
+	first := time.Date(m.cursor.Year(), m.cursor.Month(), 1, 0, 0, 0, 0, m.cursor.Location())
+	b.WriteString(highlightStyle.Render(first.Format("January 2006")))
+	b.WriteString("\n\n")
+	b.WriteString(normalStyle.Render(" Mo  Tu  We  Th  Fr  Sa  Su"))
+	b.WriteString("\n")
+
+	for day := startOfWeek(first); day.Month() == first.Month() || day.Before(first); day = day.AddDate(0, 0, 7) {
+		for i := 0; i < 7; i++ {
+			date := day.AddDate(0, 0, i)
+			if date.Month() != first.Month() {
+				b.WriteString("    ")
+				continue
+			}
+
+			cell := fmt.Sprintf("%3d", date.Day())
+			// Due takes precedence over scheduled, which takes precedence over done
+			rank := 0
+			for _, entry := range agendaFor(m.dos, date) {
+				switch {
+				case entry.Kind == agendaDue:
+					rank = 3
+				case entry.Kind == agendaScheduled && rank < 2:
+					rank = 2
+				case entry.Kind == agendaDone && rank < 1:
+					rank = 1
+				}
+			}
+			style := []lipgloss.Style{normalStyle, greenStyle, scheduledStyle, dueStyle}[rank]
+			if date.Equal(m.today) {
+				style = todayStyle
+			}
+			if date.Equal(m.cursor) {
+				style = style.Inherit(cursorStyle)
+			}
+			b.WriteString(style.Render(cell))
+			b.WriteString(" ")
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	b.WriteString(renderAgenda(m.dos, m.cursor, m.cursor, m.today, m.unhide))
+	b.WriteString("\n")
+	b.WriteString(normalStyle.Render("←/→ days • ↑/↓ weeks • n/p months • t today • q to quit"))
+
+	return b.String()
+}
+
+var agendaCmd = &cobra.Command{
+	Use:   "agenda --week --month --grid --unhide",
+	Short: "Show what is due, scheduled and done day by day",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		month, _ := cmd.Flags().GetBool("month")
+		grid, _ := cmd.Flags().GetBool("grid")
+		unhide, _ := cmd.Flags().GetBool("unhide")
+
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+
+		all, err := svc.Query(logbook.Query{Sort: logbook.SortCreated, Asc: true})
+		if err != nil {
+			return err
+		}
+
+		// Only dos with a date have a day to be shown on
+		var dos []Do
+		for _, do := range all {
+			if do.DueAt != nil || do.ScheduledAt != nil || do.CompletedAt != nil {
+				dos = append(dos, do)
+			}
+		}
+
+		today := time.Now()
+
+		if grid {
+			p := tea.NewProgram(newMonthGridModel(dos, today, unhide))
+			if _, err := p.Run(); err != nil {
+				return fmt.Errorf("could not run program: %w", err)
+			}
+			return nil
+		}
+
+		// The current week, Monday to Sunday, unless it's the month
+		from := startOfWeek(today)
+		to := from.AddDate(0, 0, 6)
+		if month {
+			from = time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, today.Location())
+			to = from.AddDate(0, 1, -1)
+		}
+
+		fmt.Fprint(cmd.OutOrStdout(), renderAgenda(dos, from, to, today, unhide))
+		return nil
+	},
+}
+
+func init() {
+	agendaCmd.Flags().Bool("week", false, "Show the current week, as when neither --week nor --month is given")
+	agendaCmd.Flags().Bool("month", false, "Show the current month")
+	agendaCmd.Flags().Bool("grid", false, "Browse an interactive month grid")
+	agendaCmd.Flags().BoolP("unhide", "u", false, "unhide sensitive tasks")
+	agendaCmd.MarkFlagsMutuallyExclusive("week", "month")
+
+	RootCmd.AddCommand(agendaCmd)
+}
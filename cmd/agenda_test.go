@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"captain/logbook"
+)
+
+func TestMapDate(t *testing.T) {
+	today := startOfDay(time.Now())
+
+	tests := []struct {
+		input     string
+		expected  *time.Time
+		expectErr bool
+	}{
+		{"", nil, false},
+		{"none", nil, false},
+		{"today", &today, false},
+		{"+3d", func() *time.Time { d := today.AddDate(0, 0, 3); return &d }(), false},
+		{"2025-03-14", func() *time.Time { d := time.Date(2025, 3, 14, 0, 0, 0, 0, time.Local); return &d }(), false},
+		{"next week", nil, true},
+		{"+xd", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := mapDate(tt.input)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("mapDate(%s) error = %v, expected error: %v", tt.input, err, tt.expectErr)
+			}
+			if (result == nil) != (tt.expected == nil) {
+				t.Fatalf("mapDate(%s) = %v, expected %v", tt.input, result, tt.expected)
+			}
+			if result != nil && !result.Equal(*tt.expected) {
+				t.Errorf("mapDate(%s) = %v, expected %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAgendaFor(t *testing.T) {
+	day := time.Date(2025, 3, 12, 0, 0, 0, 0, time.Local)
+	at := func(hours int) *time.Time {
+		t := day.Add(time.Duration(hours) * time.Hour)
+		return &t
+	}
+
+	dos := []Do{
+		{ID: 1, DueAt: at(0)},
+		{ID: 2, ScheduledAt: at(0)},
+		{ID: 3, Completed: true, CompletedAt: at(15), DueAt: at(0)},
+		{ID: 4, Completed: true, CompletedAt: at(-15), DueAt: at(0)}, // done the day before
+		{ID: 5, DueAt: at(24)},
+	}
+
+	entries := agendaFor(dos, day)
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %+v", entries)
+	}
+
+	expected := []struct {
+		id   uint
+		kind agendaKind
+	}{{1, agendaDue}, {2, agendaScheduled}, {3, agendaDone}}
+	for i, e := range expected {
+		if entries[i].Do.ID != e.id || entries[i].Kind != e.kind {
+			t.Errorf("Expected do %d as %s, got do %d as %s", e.id, e.kind, entries[i].Do.ID, entries[i].Kind)
+		}
+	}
+}
+
+func TestRenderAgenda(t *testing.T) {
+	today := time.Date(2025, 3, 12, 9, 0, 0, 0, time.Local)
+	late := today.AddDate(0, 0, -5)
+	due := today.AddDate(0, 0, 1)
+
+	dos := []Do{
+		{ID: 1, Description: "Past it", Type: Task, DueAt: &late},
+		{ID: 2, Description: "Tomorrow's", Type: Task, DueAt: &due},
+	}
+
+	out := stripANSI(renderAgenda(dos, startOfWeek(today), startOfWeek(today).AddDate(0, 0, 6), today, false))
+
+	if !strings.Contains(out, "Overdue") || !strings.Contains(out, "Past it") {
+		t.Error("Expected overdue dos to be listed")
+	}
+	if !strings.Contains(out, "Wed 12-Mar-25 (today)") {
+		t.Error("Expected today to be marked")
+	}
+	if strings.Count(out, "\n") < 7 {
+		t.Error("Expected a line per day of the week")
+	}
+	if !strings.Contains(out, "Tomorrow's") {
+		t.Error("Expected tomorrow's due do to be listed")
+	}
+}
+
+func TestAgendaCommandViews(t *testing.T) {
+	store := logbook.NewMemStore()
+	today := time.Now().Format("Mon 02-Jan-06") + " (today)"
+	monthEnd := time.Date(time.Now().Year(), time.Now().Month()+1, 0, 0, 0, 0, 0, time.Local)
+
+	for _, args := range [][]string{{"agenda"}, {"agenda", "--week"}, {"agenda", "--week=false"}} {
+		out, err := runCaptain(t, store, args...)
+		if err != nil || !strings.Contains(out, today) || strings.Count(out, "-") < 7 {
+			t.Errorf("Expected %v to show the week, got %v:\n%s", args, err, out)
+		}
+	}
+
+	out, err := runCaptain(t, store, "agenda", "--month")
+	if err != nil || !strings.Contains(out, monthEnd.Format("Mon 02-Jan-06")) {
+		t.Errorf("Expected the month, got %v:\n%s", err, out)
+	}
+
+	if _, err := runCaptain(t, store, "agenda", "--week", "--month"); ExitCode(err) != exitInvalid {
+		t.Errorf("Expected --week and --month together to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"captain/logbook"
+
+	"github.com/spf13/cobra"
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup [file]",
+	Short: "Back up the logbook",
+	Long: `Back up the logbook while it's in use. Without a file the backup goes in
+the backups directory and kept until you remove it. Only the routine backups
+taken every backup_interval are pruned to the newest backup_keep.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+
+		conn, err := logbook.Open(dbPath(&cfg))
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 1 {
+			if _, err := os.Stat(args[0]); err == nil {
+				return existsf("%s already exists", args[0])
+			}
+			if err := logbook.Backup(conn, args[0]); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Backed up to %s\n", args[0])
+			return nil
+		}
+
+		path := logbook.BackupPath(dbPath(&cfg), "manual", time.Now())
+		if err := logbook.Backup(conn, path); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Backed up to %s\n", path)
+
+		pruned, err := logbook.Prune(dbPath(&cfg), cfg.BackupKeep)
+		for _, old := range pruned {
+			fmt.Fprintf(out, "Removed %s\n", filepath.Base(old.Path))
+		}
+		return err
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <file>",
+	Short: "Replace the logbook with a backup",
+	Long: `Replace the logbook with a backup, once it passes an integrity check. The
+logbook is backed up first, so a restore can be undone.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+		from := args[0]
+
+		if err := logbook.Check(from); err != nil {
+			return err
+		}
+
+		if yes, _ := cmd.Flags().GetBool("yes"); !yes {
+			fmt.Fprintf(out, "Replace %s with %s? (y/n): ", dbPath(&cfg), from)
+			var response string
+			fmt.Fscanln(cmd.InOrStdin(), &response)
+			response = strings.ToLower(strings.TrimSpace(response))
+			if response != "y" && response != "yes" {
+				return declined("restore")
+			}
+		}
+
+		if _, err := os.Stat(dbPath(&cfg)); err == nil {
+			conn, err := logbook.Connect(dbPath(&cfg))
+			if err != nil {
+				return err
+			}
+			path := logbook.BackupPath(dbPath(&cfg), "pre-restore", time.Now())
+			err = logbook.Backup(conn, path)
+			if db, dbErr := conn.DB(); dbErr == nil {
+				db.Close()
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Backed up the logbook to %s\n", path)
+		}
+
+		if err := logbook.Restore(dbPath(&cfg), from); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Restored %s\n", from)
+		return nil
+	},
+}
+
+func init() {
+	restoreCmd.Flags().BoolP("yes", "y", false, "Restore without asking")
+	RootCmd.AddCommand(backupCmd, restoreCmd)
+}
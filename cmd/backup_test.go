@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"captain/logbook"
+)
+
+func TestBackupAndRestoreCommands(t *testing.T) {
+	out, err := runCaptain(t, nil, "backup")
+	if err != nil || !strings.Contains(out, "Backed up to") {
+		t.Fatalf("Expected a backup, got %q, %v", out, err)
+	}
+
+	// backup_keep only prunes routine backups, not those taken by hand
+	if _, err := runCaptain(t, nil, "config", "backup_keep", "1"); err != nil {
+		t.Fatalf("config: %v", err)
+	}
+	out, err = runCaptain(t, nil, "backup")
+	if err != nil || strings.Contains(out, "Removed") {
+		t.Errorf("Expected the older backup kept, got %q, %v", out, err)
+	}
+	if backups, _ := logbook.Backups(dbPath(&cfg)); len(backups) != 2 {
+		t.Errorf("Expected both backups kept, got %v", backups)
+	}
+
+	saved := filepath.Join(t.TempDir(), "saved.db")
+	if _, err := runCaptain(t, nil, "backup", saved); err != nil {
+		t.Fatalf("backup to a file: %v", err)
+	}
+	if _, err := runCaptain(t, nil, "backup", saved); !errors.Is(err, logbook.ErrExists) {
+		t.Errorf("Expected ErrExists backing up over a file, got %v", err)
+	}
+
+	out, err = runCaptain(t, nil, "restore", "--yes", saved)
+	if err != nil || !strings.Contains(out, "Backed up the logbook") || !strings.Contains(out, "Restored") {
+		t.Errorf("Expected the logbook backed up then restored, got %q, %v", out, err)
+	}
+	if _, err := runCaptain(t, nil, "restore", "--yes", filepath.Join(t.TempDir(), "gone.db")); !errors.Is(err, logbook.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound restoring a missing file, got %v", err)
+	}
+}
+
+func TestRoutineBackup(t *testing.T) {
+	c := Config{CaptainDir: t.TempDir(), DBFile: "captain.db", BackupKeep: 2, BackupInterval: 24 * time.Hour}
+	conn, err := logbook.Open(dbPath(&c))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	start := time.Now()
+	for _, at := range []time.Time{start, start.Add(time.Hour), start.Add(25 * time.Hour), start.Add(50 * time.Hour)} {
+		if err := routineBackup(conn, &c, at); err != nil {
+			t.Fatalf("routineBackup: %v", err)
+		}
+	}
+	backups, _ := logbook.Backups(dbPath(&c))
+	if len(backups) != 2 || !backups[0].TakenAt.Equal(start.Add(50*time.Hour).Truncate(time.Microsecond)) {
+		t.Errorf("Expected the 2 newest daily backups, got %v", backups)
+	}
+}
@@ -2,13 +2,16 @@ package cmd
 
 import (
 	"fmt"
-	"log"
+	"io"
 	"net/url"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 
+	"captain/logbook"
+
 	"github.com/charmbracelet/glamour"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/fatih/color"
@@ -24,94 +27,107 @@ var (
 var RootCmd = &cobra.Command{
 	Use:   "cap",
 	Short: "Task manager CLI",
+	// Usage is for mistakes in the arguments, not for a command that failed
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Cobra checks flags that can't be used together only after this,
+		// when they'd look like the command failed
+		if err := cmd.ValidateFlagGroups(); err != nil {
+			return err
+		}
+		cmd.SilenceUsage = true
+		hookOutput = cmd.ErrOrStderr()
+		return loadConfig(cmd, args)
+	},
+}
+
+// cfg is the config for this run, loaded before the command runs
+var cfg Config
+
+// loadConfig loads cfg from the config file and profile picked with
+// --config and --profile
+func loadConfig(cmd *cobra.Command, args []string) error {
+	var loaded Config
+	var err error
+	if cmd.DisableFlagParsing {
+		// Plugins are given their arguments unparsed
+		loaded, err = earlyConfig(args)
+	} else {
+		path, _ := cmd.Flags().GetString("config")
+		profile, _ := cmd.Flags().GetString("profile")
+		loaded, err = LoadConfig(path, profile)
+	}
+	if err != nil {
+		return err
+	}
+	cfg = loaded
+	return nil
 }
 
-var cfg = LoadConfig()
+// confirm asks before a change is made, tests answer it themselves
+var confirm = Confirmation
 
 var doCmd = &cobra.Command{
 	Use:   "do <message>",
 	Short: "Add a new do",
 	Args:  cobra.MinimumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+
 		message := args[0]
 
 		forTag, _ := cmd.Flags().GetString("for")
 		doType, _ := cmd.Flags().GetString("type")
 		prio, _ := cmd.Flags().GetString("prio")
 		templateName, _ := cmd.Flags().GetString("template")
-		conn := OpenConn(&cfg)
-
-		var tag Tag
-		if forTag != "" {
-			result := conn.Where("name = ?", forTag).First(&tag)
-			if result.Error != nil {
-				fmt.Printf("No tag called '%v'\n", forTag)
-				return
-			}
-		}
-
-		// Process template if provided
-		var templateOutput string
-		if templateName != "" {
-			var template Template
-			result := conn.Where("name = ? AND deleted = ?", templateName, false).First(&template)
-			if result.Error != nil {
-				fmt.Printf("No template named '%s'\n", templateName)
-				return
-			}
+		est, _ := cmd.Flags().GetString("est")
+		due, _ := cmd.Flags().GetString("due")
 
-			arguments, err := src.ParseTemplate(template.Content)
-			if err != nil {
-				fmt.Printf("Error parsing template: %v\n", err)
-				return
-			}
-
-			inputs := make(map[string]string)
-			for _, arg := range arguments {
-				inputs[arg.Name] = src.GetUserInput(arg)
-			}
-
-			templateOutput = src.FillTemplate(template.Content, arguments, inputs)
+		estimate, err := mapEstimate(est)
+		if err != nil {
+			return err
 		}
 
-		// Query for existing do, case insensitive
-		var existing Do
-		result := conn.Where("LOWER(description) = ?", strings.ToLower(message)).First(&existing)
-		if result.Error == nil {
-			fmt.Printf("Do already exists: %d\n", existing.ID)
-			return
+		dueAt, err := mapDate(due)
+		if err != nil {
+			return err
 		}
 
-		do := Do{
-			Description: message,
-			Type:        mapType(doType),
-			Priority:    mapPriority(prio),
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
 		}
 
-		if err := conn.Create(&do).Error; err != nil {
-			log.Fatalf("could not insert new row: %v", err)
+		// Process template if provided
+		var templateOutput string
+		if templateName != "" {
+			templateOutput, err = svc.ApplyTemplate(templateName, src.GetUserInput)
+			if err != nil {
+				return err
+			}
 		}
 
-		if forTag != "" {
-			doTag := DoTag{DoID: do.ID, TagID: tag.ID}
-			if err := conn.Create(&doTag).Error; err != nil {
-				log.Fatalf("could not insert new row: %v", err)
-			}
+		do, err := svc.AddDo(logbook.NewDo{
+			Do: Do{
+				Description: message,
+				Type:        mapType(doType),
+				Priority:    mapPriority(prio),
+				Estimate:    estimate,
+				DueAt:       dueAt,
+			},
+			For:    forTag,
+			Doc:    templateOutput,
+			Unique: true,
+		})
+		if err != nil {
+			return err
 		}
 
-		// If template was used, create DoDoc with filled output
 		if templateOutput != "" {
-			doc := DoDoc{
-				DoID: do.ID,
-				Text: templateOutput,
-			}
-			if err := conn.Create(&doc).Error; err != nil {
-				log.Fatalf("could not create doc: %v", err)
-			}
-			fmt.Printf("Added do: (id=%d)\nDocumentation saved for task %d\n", do.ID, do.ID)
+			fmt.Fprintf(out, "Added do: (id=%d)\nDocumentation saved for task %d\n", do.ID, do.ID)
 		} else {
-			fmt.Printf("Added do: (id=%d)\n", do.ID)
+			fmt.Fprintf(out, "Added do: (id=%d)\n", do.ID)
 		}
+		return nil
 	},
 }
 
@@ -119,28 +135,36 @@ var didCmd = &cobra.Command{
 	Use:   "did <do_id>",
 	Short: "Complete a do by ID",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		id := args[0]
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
 
-		conn := OpenConn(&cfg)
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
+		}
 
-		var fetched Do
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
 
-		result := conn.Where("deleted = ?", false).First(&fetched, id)
-		if result.Error != nil {
-			fmt.Printf("No task under %v\n", id)
-			return
+		fetched, err := svc.Get(id)
+		if err != nil {
+			return err
 		}
 
-		if Confirmation(fetched, "Complete this task?", greenStyle) {
-			fetched.Completed = true
-			now := time.Now()
-			fetched.CompletedAt = &now
-			conn.Save(&fetched)
-			fmt.Printf("Marked %d as done\n", fetched.ID)
-		} else {
-			fmt.Println("Task completion cancelled")
+		ok, err := confirm(fetched, "Complete this task?", greenStyle)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if _, err := svc.Complete(id); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Marked %d as done\n", fetched.ID)
+			return nil
 		}
+		return declined("task completion")
 	},
 }
 
@@ -177,44 +201,136 @@ func mapType(s string) DoType {
 	return Task
 }
 
+// tShirtSizes maps the sizes accepted by mapEstimate to minutes. A day is
+// 24 hours, as fmtMinutes shows it and as the elapsed time an estimate is
+// compared with is counted.
+var tShirtSizes = map[string]int{
+	"xs": 30,
+	"s":  60,
+	"m":  4 * 60,
+	"l":  8 * 60,
+	"xl": 3 * 24 * 60,
+}
+
+// mapEstimate parses an estimate into minutes. It accepts plain minutes
+// ("90"), durations ("1h30m") or t-shirt sizes (xs/s/m/l/xl). An empty
+// string means no estimate.
+func mapEstimate(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" || s == "none" {
+		return 0, nil
+	}
+
+	if minutes, ok := tShirtSizes[s]; ok {
+		return minutes, nil
+	}
+
+	if minutes, err := strconv.Atoi(s); err == nil && minutes >= 0 {
+		return minutes, nil
+	}
+
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return int(d.Minutes()), nil
+	}
+
+	return 0, invalidf("unknown estimate '%s' (use minutes, a duration like 1h30m, or xs/s/m/l/xl)", s)
+}
+
+// mapDate parses a day as YYYY-MM-DD, today, tomorrow or +<n>d. An empty
+// string or "none" clears the date.
+func mapDate(s string) (*time.Time, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" || s == "none" {
+		return nil, nil
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	var date time.Time
+	switch {
+	case s == "today":
+		date = today
+	case s == "tomorrow":
+		date = today.AddDate(0, 0, 1)
+	case strings.HasPrefix(s, "+") && strings.HasSuffix(s, "d"):
+		days, err := strconv.Atoi(s[1 : len(s)-1])
+		if err != nil {
+			return nil, invalidf("unknown date '%s' (use YYYY-MM-DD, today, tomorrow or +<n>d)", s)
+		}
+		date = today.AddDate(0, 0, days)
+	default:
+		parsed, err := time.ParseInLocation("2006-01-02", s, time.Local)
+		if err != nil {
+			return nil, invalidf("unknown date '%s' (use YYYY-MM-DD, today, tomorrow or +<n>d)", s)
+		}
+		date = parsed
+	}
+	return &date, nil
+}
+
 var setPrioCmd = &cobra.Command{
 	Use:   "set <field> <value> <do_id>",
-	Short: "Changes something of a do, right now; priority & type",
+	Short: "Changes something of a do, right now; priority, type, estimate, due & scheduled",
 	Args:  cobra.ExactArgs(3),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+
 		field := args[0]
-		if field != "prio" && field != "type" {
-			fmt.Printf("The field '%s' is not supported.", field)
-			return
+		switch field {
+		case "prio", "type", "estimate", "due", "scheduled":
+		default:
+			return invalidf("the field '%s' is not supported", field)
 		}
 
 		value := args[1]
-		id := args[2]
-
-		conn := OpenConn(&cfg)
-
-		var do Do
-
-		result := conn.Where("deleted = ?", false).First(&do, id)
-		if result.Error != nil {
-			fmt.Printf("No do with ID '%v'\n", id)
-			return
+		id, err := parseID(args[2])
+		if err != nil {
+			return err
 		}
 
 		var oldField string
 
-		switch field {
-		case "prio":
-			oldField = string(do.Priority)
-			do.Priority = mapPriority(value)
-		case "type":
-			oldField = string(do.Type)
-			do.Type = mapType(value)
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+		_, err = svc.Update(id, func(do *Do) error {
+			switch field {
+			case "prio":
+				oldField = string(do.Priority)
+				do.Priority = mapPriority(value)
+			case "type":
+				oldField = string(do.Type)
+				do.Type = mapType(value)
+			case "estimate":
+				estimate, err := mapEstimate(value)
+				if err != nil {
+					return err
+				}
+				oldField = fmtMinutes(do.Estimate)
+				do.Estimate = estimate
+			case "due", "scheduled":
+				date, err := mapDate(value)
+				if err != nil {
+					return err
+				}
+				if field == "due" {
+					oldField = fmtDay(do.DueAt)
+					do.DueAt = date
+				} else {
+					oldField = fmtDay(do.ScheduledAt)
+					do.ScheduledAt = date
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
 		}
 
-		conn.Save(&do)
-
-		fmt.Printf("Do %v updated '%v' -> '%v'\n", id, oldField, value)
+		fmt.Fprintf(out, "Do %v updated '%v' -> '%v'\n", id, oldField, value)
+		return nil
 	},
 }
 
@@ -223,31 +339,35 @@ var editCmd = &cobra.Command{
 	Use:   "edit <do_id>",
 	Short: "Edit a task by ID",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		id := args[0]
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
 
-		conn := OpenConn(&cfg)
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
+		}
 
-		var do Do
-		result := conn.Where("deleted = ?", false).First(&do, id)
-		if result.Error != nil {
-			fmt.Printf("No do under id '%v'\n", id)
-			return
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+
+		do, err := svc.Get(id)
+		if err != nil {
+			return err
 		}
 
 		// Start a temporary file
 		tmpfile, err := os.CreateTemp("", fmt.Sprintf("do-edit-ID%d-*.md", do.ID))
 		if err != nil {
-			fmt.Printf("Error creating temporary file: %v\n", err)
-			return
+			return fmt.Errorf("could not create temporary file: %w", err)
 		}
 		defer os.Remove(tmpfile.Name())
 
 		// Write the do description to the temporary file
 		_, err = tmpfile.WriteString(do.Description)
 		if err != nil {
-			fmt.Printf("Error writing to temporary file: %v\n", err)
-			return
+			return fmt.Errorf("could not write to temporary file: %w", err)
 		}
 
 		// Open vim to edit the do description
@@ -261,22 +381,25 @@ var editCmd = &cobra.Command{
 		editorCmd.Stderr = os.Stderr
 		err = editorCmd.Run()
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
 		// Read the edited content
 		content, err := os.ReadFile(tmpfile.Name())
 		if err != nil {
-			fmt.Printf("Error reading edited content: %v\n", err)
-			return
+			return fmt.Errorf("could not read edited content: %w", err)
 		}
 
-		// Remove trailing whitespace and newlines
-		do.Description = strings.TrimSpace(string(content))
-
-		// Update the do description
-		conn.Save(&do)
-		fmt.Printf("Edited do %d\n", do.ID)
+		// Update the do description, without trailing whitespace and newlines
+		_, err = svc.Update(do.ID, func(do *Do) error {
+			do.Description = strings.TrimSpace(string(content))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Edited do %d\n", do.ID)
+		return nil
 	},
 }
 
@@ -284,35 +407,44 @@ var scratchCmd = &cobra.Command{
 	Use:   "scratch <do_id> [reason]",
 	Short: "Soft delete a do",
 	Args:  cobra.RangeArgs(1, 2),
-	Run: func(cmd *cobra.Command, args []string) {
-		id := args[0]
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
+		}
 		var reason string
 		if len(args) > 1 {
 			reason = args[1]
 		}
 
-		conn := OpenConn(&cfg)
-
-		var do Do
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
 
-		result := conn.Where("deleted = ?", false).First(&do, id)
-		if result.Error != nil {
-			fmt.Printf("No do under id '%v'\n", id)
-			return
+		do, err := svc.Get(id)
+		if err != nil {
+			return err
 		}
 
-		if Confirmation(do, "Delete this task?", redStyle) {
-			do.Deleted = true
-			do.Reason = reason
-			conn.Save(&do)
+		ok, err := confirm(do, "Delete this task?", redStyle)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if _, err := svc.Scratch(id, reason); err != nil {
+				return err
+			}
 			if reason != "" {
-				fmt.Printf("Deleted do %d (reason: %s)\n", do.ID, reason)
+				fmt.Fprintf(out, "Deleted do %d (reason: %s)\n", do.ID, reason)
 			} else {
-				fmt.Printf("Deleted do %d\n", do.ID)
+				fmt.Fprintf(out, "Deleted do %d\n", do.ID)
 			}
-		} else {
-			fmt.Println("Task deletion cancelled")
+			return nil
 		}
+		return declined("task deletion")
 	},
 }
 
@@ -320,27 +452,36 @@ var unscratchCmd = &cobra.Command{
 	Use:   "unscratch <do_id>",
 	Short: "Revert the soft deleted do",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		id := args[0]
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
 
-		conn := OpenConn(&cfg)
-
-		var do Do
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
+		}
 
-		result := conn.First(&do, id)
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
 
-		if result.Error != nil {
-			fmt.Printf("No do under id '%v'\n", id)
-			return
+		do, err := svc.Find(id)
+		if err != nil {
+			return err
 		}
 
-		if Confirmation(do, "Resurrect this task?", redStyle) {
-			do.Deleted = false
-			conn.Save(&do)
-			fmt.Printf("Resurrected %d\n", do.ID)
-		} else {
-			fmt.Println("Task resurrection cancelled")
+		ok, err := confirm(do, "Resurrect this task?", redStyle)
+		if err != nil {
+			return err
 		}
+		if ok {
+			if _, err := svc.Unscratch(id); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Resurrected %d\n", do.ID)
+			return nil
+		}
+		return declined("task resurrection")
 	},
 }
 
@@ -348,21 +489,27 @@ var pinCmd = &cobra.Command{
 	Use:   "pin <do_id>",
 	Short: "Pin a do",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		id := args[0]
-		conn := OpenConn(&cfg)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
 
-		var do Do
-
-		result := conn.Where("deleted = ?", false).First(&do, id)
-		if result.Error != nil {
-			fmt.Printf("No do under id '%v'\n", id)
-			return
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
 		}
 
-		do.Pinned = true
-		conn.Save(&do)
-		fmt.Printf("Pinned do %d\n", do.ID)
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+		do, err := svc.Update(id, func(do *Do) error {
+			do.Pinned = true
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Pinned do %d\n", do.ID)
+		return nil
 	},
 }
 
@@ -370,21 +517,27 @@ var unpinCmd = &cobra.Command{
 	Use:   "unpin <do_id>",
 	Short: "Unpin a do",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		id := args[0]
-		conn := OpenConn(&cfg)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
 
-		var do Do
-
-		result := conn.Where("deleted = ?", false).First(&do, id)
-		if result.Error != nil {
-			fmt.Printf("No do under id '%v'\n", id)
-			return
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
 		}
 
-		do.Pinned = false
-		conn.Save(&do)
-		fmt.Printf("Unpinned do %d\n", do.ID)
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+		do, err := svc.Update(id, func(do *Do) error {
+			do.Pinned = false
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Unpinned do %d\n", do.ID)
+		return nil
 	},
 }
 
@@ -392,25 +545,31 @@ var markCmd = &cobra.Command{
 	Use:   "mark <do_id> <field>",
 	Short: "Mark a do as sensitive",
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
-		id := args[0]
-		field := args[1]
-
-		conn := OpenConn(&cfg)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
 
-		var do Do
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
+		}
+		field := args[1]
 
-		result := conn.Where("deleted = ?", false).First(&do, id)
-		if result.Error != nil {
-			fmt.Printf("No do under id '%v'\n", id)
-			return
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
 		}
-		switch field {
-		case "sensitive":
-			do.Sensitive = true
+		do, err := svc.Update(id, func(do *Do) error {
+			switch field {
+			case "sensitive":
+				do.Sensitive = true
+			}
+			return nil
+		})
+		if err != nil {
+			return err
 		}
-		conn.Save(&do)
-		fmt.Printf("Marked %d as %s\n", do.ID, field)
+		fmt.Fprintf(out, "Marked %d as %s\n", do.ID, field)
+		return nil
 	},
 }
 
@@ -418,26 +577,31 @@ var unmarkCmd = &cobra.Command{
 	Use:   "unmark <do_id> <field>",
 	Short: "Unmark a do as sensitive",
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
-		id := args[0]
-		field := args[1]
-
-		conn := OpenConn(&cfg)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
 
-		var do Do
-
-		result := conn.Where("deleted = ?", false).First(&do, id)
-		if result.Error != nil {
-			fmt.Printf("No do under id '%v'\n", id)
-			return
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
 		}
+		field := args[1]
 
-		switch field {
-		case "sensitive":
-			do.Sensitive = false
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+		do, err := svc.Update(id, func(do *Do) error {
+			switch field {
+			case "sensitive":
+				do.Sensitive = false
+			}
+			return nil
+		})
+		if err != nil {
+			return err
 		}
-		conn.Save(&do)
-		fmt.Printf("Unmarked %d as %s\n", do.ID, field)
+		fmt.Fprintf(out, "Unmarked %d as %s\n", do.ID, field)
+		return nil
 	},
 }
 
@@ -449,131 +613,90 @@ func SprintfFunc(format string) func(string) string {
 	}
 }
 
-func DoOrder(sortby string, orderby string) string {
-	// DESC / ASC
-	var so string
-
+// logSort maps the --sort and --order of the log to a logbook sort
+func logSort(w io.Writer, sortby string, orderby string) (string, bool) {
 	switch orderby {
-	case "asc":
-		so = "%s " + "ASC"
+	case "asc", "desc":
 	default:
-		if orderby != "desc" {
-			fmt.Printf("No such order: '%s'!\n", orderby)
-		}
-		so = "%s " + "DESC"
+		fmt.Fprintf(w, "No such order: '%s'!\n", orderby)
 	}
 
-	sortOrder := SprintfFunc(so)
-
 	switch sortby {
-	case "created_at":
-		return sortOrder("created_at")
-	case "completed_at":
-		return sortOrder("completed_at")
-	case "description":
-		return sortOrder("description")
-	case "type":
-		return sortOrder("type")
-	case "priority":
-		return sortOrder(`
-			CASE priority
-				WHEN 'high' THEN 1
-				WHEN 'medium' THEN 2
-				WHEN 'low' THEN 3
-				ELSE 2
-			END
-		`)
+	case logbook.SortCreated, logbook.SortCompleted, logbook.SortDescription, logbook.SortType, logbook.SortPriority:
+		return sortby, orderby == "asc"
+	case "default":
 	default:
-		if sortby != "default" {
-			fmt.Printf("No such sort: '%s'!\n", orderby)
-		}
-		return `
-			completed,
-			completed_at DESC,
-			CASE priority
-				WHEN 'high' THEN 1
-				WHEN 'medium' THEN 2
-				WHEN 'low' THEN 3
-				ELSE 2
-			END, created_at DESC
-		`
+		fmt.Fprintf(w, "No such sort: '%s'!\n", sortby)
 	}
+	return logbook.SortDefault, false
+}
+
+func DoOrder(sortby string, orderby string) string {
+	return logbook.OrderBy(logSort(os.Stderr, sortby, orderby))
 }
 
 var logCmd = &cobra.Command{
 	Use:   "log --include-done --sort=created_at --unhide --for=<tag.name> --type=<type>",
 	Short: "Log tasks",
-	Run: func(cmd *cobra.Command, args []string) {
-		conn := OpenConn(&cfg)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+
 		n, _ := cmd.Flags().GetInt("n")
+		if !cmd.Flags().Changed("n") {
+			n = cfg.LogLength
+		}
 		sort, _ := cmd.Flags().GetString("sort")
 		order, _ := cmd.Flags().GetString("order")
 		unhide, _ := cmd.Flags().GetBool("unhide")
 		forTag, _ := cmd.Flags().GetString("for")
 		doType, _ := cmd.Flags().GetString("type")
 
-		query := conn.Not("deleted = ?", true).Not("promoted = ?", true)
-
-		// Apply tag filter if specified
-		if forTag != "" {
-			query = query.
-				Joins("LEFT JOIN do_tags ON do_tags.do_id = dos.id").
-				Joins("LEFT JOIN tags ON tags.id = do_tags.tag_id").
-				Where("tags.name = ?", forTag)
-		}
-
-		// Apply type filter if specified
+		query := logbook.Query{For: forTag, Limit: n}
+		query.Sort, query.Asc = logSort(cmd.ErrOrStderr(), sort, order)
 		if doType != "" {
-			query = query.Where("type = ?", mapType(doType))
+			query.Type = mapType(doType)
 		}
-
-		query = query.Limit(n).Order(DoOrder(sort, order))
-
 		if !All {
 			lookBack := time.Now().AddDate(0, 0, -cfg.LookBackDays)
-			query = query.Where("completed_at IS NULL OR completed_at >= ?", lookBack)
+			query.CompletedSince = &lookBack
 		}
 
-		DoLog(conn, query, unhide)
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, normalStyle.Render("profile: "+cfg.Profile))
+		return DoLog(out, svc, query, unhide)
 	},
 }
 
 var pinnedCmd = &cobra.Command{
 	Use:   "pinned",
 	Short: "Log pinned tasks",
-	Run: func(cmd *cobra.Command, args []string) {
-		conn := OpenConn(&cfg)
-		query := conn.Where("pinned = ?", true).
-			Not("deleted = ?", true).
-			Not("promoted = ?", true).
-			Order("created_at DESC")
-
-		DoLog(conn, query, false)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+		return DoLog(cmd.OutOrStdout(), svc, logbook.Query{Pinned: true, Sort: logbook.SortCreated}, false)
 	},
 }
 
 var todayCmd = &cobra.Command{
 	Use:   "today --unhide",
 	Short: "Log tasks done today",
-	Run: func(cmd *cobra.Command, args []string) {
-		conn := OpenConn(&cfg)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+
 		unhide, _ := cmd.Flags().GetBool("unhide")
 		oneDayAgo := time.Now().AddDate(0, 0, -1)
 
-		query := conn
-		query = query.Not("deleted = ?", true).
-			Not("promoted = ?", true).
-			Where("completed_at IS NULL OR completed_at >= ?", oneDayAgo).
-			Limit(100).Order(`
-			completed,
-			CASE priority
-				WHEN 'high' THEN 1
-				WHEN 'medium' THEN 2
-				WHEN 'low' THEN 3
-				ELSE 2
-			END, created_at DESC
-		`)
-		DoLog(conn, query, unhide)
+		query := logbook.Query{CompletedSince: &oneDayAgo, Limit: 100}
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+		return DoLog(out, svc, query, unhide)
 	},
 }
 
@@ -581,48 +704,41 @@ var recruitCmd = &cobra.Command{
 	Use:   "recruit <name>",
 	Short: "Add someone to target",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+
 		name := args[0]
-		conn := OpenConn(&cfg)
 
-		newTag := Tag{
-			Name: name,
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
 		}
-
-		if err := conn.Create(&newTag).Error; err != nil {
-			log.Fatalf("could not insert new row: %v", err)
+		if _, err := svc.Recruit(name); err != nil {
+			return err
 		}
 
-		fmt.Printf("🏴‍☠️  Say welcome the new recruit! '%s'\n", name)
+		fmt.Fprintf(out, "🏴‍☠️  Say welcome the new recruit! '%s'\n", name)
+		return nil
 	},
 }
 
-type Mate struct {
-	Name  string
-	Count int64
-}
-
 var crewCmd = &cobra.Command{
 	Use:   "crew",
 	Short: "List the crew",
-	Run: func(cmd *cobra.Command, args []string) {
-		conn := OpenConn(&cfg)
-
-		var crew []Mate
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
 
-		result := conn.Table("tags").
-			Select("tags.name, COUNT(do_tags.tag_id) AS count").
-			Joins("LEFT JOIN do_tags ON do_tags.tag_id = tags.id").
-			Group("tags.id").
-			Order("count DESC").
-			Find(&crew)
-
-		if result.Error != nil {
-			fmt.Printf("We have no crew aboard! %v\n", result.Error)
-			return
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+		crew, err := svc.Crew()
+		if err != nil {
+			return err
 		}
 
-		CrewLog(crew)
+		CrewLog(out, crew)
+		return nil
 	},
 }
 
@@ -630,26 +746,24 @@ var renameCmd = &cobra.Command{
 	Use:   "rename <name> <new_name>",
 	Short: "Rename the target",
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+
 		oldName := args[0]
 		newName := args[1]
 
-		conn := OpenConn(&cfg)
-
-		var tag Tag
-
-		result := conn.First(&tag, "name = ?", oldName)
-		if result.Error != nil {
-			fmt.Printf("No tag under '%v'\n", oldName)
-			return
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+		if _, err := svc.Rename(oldName, newName); err != nil {
+			return err
 		}
-
-		tag.Name = newName
-		conn.Save(&tag)
 
 		coloredOldName := color.New(color.FgYellow).Sprintf("%s", oldName)
 		coloredName := color.New(color.FgGreen).Sprintf("%s", newName)
-		fmt.Printf("We are now calling '%v' -> '%v'\n", coloredOldName, coloredName)
+		fmt.Fprintf(out, "We are now calling '%v' -> '%v'\n", coloredOldName, coloredName)
+		return nil
 	},
 }
 
@@ -657,42 +771,33 @@ var askCmd = &cobra.Command{
 	Use:   "ask <name> <message>",
 	Short: "Set ask for someone",
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+
 		name := args[0]
 		message := args[1]
 
 		prio, _ := cmd.Flags().GetString("prio")
 
-		conn := OpenConn(&cfg)
-
-		// First create or find the tag
-		var tag Tag
-		result := conn.Where("name = ?", name).First(&tag)
-		if result.Error != nil {
-			// Create new tag if it doesn't exist
-			tag = Tag{Name: name}
-			if err := conn.Create(&tag).Error; err != nil {
-				log.Fatalf("could not create tag: %v", err)
-			}
-		}
-
-		// Create the ask task
-		do := Do{
-			Description: message,
-			Type:        Ask,
-			Priority:    mapPriority(prio),
-		}
-		if err := conn.Create(&do).Error; err != nil {
-			log.Fatalf("could not create ask task: %v", err)
-		}
-
-		// Create the relationship
-		doTag := DoTag{DoID: do.ID, TagID: tag.ID}
-		if err := conn.Create(&doTag).Error; err != nil {
-			log.Fatalf("could not create do-tag relationship: %v", err)
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+		do, err := svc.AddDo(logbook.NewDo{
+			Do: Do{
+				Description: message,
+				Type:        Ask,
+				Priority:    mapPriority(prio),
+			},
+			For:     name,
+			Recruit: true,
+		})
+		if err != nil {
+			return err
 		}
 
-		fmt.Printf("Let's ask %s (id=%d)\n", name, do.ID)
+		fmt.Fprintf(out, "Let's ask %s (id=%d)\n", name, do.ID)
+		return nil
 	},
 }
 
@@ -700,42 +805,33 @@ var tellCmd = &cobra.Command{
 	Use:   "tell <name> <message>",
 	Short: "Set tell for someone",
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+
 		name := args[0]
 		message := args[1]
 
 		prio, _ := cmd.Flags().GetString("prio")
 
-		conn := OpenConn(&cfg)
-
-		// First create or find the tag
-		var tag Tag
-		result := conn.Where("name = ?", name).First(&tag)
-		if result.Error != nil {
-			// Create new tag if it doesn't exist
-			tag = Tag{Name: name}
-			if err := conn.Create(&tag).Error; err != nil {
-				log.Fatalf("could not create tag: %v", err)
-			}
-		}
-
-		// Create the tell task
-		do := Do{
-			Description: message,
-			Type:        Tell,
-			Priority:    mapPriority(prio),
-		}
-		if err := conn.Create(&do).Error; err != nil {
-			log.Fatalf("could not create tell task: %v", err)
-		}
-
-		// Create the relationship
-		doTag := DoTag{DoID: do.ID, TagID: tag.ID}
-		if err := conn.Create(&doTag).Error; err != nil {
-			log.Fatalf("could not create do-tag relationship: %v", err)
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+		do, err := svc.AddDo(logbook.NewDo{
+			Do: Do{
+				Description: message,
+				Type:        Tell,
+				Priority:    mapPriority(prio),
+			},
+			For:     name,
+			Recruit: true,
+		})
+		if err != nil {
+			return err
 		}
 
-		fmt.Printf("Let's tell %s (id=%d)\n", name, do.ID)
+		fmt.Fprintf(out, "Let's tell %s (id=%d)\n", name, do.ID)
+		return nil
 	},
 }
 
@@ -743,22 +839,24 @@ var bragCmd = &cobra.Command{
 	Use:   "brag <message>",
 	Short: "Set brag for achievement",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		message := args[0]
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
 
-		conn := OpenConn(&cfg)
+		message := args[0]
 
-		do := Do{
-			Description: message,
-			Type:        Brag,
-			Completed:   false,
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
 		}
-
-		if err := conn.Create(&do).Error; err != nil {
-			log.Fatalf("could not insert new row: %v", err)
+		do, err := svc.AddDo(logbook.NewDo{
+			Do: Do{Description: message, Type: Brag},
+		})
+		if err != nil {
+			return err
 		}
 
-		fmt.Printf("Added brag: (id=%d)\n", do.ID)
+		fmt.Fprintf(out, "Added brag: (id=%d)\n", do.ID)
+		return nil
 	},
 }
 
@@ -767,22 +865,24 @@ var learnCmd = &cobra.Command{
 	Short: "Set learn for something",
 	Long:  "Set a task to cover dealing with certain topics in which you'd like to improve at",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		message := args[0]
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
 
-		conn := OpenConn(&cfg)
+		message := args[0]
 
-		do := Do{
-			Description: message,
-			Type:        Learn,
-			Completed:   false,
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
 		}
-
-		if err := conn.Create(&do).Error; err != nil {
-			log.Fatalf("could not insert new row: %v", err)
+		do, err := svc.AddDo(logbook.NewDo{
+			Do: Do{Description: message, Type: Learn},
+		})
+		if err != nil {
+			return err
 		}
 
-		fmt.Printf("Added learn: (id=%d)\n", do.ID)
+		fmt.Fprintf(out, "Added learn: (id=%d)\n", do.ID)
+		return nil
 	},
 }
 
@@ -790,39 +890,25 @@ var reassignCmd = &cobra.Command{
 	Use:   "reassign <do_id> <name>",
 	Short: "Reassign the do to someone else.",
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
-		id := args[0]
-		name := args[1]
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
 
-		conn := OpenConn(&cfg)
-
-		var do Do
-
-		result := conn.Where("deleted = ?", false).First(&do, id)
-		if result.Error != nil {
-			fmt.Printf("No do under id '%v'\n", id)
-			return
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
 		}
+		name := args[1]
 
-		var tag Tag
-
-		result = conn.Where("name = ?", name).First(&tag)
-		if result.Error != nil {
-			fmt.Printf("No recruit called '%v'\n", name)
-			return
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
 		}
-
-		// Delete any existing assignments for this do
-		if err := conn.Where("do_id = ?", do.ID).Delete(&DoTag{}).Error; err != nil {
-			log.Fatalf("could not delete existing assignments: %v", err)
+		if _, err := svc.Assign(id, name); err != nil {
+			return err
 		}
 
-		doTag := DoTag{DoID: do.ID, TagID: tag.ID}
-		if err := conn.Create(&doTag).Error; err != nil {
-			log.Fatalf("could not insert new row: %v", err)
-		}
-
-		fmt.Printf("We've reassigned the do to '%s'\n", name)
+		fmt.Fprintf(out, "We've reassigned the do to '%s'\n", name)
+		return nil
 	},
 }
 
@@ -830,24 +916,25 @@ var unassignCmd = &cobra.Command{
 	Use:   "unassign <do_id>",
 	Short: "Unassign the do.",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		id := args[0]
-
-		conn := OpenConn(&cfg)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
 
-		var do Do
-		result := conn.Where("deleted = ?", false).First(&do, id)
-		if result.Error != nil {
-			fmt.Printf("No do under id '%v'\n", id)
-			return
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
 		}
 
-		// Delete any existing assignments for this do
-		if err := conn.Where("do_id = ?", do.ID).Delete(&DoTag{}).Error; err != nil {
-			log.Fatalf("could not delete existing assignments: %v", err)
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+		do, err := svc.Unassign(id)
+		if err != nil {
+			return err
 		}
 
-		fmt.Printf("Unassigned do %d\n", do.ID)
+		fmt.Fprintf(out, "Unassigned do %d\n", do.ID)
+		return nil
 	},
 }
 
@@ -855,18 +942,24 @@ var detailCmd = &cobra.Command{
 	Use:   "detail <do_id>",
 	Short: "Show the details of a do",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		id := args[0]
-		conn := OpenConn(&cfg)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
+		}
+
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
 
-		var do Do
-		result := conn.First(&do, id)
-		if result.Error != nil {
-			fmt.Printf("No do under id '%v'\n", id)
-			return
+		do, err := svc.Find(id)
+		if err != nil {
+			return err
 		}
 
-		DoDetails(conn, result)
+		DoDetails(cmd.OutOrStdout(), do)
+		return nil
 	},
 }
 
@@ -874,32 +967,34 @@ var docCmd = &cobra.Command{
 	Use:   "doc <do_id>",
 	Short: "Document the specifics",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		id := args[0]
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
 
-		conn := OpenConn(&cfg)
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
+		}
 
-		var do Do
-		result := conn.Where("deleted = ?", false).First(&do, id)
-		if result.Error != nil {
-			fmt.Printf("No do under id '%v'\n", id)
-			return
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+
+		do, err := svc.Get(id)
+		if err != nil {
+			return err
 		}
 
 		// Create a temporary file
 		title := url.PathEscape(strings.ReplaceAll(do.Description, " ", "+"))
 		tmpfile, err := os.CreateTemp("", fmt.Sprintf("capdoc-ID%d-%s-*.md", do.ID, title))
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 		defer os.Remove(tmpfile.Name())
 
 		// Write existing doc if it exists
-		var existingDoc DoDoc
-		result = conn.Where("do_id = ?", do.ID).First(&existingDoc)
-		if result.Error == nil {
-			tmpfile.WriteString(existingDoc.Text)
-		}
+		tmpfile.WriteString(do.Doc.Text)
 		tmpfile.Close()
 
 		// Get editor from environment or fallback to vim
@@ -915,39 +1010,33 @@ var docCmd = &cobra.Command{
 		editorCmd.Stderr = os.Stderr
 		err = editorCmd.Run()
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
 		// Read the edited content
 		content, err := os.ReadFile(tmpfile.Name())
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
-		// Save to database
-		doc := DoDoc{
-			DoID: do.ID,
-			Text: string(content),
+		empty := len(strings.TrimSpace(string(content))) == 0
+		if do.Doc.ID == 0 && empty {
+			return nil
 		}
 
-		if result.Error == nil {
-			// Update existing doc
-			if len(strings.TrimSpace(string(content))) == 0 {
-				// If content is empty, delete the doc
-				conn.Delete(&existingDoc)
-				fmt.Printf("Documentation deleted for task %d\n", do.ID)
-			} else {
-				existingDoc.Text = string(content)
-				conn.Save(&existingDoc)
-				fmt.Printf("Documentation updated for task %d\n", do.ID)
-			}
-		} else {
-			// Create new doc only if content is not empty
-			if len(strings.TrimSpace(string(content))) > 0 {
-				conn.Create(&doc)
-				fmt.Printf("Documentation saved for task %d\n", do.ID)
-			}
+		if _, err := svc.SetDoc(do.ID, string(content)); err != nil {
+			return err
+		}
+
+		switch {
+		case do.Doc.ID == 0:
+			fmt.Fprintf(out, "Documentation saved for task %d\n", do.ID)
+		case empty:
+			fmt.Fprintf(out, "Documentation deleted for task %d\n", do.ID)
+		default:
+			fmt.Fprintf(out, "Documentation updated for task %d\n", do.ID)
 		}
+		return nil
 	},
 }
 
@@ -955,25 +1044,31 @@ var viewCmd = &cobra.Command{
 	Use:   "view <do_id>",
 	Short: "View the do's documentation",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		id := args[0]
-		conn := OpenConn(&cfg)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
 
-		var do Do
-		result := conn.Preload("Doc").Where("deleted = ?", false).First(&do, id)
-		if result.Error != nil {
-			fmt.Printf("No do under id '%v'\n", id)
-			return
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
+		}
+
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+		do, err := svc.Get(id)
+		if err != nil {
+			return err
 		}
 
 		if do.Doc.ID == 0 {
-			fmt.Printf("No documentation for do %d\n", do.ID)
-			return
+			fmt.Fprintf(out, "No documentation for do %d\n", do.ID)
+			return nil
 		}
 
 		// Print task details
-		fmt.Printf("Documentation (id=%d): %s\n\n", do.ID, highlightStyle.Render(do.Description))
-		fmt.Println(strings.Repeat("-", 40))
+		fmt.Fprintf(out, "Documentation (id=%d): %s\n\n", do.ID, highlightStyle.Render(do.Description))
+		fmt.Fprintln(out, strings.Repeat("-", 40))
 
 		// Initialize glamour renderer
 		r, _ := glamour.NewTermRenderer(
@@ -981,31 +1076,38 @@ var viewCmd = &cobra.Command{
 			glamour.WithWordWrap(80),
 		)
 
-		out, err := r.Render(do.Doc.Text)
+		rendered, err := r.Render(do.Doc.Text)
 		if err != nil {
-			fmt.Printf("Error rendering markdown: %v\n", err)
-			return
+			return fmt.Errorf("could not render markdown: %w", err)
 		}
 
-		fmt.Print(out)
+		fmt.Fprint(out, rendered)
+		return nil
 	},
 }
 
 var templatesCmd = &cobra.Command{
 	Use:   "templates",
 	Short: "List all templates",
-	Run: func(cmd *cobra.Command, args []string) {
-		conn := OpenConn(&cfg)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
 
-		var templates []Template
-		conn.Where("deleted = ?", false).Order("updated_at DESC").Find(&templates)
+		templates, err := svc.Templates()
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
 
 		if len(templates) == 0 {
-			fmt.Println("No templates found.")
-			return
+			fmt.Fprintln(out, "No templates found.")
+			return nil
 		}
 
-		tbl := sebtable.New("name", "preview", "updated")
+		tbl := sebtable.New("name", "preview", "updated").WithWriter(out)
 		headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
 		tbl.WithHeaderFormatter(headerFmt)
 
@@ -1023,6 +1125,7 @@ var templatesCmd = &cobra.Command{
 		}
 
 		tbl.Print()
+		return nil
 	},
 }
 
@@ -1030,7 +1133,7 @@ var configCmd = &cobra.Command{
 	Use:   "config <key> <value>",
 	Short: "Set items in the config file",
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		key := args[0]
 		value := args[1]
 
@@ -1044,24 +1147,28 @@ var configCmd = &cobra.Command{
 		}
 
 		if err != nil {
-			fmt.Printf("Error updating config: %v\n", err)
-			return
+			return fmt.Errorf("could not update config: %w", err)
 		}
-		fmt.Printf("Updated '%s' -> '%s'\n", key, value)
+		fmt.Fprintf(cmd.OutOrStdout(), "Updated '%s' -> '%s'\n", key, value)
+		return nil
 	},
 }
 
 func init() {
+	RootCmd.PersistentFlags().String("config", "", "Read the config from this file")
+
 	doCmd.Flags().String("for", "", "Set the tag/person")
 	doCmd.Flags().String("type", "task", "Set the type (task/ask/tell/brag/learn/pr/meta)")
 	doCmd.Flags().String("prio", "medium", "Set the priority (low/medium/high)")
 	doCmd.Flags().StringP("template", "t", "", "Use a template")
+	doCmd.Flags().String("est", "", "Set the estimate (minutes, 1h30m, or xs/s/m/l/xl)")
+	doCmd.Flags().String("due", "", "Set the due date (YYYY-MM-DD, today, tomorrow or +<n>d)")
 
 	askCmd.Flags().String("prio", "medium", "Set the priority (low/medium/high)")
 
 	tellCmd.Flags().String("prio", "medium", "Set the priority (low/medium/high)")
 
-	logCmd.Flags().IntP("n", "n", cfg.LogLength, "Limit the number of dos outstanding")
+	logCmd.Flags().IntP("n", "n", 0, "Limit the number of dos outstanding (log_length by default)")
 	logCmd.Flags().StringP("sort", "s", "default", "Set the sort (created_at/completed_at/priority)")
 	logCmd.Flags().StringP("order", "o", "desc", "Set the order (asc/desc)")
 	logCmd.Flags().BoolVar(&All, "all", false, "return all instead of filtering")
@@ -4,9 +4,14 @@ import (
 	"bytes"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"captain/logbook"
+
+	"github.com/charmbracelet/lipgloss"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -34,7 +39,7 @@ func setupTestEnv(t *testing.T) (*gorm.DB, *Config, func()) {
 	}
 
 	err = conn.AutoMigrate(
-		&Do{}, &Tag{}, &DoTag{}, &DoDoc{}, &Template{},
+		&Do{}, &Tag{}, &DoTag{}, &DoDoc{}, &Template{}, &Harvest{}, &GitLink{},
 		&FileRecord{}, &DirectoryState{}, &UserPreference{},
 	)
 	if err != nil {
@@ -744,3 +749,196 @@ func TestLogQueryFilters(t *testing.T) {
 		})
 	}
 }
+
+// runCaptain runs captain with args against store, returning what it printed
+// and the error it would exit with.
+// captainDirs keeps one captain directory per test, so runs in a test can
+// build on each other
+var captainDirs = map[*testing.T]string{}
+
+func runCaptain(t *testing.T, store logbook.Store, args ...string) (string, error) {
+	t.Helper()
+
+	if _, ok := captainDirs[t]; !ok {
+		captainDirs[t] = t.TempDir()
+		t.Cleanup(func() { delete(captainDirs, t) })
+	}
+
+	originalCfg, originalOpen, originalConfirm := cfg, openStore, confirm
+	t.Cleanup(func() { cfg, openStore, confirm = originalCfg, originalOpen, originalConfirm })
+
+	// No hooks in the captain directory and yes to every question
+	t.Setenv("CAPTAIN_DIR", captainDirs[t])
+	openStore = func(*Config) (logbook.Store, error) { return store, nil }
+	confirm = func(Do, string, lipgloss.Style) (bool, error) { return true, nil }
+
+	// Flags keep their values between runs of the same commands
+	defer resetCommands(RootCmd)
+
+	buf := new(bytes.Buffer)
+	RootCmd.SetOut(buf)
+	RootCmd.SetErr(buf)
+	RootCmd.SetArgs(args)
+	defer RootCmd.SetOut(nil)
+	defer RootCmd.SetErr(nil)
+
+	err := execute(RootCmd)
+	return buf.String(), err
+}
+
+func resetCommands(cmd *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			// The default of a slice is shown as [a,b]
+			var values []string
+			if def := strings.Trim(f.DefValue, "[]"); def != "" {
+				values = strings.Split(def, ",")
+			}
+			slice.Replace(values)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	cmd.SilenceUsage = false
+	for _, sub := range cmd.Commands() {
+		resetCommands(sub)
+	}
+}
+
+func TestCommandsOverMemStore(t *testing.T) {
+	store := logbook.NewMemStore()
+
+	tests := []struct {
+		args []string
+		want string
+		code int
+	}{
+		{[]string{"do", "Write the report"}, "Added do: (id=1)", exitOK},
+		{[]string{"do", "write the REPORT"}, "do already exists: 1", exitExists},
+		{[]string{"do", "--for", "alice", "Review"}, "no tag called 'alice'", exitNotFound},
+		{[]string{"do", "--est", "forever", "Review"}, "unknown estimate 'forever'", exitInvalid},
+		{[]string{"recruit", "alice"}, "Say welcome the new recruit! 'alice'", exitOK},
+		{[]string{"ask", "alice", "Where are the docs?"}, "Let's ask alice", exitOK},
+		{[]string{"did", "1"}, "Marked 1 as done", exitOK},
+		{[]string{"did", "99"}, "no do under id '99'", exitNotFound},
+		{[]string{"pin"}, "accepts 1 arg(s), received 0", exitInvalid},
+		{[]string{"set", "colour", "red", "1"}, "the field 'colour' is not supported", exitInvalid},
+		{[]string{"crew"}, "alice", exitOK},
+		{[]string{"log"}, "Where are the docs?", exitOK},
+		{[]string{"detail", "1"}, "Write the report", exitOK},
+		{[]string{"detail", "x"}, "'x' is not a do id", exitInvalid},
+		{[]string{"templates"}, "No templates found.", exitOK},
+		{[]string{"stats"}, "created: 2  completed: 1", exitOK},
+		{[]string{"export", "md"}, "Where are the docs?", exitOK},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			out, err := runCaptain(t, store, tt.args...)
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("Expected output to contain %q, got:\n%s", tt.want, out)
+			}
+			if code := ExitCode(err); code != tt.code {
+				t.Errorf("Expected exit code %d, got %d (%v)", tt.code, code, err)
+			}
+		})
+	}
+
+	do, err := store.Do(1)
+	if err != nil || !do.Completed {
+		t.Errorf("Expected do 1 to be completed in the store, got %+v (%v)", do, err)
+	}
+}
+
+func TestErrorsGoToStderr(t *testing.T) {
+	store := logbook.NewMemStore()
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	RootCmd.SetOut(stdout)
+	RootCmd.SetErr(stderr)
+	defer RootCmd.SetOut(nil)
+	defer RootCmd.SetErr(nil)
+
+	originalOpen := openStore
+	defer func() { openStore = originalOpen }()
+	openStore = func(*Config) (logbook.Store, error) { return store, nil }
+	defer resetCommands(RootCmd)
+
+	RootCmd.SetArgs([]string{"pin", "7"})
+	err := execute(RootCmd)
+	if ExitCode(err) != exitNotFound {
+		t.Errorf("Expected not found, got %v", err)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("Expected nothing on stdout, got %q", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "no do under id '7'") {
+		t.Errorf("Expected the error on stderr, got %q", stderr.String())
+	}
+	if strings.Contains(stderr.String(), "Usage:") {
+		t.Errorf("Expected no usage for a command that failed, got %q", stderr.String())
+	}
+}
+
+func TestDeclinedIsCancelled(t *testing.T) {
+	store := logbook.NewMemStore()
+	runCaptain(t, store, "do", "Keep me")
+
+	originalOpen, originalConfirm := openStore, confirm
+	defer func() { openStore, confirm = originalOpen, originalConfirm }()
+	openStore = func(*Config) (logbook.Store, error) { return store, nil }
+	confirm = func(Do, string, lipgloss.Style) (bool, error) { return false, nil }
+
+	RootCmd.SetErr(new(bytes.Buffer))
+	defer RootCmd.SetErr(nil)
+	defer resetCommands(RootCmd)
+
+	RootCmd.SetArgs([]string{"did", "1"})
+	if err := execute(RootCmd); ExitCode(err) != exitCancelled {
+		t.Errorf("Expected the completion to be cancelled, got %v", err)
+	}
+	if do, _ := store.Do(1); do.Completed {
+		t.Error("Expected a declined completion not to be saved")
+	}
+}
+
+func TestScratchCommandOverMemStore(t *testing.T) {
+	store := logbook.NewMemStore()
+	runCaptain(t, store, "do", "Mistake")
+
+	out, _ := runCaptain(t, store, "scratch", "1", "duplicate")
+	if !strings.Contains(out, "Deleted do 1 (reason: duplicate)") {
+		t.Errorf("Unexpected output: %s", out)
+	}
+
+	if out, _ := runCaptain(t, store, "log"); !strings.Contains(out, "No tasks found.") {
+		t.Errorf("Expected the scratched do off the log, got:\n%s", out)
+	}
+
+	if out, _ := runCaptain(t, store, "unscratch", "1"); !strings.Contains(out, "Resurrected 1") {
+		t.Errorf("Unexpected output: %s", out)
+	}
+}
+
+func TestTemplateCommandsOverMemStore(t *testing.T) {
+	store := logbook.NewMemStore()
+	svc := logbook.New(store)
+	if _, err := svc.CreateTemplate("bug", "Fix {{ what:string }}"); err != nil {
+		t.Fatalf("CreateTemplate: %v", err)
+	}
+
+	if out, _ := runCaptain(t, store, "template", "list"); !strings.Contains(out, "bug") {
+		t.Errorf("Expected the template to be listed, got:\n%s", out)
+	}
+
+	RootCmd.SetIn(strings.NewReader("y\n"))
+	defer RootCmd.SetIn(nil)
+	if out, _ := runCaptain(t, store, "template", "delete", "bug"); !strings.Contains(out, "Deleted template 'bug'") {
+		t.Errorf("Unexpected output: %s", out)
+	}
+	if out, _ := runCaptain(t, store, "template", "list"); !strings.Contains(out, "No templates found.") {
+		t.Errorf("Expected no templates, got:\n%s", out)
+	}
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"captain/logbook"
+)
+
+func TestMain(m *testing.M) {
+	// The test binary stands in for captain when a test runs it as a command
+	if os.Getenv("CAPTAIN_TEST_COMMAND") == "1" {
+		if err := Execute(); err != nil {
+			os.Exit(ExitCode(err))
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// captainProcess runs captain in its own process with dir as CAPTAIN_DIR,
+// returning its exit code and output
+func captainProcess(dir string, args ...string) (int, string) {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "CAPTAIN_TEST_COMMAND=1", "CAPTAIN_DIR="+dir, "CAPTAIN_DB=", "CAPTAIN_PROFILE=")
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), string(out)
+	}
+	if err != nil {
+		return -1, err.Error()
+	}
+	return 0, string(out)
+}
+
+func TestConcurrentCommands(t *testing.T) {
+	dir := t.TempDir()
+	if code, out := captainProcess(dir, "recruit", "dave"); code != 0 {
+		t.Fatalf("recruit: %d %s", code, out)
+	}
+	if code, out := captainProcess(dir, "do", "First"); code != 0 {
+		t.Fatalf("do: %d %s", code, out)
+	}
+
+	// Another command keeps the database locked for a while
+	conn, err := logbook.Connect(filepath.Join(dir, defaultConfig(dir).DBFile))
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	tx := conn.Begin()
+	tx.Create(&Tag{Name: "held"})
+	go func() {
+		time.Sleep(time.Second)
+		tx.Commit()
+	}()
+
+	runs := [][]string{{"reassign", "1", "dave"}}
+	for i := range 4 {
+		runs = append(runs,
+			[]string{"do", fmt.Sprintf("Task %d", i)},
+			[]string{"ask", "dave", fmt.Sprintf("Question %d", i)},
+			[]string{"tell", "dave", fmt.Sprintf("Answer %d", i)},
+			[]string{"do", "Everyone wants this"},
+		)
+	}
+
+	var wg sync.WaitGroup
+	codes := make([]int, len(runs))
+	outs := make([]string, len(runs))
+	for i, args := range runs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i], outs[i] = captainProcess(dir, args...)
+		}()
+	}
+	wg.Wait()
+
+	duplicates := 0
+	for i, code := range codes {
+		switch {
+		case code == exitExists && runs[i][1] == "Everyone wants this":
+			duplicates++
+		case code != 0:
+			t.Errorf("%v: exit %d: %s", runs[i], code, outs[i])
+		}
+	}
+	if duplicates != 3 {
+		t.Errorf("Expected one of the same do added, got %d duplicates", duplicates)
+	}
+
+	var dos, asks, crew int64
+	conn.Model(&Do{}).Count(&dos)
+	conn.Model(&Do{}).Where("type IN ?", []DoType{Ask, Tell}).Count(&asks)
+	conn.Model(&DoTag{}).Count(&crew)
+	if dos != 1+4+8+1 || asks != 8 || crew != 9 {
+		t.Errorf("Expected 14 dos, 8 asks and tells and 9 assigned, got %d, %d and %d", dos, asks, crew)
+	}
+}
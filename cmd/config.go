@@ -3,23 +3,48 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"time"
+
+	"captain/logbook"
 
 	"gopkg.in/ini.v1"
 )
 
-type IniConfig struct {
-	Profile string `ini:"profile"`
+type Config struct {
+	DBFile         string        `ini:"dbname"`
+	LookBackDays   int           `ini:"lookback_days"`
+	LogLength      int           `ini:"log_length"`
+	HookTimeout    time.Duration `ini:"hook_timeout"`
+	HookFailure    string        `ini:"hook_failure"` // warn or abort
+	ServeToken     string        `ini:"serve_token"`
+	BackupKeep     int           `ini:"backup_keep"`     // 0 keeps every backup
+	BackupInterval time.Duration `ini:"backup_interval"` // 0 never backs up
+	CaptainDir     string
+	Profile        string `ini:"-"`
+	ConfigFile     string `ini:"-"` // where the config was read from
 }
 
-type Config struct {
-	DBFile       string `ini:"dbname"`
-	LookBackDays int    `ini:"lookback_days"`
-	LogLength    int    `ini:"log_length"`
-	CaptainDir   string
+const defaultProfile = "main"
+
+// configPath is the config file, where changes to the config are saved
+func (c *Config) configPath() string {
+	if c.ConfigFile != "" {
+		return c.ConfigFile
+	}
+	return filepath.Join(c.CaptainDir, "config.ini")
+}
+
+// saveConfig writes file to path, making its directory the first time
+func saveConfig(file *ini.File, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return file.SaveTo(path)
 }
 
 func (cfg *Config) Set(key string, value string) error {
-	cfgFile := fmt.Sprintf("%s/config.ini", cfg.CaptainDir)
+	cfgFile := cfg.configPath()
 
 	file, err := ini.LooseLoad(cfgFile)
 	if err != nil {
@@ -28,91 +53,134 @@ func (cfg *Config) Set(key string, value string) error {
 
 	file.Section("").Key(key).SetValue(value)
 
-	err = file.SaveTo(cfgFile)
+	err = saveConfig(file, cfgFile)
 	if err != nil {
 		return fmt.Errorf("failed to save:%w", err)
 	}
 	return nil
 }
 
-func LoadConfig() Config {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		panic("failed to get the user's home directory")
+// configPaths are where captain looks for its config file and keeps its
+// logbook. CAPTAIN_DIR holds both, as does ~/.captain when it's there from an
+// older captain; otherwise they're kept apart in $XDG_CONFIG_HOME/captain and
+// $XDG_DATA_HOME/captain.
+func configPaths() (string, string, error) {
+	if dir := os.Getenv("CAPTAIN_DIR"); dir != "" {
+		return filepath.Join(dir, "config.ini"), dir, nil
 	}
 
-	capDir := fmt.Sprintf("%s/.captain", homeDir)
-	err = os.MkdirAll(capDir, os.ModePerm)
+	home, err := os.UserHomeDir()
 	if err != nil {
-		panic("failed to create directory")
+		return "", "", fmt.Errorf("could not find the home directory: %w", err)
+	}
+	legacy := filepath.Join(home, ".captain")
+	if info, err := os.Stat(legacy); err == nil && info.IsDir() {
+		return filepath.Join(legacy, "config.ini"), legacy, nil
 	}
 
-	cfgFile := fmt.Sprintf("%s/config.ini", capDir)
-
-	// Default profile configuration
-	iniCfg := IniConfig{Profile: "main"}
-
-	// Default config values
-	cfg := Config{
-		DBFile:       "testdo.db",
-		LookBackDays: 7,
-		LogLength:    10,
-		CaptainDir:   capDir,
+	// Relative paths aren't valid XDG directories, they're ignored
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if !filepath.IsAbs(configHome) {
+		configHome = filepath.Join(home, ".config")
 	}
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if !filepath.IsAbs(dataHome) {
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(configHome, "captain", "config.ini"), filepath.Join(dataHome, "captain"), nil
+}
 
-	// If config file exists, try to load it
-	var file *ini.File
-	if _, err := os.Stat(cfgFile); err == nil {
-		// Load existing file to preserve other profiles
-		file, err = ini.Load(cfgFile)
-		if err != nil {
-			panic("Failed to load config file")
-		}
-	} else {
-		// Create new file if it doesn't exist
-		file = ini.Empty()
-	}
-
-	// Load profile from root section
-	err = file.Section("").MapTo(&iniCfg)
-	if err == nil {
-		// Try to load config from the specified profile
-		err = file.Section(iniCfg.Profile).MapTo(&cfg)
-		if err != nil {
-			// Profile doesn't exist, will create it with defaults
-			fmt.Printf("Profile '%s' not found, creating with defaults\n", iniCfg.Profile)
-		}
+// LoadConfig reads the config from path and the settings of profile, the
+// config file and profile in use when they're empty. CAPTAIN_PROFILE picks
+// the profile when none is given, CAPTAIN_DIR and CAPTAIN_DB override the
+// directory and database. Nothing is created: the directories and file are
+// made when something is saved in them.
+func LoadConfig(path, profile string) (Config, error) {
+	defaultPath, dir, err := configPaths()
+	if err != nil {
+		return Config{}, err
 	}
 
-	// Save the profile in root section
-	file.Section("").ReflectFrom(&iniCfg)
-	// Save the config values in profile section
-	err = file.Section(iniCfg.Profile).ReflectFrom(&cfg)
+	if path == "" {
+		path = defaultPath
+	} else if _, err := os.Stat(path); err != nil {
+		return Config{}, notFoundf("no config file at %s", path)
+	}
+	file, err := ini.LooseLoad(path)
 	if err != nil {
-		panic("Error reflecting config values")
+		return Config{}, invalidf("could not read config %s: %v", path, err)
 	}
 
-	err = file.SaveTo(cfgFile)
+	if profile == "" {
+		profile = os.Getenv("CAPTAIN_PROFILE")
+	}
+	if profile == "" {
+		profile = selectedProfile(file)
+	}
+	cfg, err := readProfile(file, dir, profile)
 	if err != nil {
-		panic("Error saving config file")
+		return Config{}, err
 	}
 
-	return cfg
+	if dir := os.Getenv("CAPTAIN_DIR"); dir != "" {
+		cfg.CaptainDir = dir
+	}
+	if db := os.Getenv("CAPTAIN_DB"); db != "" {
+		cfg.DBFile = db
+	}
+	cfg.ConfigFile = path
+	return cfg, nil
+}
+
+// selectedProfile is the profile in use, unless another is picked for a run
+func selectedProfile(file *ini.File) string {
+	return file.Section("").Key("profile").MustString(defaultProfile)
+}
+
+// defaultConfig is the config of a profile that sets nothing
+func defaultConfig(capDir string) Config {
+	return Config{
+		DBFile:         "testdo.db",
+		LookBackDays:   7,
+		LogLength:      10,
+		HookTimeout:    10 * time.Second,
+		HookFailure:    "warn",
+		BackupKeep:     7,
+		BackupInterval: 24 * time.Hour,
+		CaptainDir:     capDir,
+	}
+}
+
+// readProfile reads the config of a profile from its section of file. The
+// selected profile has the defaults until something is set in it.
+func readProfile(file *ini.File, capDir, profile string) (Config, error) {
+	cfg := defaultConfig(capDir)
+	cfg.Profile = profile
+	if !file.HasSection(profile) {
+		if profile == selectedProfile(file) {
+			return cfg, nil
+		}
+		return Config{}, logbook.Errorf(logbook.ErrNotFound, "no profile named '%s'", profile)
+	}
+	if err := file.Section(profile).MapTo(&cfg); err != nil {
+		return Config{}, fmt.Errorf("could not read profile '%s': %w", profile, err)
+	}
+	return cfg, nil
 }
 
 // SetProfile sets a value in the current profile section
 func (c *Config) SetProfile(key, value string) error {
-	cfgFile := fmt.Sprintf("%s/config.ini", c.CaptainDir)
+	cfgFile := c.configPath()
 
 	file, err := ini.LooseLoad(cfgFile)
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	// Get current profile from root section
-	profile := file.Section("").Key("profile").String()
+	// The profile in use, unless it's the one in the root section
+	profile := c.Profile
 	if profile == "" {
-		return fmt.Errorf("no profile selected")
+		profile = selectedProfile(file)
 	}
 
 	// Ensure the profile section exists
@@ -123,7 +191,7 @@ func (c *Config) SetProfile(key, value string) error {
 	// Set the value in the profile section
 	file.Section(profile).Key(key).SetValue(value)
 
-	err = file.SaveTo(cfgFile)
+	err = saveConfig(file, cfgFile)
 	if err != nil {
 		return fmt.Errorf("failed to save config: %w", err)
 	}
@@ -1,23 +1,34 @@
 package cmd
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"captain/logbook"
+
 	"gopkg.in/ini.v1"
 )
 
-func TestLoadConfig(t *testing.T) {
-	// Create a temporary directory for test config
-	tmpDir := t.TempDir()
+// cleanEnv points HOME at a new directory with none of captain's variables
+// set, returning the home directory
+func cleanEnv(t *testing.T) string {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for _, key := range []string{"CAPTAIN_DIR", "CAPTAIN_DB", "CAPTAIN_PROFILE", "XDG_CONFIG_HOME", "XDG_DATA_HOME"} {
+		t.Setenv(key, "")
+	}
+	return home
+}
 
-	// Temporarily change HOME to point to temp directory
-	origHome := os.Getenv("HOME")
-	os.Setenv("HOME", tmpDir)
-	defer os.Setenv("HOME", origHome)
+func TestLoadConfig(t *testing.T) {
+	tmpDir := cleanEnv(t)
 
-	cfg := LoadConfig()
+	cfg, err := LoadConfig("", "")
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
 
 	if cfg.DBFile == "" {
 		t.Error("Expected DBFile to be set")
@@ -35,21 +46,20 @@ func TestLoadConfig(t *testing.T) {
 		t.Error("Expected CaptainDir to be set")
 	}
 
-	// Verify config file was created
-	cfgPath := filepath.Join(tmpDir, ".captain", "config.ini")
-	if _, err := os.Stat(cfgPath); os.IsNotExist(err) {
-		t.Error("Expected config file to be created")
+	// Loading has no side effects
+	entries, _ := os.ReadDir(tmpDir)
+	if len(entries) != 0 {
+		t.Errorf("Expected nothing created in %s, got %v", tmpDir, entries)
 	}
 }
 
 func TestConfigDefaults(t *testing.T) {
-	tmpDir := t.TempDir()
+	cleanEnv(t)
 
-	origHome := os.Getenv("HOME")
-	os.Setenv("HOME", tmpDir)
-	defer os.Setenv("HOME", origHome)
-
-	cfg := LoadConfig()
+	cfg, err := LoadConfig("", "")
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
 
 	expectedDefaults := map[string]interface{}{
 		"DBFile":       "testdo.db",
@@ -68,6 +78,10 @@ func TestConfigDefaults(t *testing.T) {
 	if cfg.LogLength != expectedDefaults["LogLength"] {
 		t.Errorf("Expected LogLength to be %d, got %d", expectedDefaults["LogLength"], cfg.LogLength)
 	}
+
+	if cfg.Profile != "main" {
+		t.Errorf("Expected Profile to be main, got %s", cfg.Profile)
+	}
 }
 
 func TestConfigSet(t *testing.T) {
@@ -143,17 +157,128 @@ func TestConfigSetProfile(t *testing.T) {
 	}
 }
 
-func TestCaptainDirCreation(t *testing.T) {
-	tmpDir := t.TempDir()
+func TestConfigPaths(t *testing.T) {
+	home := cleanEnv(t)
+	xdg := t.TempDir()
+
+	cases := []struct {
+		name     string
+		env      map[string]string
+		legacy   bool
+		wantFile string
+		wantDB   string
+	}{
+		{
+			name:     "xdg defaults",
+			wantFile: filepath.Join(home, ".config", "captain", "config.ini"),
+			wantDB:   filepath.Join(home, ".local", "share", "captain", "testdo.db"),
+		},
+		{
+			name:     "xdg",
+			env:      map[string]string{"XDG_CONFIG_HOME": filepath.Join(xdg, "config"), "XDG_DATA_HOME": filepath.Join(xdg, "data")},
+			wantFile: filepath.Join(xdg, "config", "captain", "config.ini"),
+			wantDB:   filepath.Join(xdg, "data", "captain", "testdo.db"),
+		},
+		{
+			name:     "relative xdg is ignored",
+			env:      map[string]string{"XDG_CONFIG_HOME": "config", "XDG_DATA_HOME": "data"},
+			wantFile: filepath.Join(home, ".config", "captain", "config.ini"),
+			wantDB:   filepath.Join(home, ".local", "share", "captain", "testdo.db"),
+		},
+		{
+			name:     "legacy directory",
+			env:      map[string]string{"XDG_CONFIG_HOME": filepath.Join(xdg, "config")},
+			legacy:   true,
+			wantFile: filepath.Join(home, ".captain", "config.ini"),
+			wantDB:   filepath.Join(home, ".captain", "testdo.db"),
+		},
+		{
+			name:     "CAPTAIN_DIR",
+			env:      map[string]string{"CAPTAIN_DIR": xdg},
+			legacy:   true,
+			wantFile: filepath.Join(xdg, "config.ini"),
+			wantDB:   filepath.Join(xdg, "testdo.db"),
+		},
+		{
+			name:     "CAPTAIN_DB",
+			env:      map[string]string{"CAPTAIN_DIR": xdg, "CAPTAIN_DB": "/elsewhere/captain.db"},
+			wantFile: filepath.Join(xdg, "config.ini"),
+			wantDB:   "/elsewhere/captain.db",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+			legacy := filepath.Join(home, ".captain")
+			if tc.legacy {
+				os.Mkdir(legacy, 0o755)
+				defer os.Remove(legacy)
+			}
+
+			cfg, err := LoadConfig("", "")
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+			if cfg.configPath() != tc.wantFile {
+				t.Errorf("Expected config file %s, got %s", tc.wantFile, cfg.configPath())
+			}
+			if dbPath(&cfg) != tc.wantDB {
+				t.Errorf("Expected database %s, got %s", tc.wantDB, dbPath(&cfg))
+			}
+		})
+	}
+}
 
-	origHome := os.Getenv("HOME")
-	os.Setenv("HOME", tmpDir)
-	defer os.Setenv("HOME", origHome)
+func TestLoadConfigOverrides(t *testing.T) {
+	dir := cleanEnv(t)
+	path := filepath.Join(dir, "other.ini")
+	os.WriteFile(path, []byte("profile = home\n\n[home]\nlog_length = 3\n\n[work]\nlog_length = 30\n"), 0o644)
 
-	LoadConfig()
+	cfg, err := LoadConfig(path, "")
+	if err != nil || cfg.Profile != "home" || cfg.LogLength != 3 || cfg.configPath() != path {
+		t.Errorf("Expected home from %s, got %+v, %v", path, cfg, err)
+	}
 
-	capDir := filepath.Join(tmpDir, ".captain")
-	if _, err := os.Stat(capDir); os.IsNotExist(err) {
-		t.Error("Expected .captain directory to be created")
+	t.Setenv("CAPTAIN_PROFILE", "work")
+	if cfg, err := LoadConfig(path, ""); err != nil || cfg.Profile != "work" || cfg.LogLength != 30 {
+		t.Errorf("Expected work from CAPTAIN_PROFILE, got %+v, %v", cfg, err)
+	}
+	if cfg, err := LoadConfig(path, "home"); err != nil || cfg.Profile != "home" {
+		t.Errorf("Expected the profile given over CAPTAIN_PROFILE, got %+v, %v", cfg, err)
+	}
+	if _, err := LoadConfig(path, "gone"); !errors.Is(err, logbook.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing profile, got %v", err)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	dir := cleanEnv(t)
+
+	if _, err := LoadConfig(filepath.Join(dir, "gone.ini"), ""); !errors.Is(err, logbook.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing config file, got %v", err)
+	}
+
+	bad := filepath.Join(dir, "bad.ini")
+	os.WriteFile(bad, []byte("[main\n"), 0o644)
+	if _, err := LoadConfig(bad, ""); !errors.Is(err, logbook.ErrInvalid) {
+		t.Errorf("Expected ErrInvalid for a broken config file, got %v", err)
+	}
+}
+
+func TestConfigSaveMakesDirectory(t *testing.T) {
+	cleanEnv(t)
+	cfg, err := LoadConfig("", "")
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+
+	if err := cfg.SetProfile("log_length", "25"); err != nil {
+		t.Fatalf("SetProfile: %v", err)
+	}
+	if cfg, err := LoadConfig("", ""); err != nil || cfg.LogLength != 25 {
+		t.Errorf("Expected log_length saved, got %+v, %v", cfg, err)
 	}
 }
@@ -1,127 +1,149 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"os"
+	"path/filepath"
+	"strconv"
 	"time"
 
-	"gorm.io/driver/sqlite"
+	"captain/logbook"
+
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
-type DoType string
-
-const (
-	Task  DoType = "task"
-	Ask   DoType = "ask"
-	Tell  DoType = "tell"
-	Brag  DoType = "brag"
-	Learn DoType = "learn"
-	PR    DoType = "PR"
-	Meta  DoType = "meta"
+// The models live in the logbook package, these keep the commands short
+type (
+	DoType         = logbook.DoType
+	DoPrio         = logbook.DoPrio
+	Do             = logbook.Do
+	DoDoc          = logbook.DoDoc
+	Tag            = logbook.Tag
+	DoTag          = logbook.DoTag
+	Template       = logbook.Template
+	Harvest        = logbook.Harvest
+	GitLink        = logbook.GitLink
+	FileRecord     = logbook.FileRecord
+	DirectoryState = logbook.DirectoryState
+	UserPreference = logbook.UserPreference
+	Mate           = logbook.Mate
 )
 
-type DoPrio string
-
 const (
-	Low    DoPrio = "low"
-	Medium DoPrio = "medium"
-	High   DoPrio = "high"
+	Task  = logbook.Task
+	Ask   = logbook.Ask
+	Tell  = logbook.Tell
+	Brag  = logbook.Brag
+	Learn = logbook.Learn
+	PR    = logbook.PR
+	Meta  = logbook.Meta
+
+	Low    = logbook.Low
+	Medium = logbook.Medium
+	High   = logbook.High
 )
 
-type Do struct {
-	ID          uint      `gorm:"primaryKey"`
-	CreatedAt   time.Time `gorm:"default:current_timestamp"`
-	CompletedAt *time.Time
-	Completed   bool   `gorm:"default:false"`
-	Pinned      bool   `gorm:"default:false"`
-	Sensitive   bool   `gorm:"default:false"`
-	Promoted    bool   `gorm:"default:false"`
-	Description string `gorm:"not null"`
-	Type        DoType `gorm:"type:TEXT;not null"`
-	Priority    DoPrio `gorm:"type:TEXT;not null;default:medium"`
-	Deleted     bool   `gorm:"default:false"`
-	Reason      string `gorm:"type:TEXT"`
-	Doc         DoDoc  `gorm:"foreignKey:DoID"`
-	Tags        []Tag  `gorm:"many2many:do_tags;"`
-}
-
-func (DoType) GormDataType() string {
-	return "string"
-}
-
-type DoDoc struct {
-	ID   uint   `gorm:"primaryKey"`
-	DoID uint   `gorm:"not null"`
-	Text string `gorm:"type:TEXT;not null"`
+// dbPath is where the logbook database is kept, dbname is in the captain
+// directory unless it's an absolute path
+func dbPath(cfg *Config) string {
+	if filepath.IsAbs(cfg.DBFile) {
+		return cfg.DBFile
+	}
+	return filepath.Join(cfg.CaptainDir, cfg.DBFile)
 }
 
-type Tag struct {
-	ID   uint   `gorm:"primaryKey"`
-	Name string `gorm:"unique:not null"`
+// OpenConn opens the logbook database, backing it up first when the last
+// backup is older than the backup interval.
+func OpenConn(cfg *Config) (*gorm.DB, error) {
+	conn, err := logbook.Open(dbPath(cfg))
+	if err != nil {
+		return nil, err
+	}
+	// A command shouldn't fail because the backup did
+	if err := routineBackup(conn, cfg, time.Now()); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	return conn, nil
 }
 
-type DoTag struct {
-	DoID  uint `gorm:"primaryKey;not null"`
-	TagID uint `gorm:"primaryKey;not null"`
-	Do    Do   `gorm:"foreignKey:DoID"`
-	Tag   Tag  `gorm:"foreignKey:TagID"`
+// routineBackup backs up the logbook if one is due, then removes the
+// backups past backup_keep.
+func routineBackup(conn *gorm.DB, cfg *Config, now time.Time) error {
+	due, err := logbook.BackupDue(dbPath(cfg), cfg.BackupInterval, now)
+	if err != nil || !due {
+		return err
+	}
+	if err := logbook.Backup(conn, logbook.BackupPath(dbPath(cfg), logbook.RoutineBackup, now)); err != nil {
+		return err
+	}
+	_, err = logbook.Prune(dbPath(cfg), cfg.BackupKeep)
+	return err
 }
 
-type Template struct {
-	ID        uint      `gorm:"primaryKey"`
-	Name      string    `gorm:"unique;not null"`
-	Content   string    `gorm:"type:TEXT;not null"`
-	Deleted   bool      `gorm:"default:false"`
-	CreatedAt time.Time `gorm:"default:current_timestamp"`
-	UpdatedAt time.Time `gorm:"default:current_timestamp"`
+// openStore opens where the commands keep the logbook. Tests swap it for
+// a logbook.MemStore.
+var openStore = func(cfg *Config) (logbook.Store, error) {
+	conn, err := OpenConn(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return logbook.NewSQLStore(conn, cfg.CaptainDir), nil
 }
 
-// VFS Models
-
-type FileRecord struct {
-	ID        string    `gorm:"primaryKey"`
-	Name      string    `gorm:"not null"`
-	ParentID  *string   `gorm:"index"`
-	IsDir     bool      `gorm:"not null"`
-	Color     string    `gorm:"default:''"`
-	CreatedAt time.Time `gorm:"autoCreateTime"`
-	UpdatedAt time.Time `gorm:"autoUpdateTime"`
-	Size      int64     `gorm:"default:0"`
-	Deleted   bool      `gorm:"default:false"`
+// newService opens the logbook for a command, running the user's hooks
+// before each change.
+func newService(cfg *Config) (*logbook.Service, error) {
+	store, err := openStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return hookedService(store), nil
 }
 
-type DirectoryState struct {
-	ID        uint   `gorm:"primaryKey"`
-	Path      string `gorm:"uniqueIndex;not null"`
-	SortBy    int    `gorm:"default:0"`
-	SortAsc   bool   `gorm:"default:true"`
-	CursorPos int    `gorm:"default:0"`
+// hookedService makes changes to store, running the user's hooks before each,
+// or after those made together in a transaction
+func hookedService(store logbook.Store) *logbook.Service {
+	svc := logbook.New(store)
+	svc.Before = runHooks
+	svc.After = ranHooks
+	return svc
 }
 
-type UserPreference struct {
-	ID    uint   `gorm:"primaryKey"`
-	Key   string `gorm:"uniqueIndex;not null"`
-	Value string
+// storeConn is the database under svc, for the tables the Store doesn't
+// know about: harvests and git links. In a transaction it's the
+// transaction's.
+func storeConn(svc *logbook.Service) (*gorm.DB, error) {
+	store, ok := svc.Store().(*logbook.SQLStore)
+	if !ok {
+		return nil, fmt.Errorf("the logbook isn't kept in a database")
+	}
+	return store.Conn(), nil
 }
 
-func OpenConn(cfg *Config) *gorm.DB {
-	dbPath := fmt.Sprintf("%s/%s", cfg.CaptainDir, cfg.DBFile)
-	conn, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Silent),
+// assignRecruiting gives a do to the crew named, recruiting anyone new as
+// adding a do for them does
+func assignRecruiting(svc *logbook.Service, id uint, names ...string) (Do, error) {
+	var do Do
+	err := svc.Transaction(func(tx *logbook.Service) error {
+		for _, name := range names {
+			if _, err := tx.Recruit(name); err != nil && !errors.Is(err, logbook.ErrExists) {
+				return err
+			}
+		}
+		var err error
+		do, err = tx.AssignAll(id, names...)
+		return err
 	})
-	if err != nil {
-		log.Fatalf("could not open database: %v", err)
-	}
+	return do, err
+}
 
-	err = conn.AutoMigrate(
-		&Do{}, &Tag{}, &DoTag{}, &DoDoc{}, &Template{},
-		&FileRecord{}, &DirectoryState{}, &UserPreference{},
-	)
+// parseID reads the id of a do from an argument. An argument that isn't a
+// number is a mistake, not a do that's missing.
+func parseID(arg string) (uint, error) {
+	id, err := strconv.ParseUint(arg, 10, 64)
 	if err != nil {
-		log.Fatalf("could not migrate database: %v", err)
+		return 0, &logbook.Error{Kind: logbook.ErrInvalid, Msg: fmt.Sprintf("'%s' is not a do id", arg), Err: err}
 	}
-
-	return conn
+	return uint(id), nil
 }
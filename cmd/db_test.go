@@ -1,11 +1,15 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"captain/logbook"
+
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -21,7 +25,7 @@ func setupTestDB(t *testing.T) (*gorm.DB, func()) {
 	}
 
 	err = conn.AutoMigrate(
-		&Do{}, &Tag{}, &DoTag{}, &DoDoc{}, &Template{},
+		&Do{}, &Tag{}, &DoTag{}, &DoDoc{}, &Template{}, &Harvest{}, &GitLink{},
 		&FileRecord{}, &DirectoryState{}, &UserPreference{},
 	)
 	if err != nil {
@@ -35,6 +39,29 @@ func setupTestDB(t *testing.T) (*gorm.DB, func()) {
 	return conn, cleanup
 }
 
+// testService makes changes to conn through a Service, running hooks from a
+// temporary captain directory
+func testService(t *testing.T, conn *gorm.DB) *logbook.Service {
+	original := cfg
+	cfg.CaptainDir = t.TempDir()
+	t.Cleanup(func() { cfg = original })
+
+	return hookedService(logbook.NewSQLStore(conn, cfg.CaptainDir))
+}
+
+// refuseWrites makes the database fail an insert or update of table when
+// the new row matches when, to test that a change is undone part way through
+func refuseWrites(t *testing.T, conn *gorm.DB, event, table, when string) {
+	t.Helper()
+	trigger := fmt.Sprintf(
+		"CREATE TRIGGER refuse_%s_%s BEFORE %s ON %s WHEN %s BEGIN SELECT RAISE(ABORT, 'refused'); END",
+		strings.ToLower(event), table, event, table, when,
+	)
+	if err := conn.Exec(trigger).Error; err != nil {
+		t.Fatalf("Failed to create trigger: %v", err)
+	}
+}
+
 func TestDoModel(t *testing.T) {
 	conn, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"captain/logbook"
+
+	"github.com/spf13/cobra"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the logbook for damage and inconsistencies",
+	Long: `Check the logbook with SQLite's integrity check and look for rows left
+inconsistent: crew assignments and docs of dos that are gone, dos with more
+than one doc, tags without a name and promoted dos whose file is gone.
+Dos promoted before their file was recorded are listed as warnings. With
+--fix the logbook is backed up and the problems repaired.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+		fix, _ := cmd.Flags().GetBool("fix")
+
+		conn, err := logbook.Open(dbPath(&cfg))
+		if err != nil {
+			return err
+		}
+		findings, err := logbook.Examine(conn, logbook.Checkups)
+		if err != nil {
+			return err
+		}
+		found := printFindings(out, findings)
+		if found == 0 {
+			fmt.Fprintln(out, "No problems found")
+			return nil
+		}
+		if !fix {
+			return fmt.Errorf("found %d problems, run `captain doctor --fix` to repair them", found)
+		}
+
+		backup := logbook.BackupPath(dbPath(&cfg), "pre-doctor", time.Now())
+		if err := logbook.Backup(conn, backup); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "\nBacked up to %s\n", backup)
+		if err := logbook.Repair(conn, findings); err != nil {
+			return err
+		}
+
+		findings, err = logbook.Examine(conn, logbook.Checkups)
+		if err != nil {
+			return err
+		}
+		left := 0
+		for _, finding := range findings {
+			if !finding.Warning {
+				left += len(finding.Problems)
+			}
+		}
+		fmt.Fprintf(out, "Fixed %d problems\n", found-left)
+		if left > 0 {
+			return fmt.Errorf("%d problems can't be fixed, consider `captain restore` from a backup", left)
+		}
+		return nil
+	},
+}
+
+// printFindings lists what each checkup found, returning how many problems
+// there were. Warnings are listed but not counted.
+func printFindings(out io.Writer, findings []logbook.Finding) int {
+	found := 0
+	for _, finding := range findings {
+		mark := "✗"
+		switch {
+		case len(finding.Problems) == 0:
+			fmt.Fprintf(out, "✓ %s\n", finding.Name)
+			continue
+		case finding.Warning:
+			mark = "!"
+		default:
+			found += len(finding.Problems)
+		}
+		fmt.Fprintf(out, "%s %s (%d)\n", mark, finding.Name, len(finding.Problems))
+		for _, problem := range finding.Problems {
+			fmt.Fprintf(out, "    %s\n", problem)
+		}
+	}
+	return found
+}
+
+func init() {
+	doctorCmd.Flags().Bool("fix", false, "Back up the logbook and repair what can be repaired")
+	RootCmd.AddCommand(doctorCmd)
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"captain/logbook"
+)
+
+func TestDoctorCommand(t *testing.T) {
+	out, err := runCaptain(t, nil, "doctor")
+	if err != nil || !strings.Contains(out, "No problems found") {
+		t.Fatalf("Expected a new logbook to be healthy, got %q, %v", out, err)
+	}
+
+	conn, err := logbook.Open(dbPath(&Config{CaptainDir: captainDirs[t], DBFile: cfg.DBFile}))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	conn.Create(&DoDoc{DoID: 42, Text: "Left behind"})
+
+	out, err = runCaptain(t, nil, "doctor")
+	if err == nil || !strings.Contains(out, "✗ docs of missing dos (1)") {
+		t.Errorf("Expected the doc of a missing do reported, got %q, %v", out, err)
+	}
+
+	out, err = runCaptain(t, nil, "doctor", "--fix")
+	if err != nil || !strings.Contains(out, "Backed up to") || !strings.Contains(out, "Fixed 1 problems") {
+		t.Errorf("Expected the logbook backed up and fixed, got %q, %v", out, err)
+	}
+	if out, err := runCaptain(t, nil, "doctor"); err != nil {
+		t.Errorf("Expected no problems after fixing, got %q, %v", out, err)
+	}
+
+	// A do promoted before files were recorded is a warning, not a problem
+	conn.Create(&Do{Description: "Promoted long ago", Type: Task, Promoted: true})
+	out, err = runCaptain(t, nil, "doctor")
+	if err != nil || !strings.Contains(out, "! promoted dos that can't be checked (1)") || !strings.Contains(out, "No problems found") {
+		t.Errorf("Expected the old promotion as a warning, got %q, %v", out, err)
+	}
+}
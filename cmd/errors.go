@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"errors"
+
+	"captain/logbook"
+
+	"github.com/spf13/cobra"
+)
+
+// Exit codes, by the kind of error a command failed with
+const (
+	exitOK        = 0
+	exitFailure   = 1 // anything not below
+	exitInvalid   = 2 // a bad argument, flag or command
+	exitNotFound  = 3
+	exitExists    = 4
+	exitCancelled = 5 // by a hook or declined when asked
+	exitStorage   = 6
+)
+
+func invalidf(format string, args ...any) error {
+	return logbook.Errorf(logbook.ErrInvalid, format, args...)
+}
+
+func notFoundf(format string, args ...any) error {
+	return logbook.Errorf(logbook.ErrNotFound, format, args...)
+}
+
+func existsf(format string, args ...any) error {
+	return logbook.Errorf(logbook.ErrExists, format, args...)
+}
+
+// declined is the error for a change turned down when asked to confirm it
+func declined(what string) error {
+	return logbook.Errorf(logbook.ErrCancelled, "%s cancelled", what)
+}
+
+// execute runs root, telling arguments and flags that cobra turned down
+// apart from commands that failed.
+func execute(root *cobra.Command) error {
+	cmd, err := root.ExecuteC()
+	if err != nil && !cmd.SilenceUsage && !errors.As(err, new(*logbook.Error)) {
+		// The command never ran, see RootCmd's PersistentPreRunE
+		return &logbook.Error{Kind: logbook.ErrInvalid, Msg: err.Error(), Err: err}
+	}
+	return err
+}
+
+// ExitCode is the exit status for an error returned by Execute
+func ExitCode(err error) int {
+	var plugin *pluginExit
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &plugin):
+		return plugin.code
+	case errors.Is(err, logbook.ErrInvalid):
+		return exitInvalid
+	case errors.Is(err, logbook.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, logbook.ErrExists):
+		return exitExists
+	case errors.Is(err, logbook.ErrCancelled):
+		return exitCancelled
+	case errors.Is(err, logbook.ErrStorage):
+		return exitStorage
+	}
+	return exitFailure
+}
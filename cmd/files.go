@@ -11,14 +11,22 @@ import (
 var filesCmd = &cobra.Command{
 	Use:   "files",
 	Short: "Browse promoted .do files in VFS (interactive)",
-	Run: func(cmd *cobra.Command, args []string) {
-		conn := OpenConn(&cfg)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+		conn, err := storeConn(svc)
+		if err != nil {
+			return err
+		}
 		filesDir := filepath.Join(cfg.CaptainDir, "files")
 
 		// Launch the VFS browser with captain's database
 		if err := browser.RunBrowser(conn, filesDir); err != nil {
-			fmt.Printf("Error running browser: %v\n", err)
+			return fmt.Errorf("could not run browser: %w", err)
 		}
+		return nil
 	},
 }
 
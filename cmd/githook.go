@@ -0,0 +1,288 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"captain/logbook"
+
+	"github.com/spf13/cobra"
+)
+
+// gitHookMarker identifies hooks captain installed, so they can be replaced
+const gitHookMarker = "# installed by captain"
+
+var (
+	trailerRegex  = regexp.MustCompile(`^([A-Za-z][\w-]*):\s*(.+)$`)
+	captainRegex  = regexp.MustCompile(`(?i)^(?:(did|done|ref|refs)\s+)?((?:cap)?#?\d+(?:\s*,\s*(?:cap)?#?\d+)*)$`)
+	capRefRegex   = regexp.MustCompile(`(?i)\bcap#(\d+)\b`)
+	commitIDRegex = regexp.MustCompile(`\d+`)
+)
+
+// commitRef is a do mentioned in a commit message trailer
+type commitRef struct {
+	DoID uint
+	Done bool
+}
+
+// commitTrailers returns the key, value pairs in the last paragraph of a
+// commit message. A message with only a subject has no trailers.
+func commitTrailers(message string) [][2]string {
+	paragraphs := strings.Split(strings.TrimSpace(strings.ReplaceAll(message, "\r\n", "\n")), "\n\n")
+	if len(paragraphs) < 2 {
+		return nil
+	}
+
+	var trailers [][2]string
+	for _, line := range strings.Split(paragraphs[len(paragraphs)-1], "\n") {
+		if m := trailerRegex.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			trailers = append(trailers, [2]string{m[1], strings.TrimSpace(m[2])})
+		}
+	}
+	return trailers
+}
+
+// parseCommitRefs finds `Captain: did 42` and `Refs: cap#42` trailers. A
+// do mentioned more than once is done if any trailer says so.
+func parseCommitRefs(message string) []commitRef {
+	var refs []commitRef
+	index := map[uint]int{}
+
+	add := func(id string, done bool) {
+		n, err := strconv.ParseUint(id, 10, 64)
+		if err != nil || n == 0 {
+			return
+		}
+		doID := uint(n)
+		if i, ok := index[doID]; ok {
+			refs[i].Done = refs[i].Done || done
+			return
+		}
+		index[doID] = len(refs)
+		refs = append(refs, commitRef{DoID: doID, Done: done})
+	}
+
+	for _, trailer := range commitTrailers(message) {
+		switch strings.ToLower(trailer[0]) {
+		case "captain":
+			m := captainRegex.FindStringSubmatch(trailer[1])
+			if m == nil {
+				continue
+			}
+			verb := strings.ToLower(m[1])
+			for _, id := range commitIDRegex.FindAllString(m[2], -1) {
+				add(id, verb == "did" || verb == "done")
+			}
+		case "refs":
+			for _, m := range capRefRegex.FindAllStringSubmatch(trailer[1], -1) {
+				add(m[1], false)
+			}
+		}
+	}
+	return refs
+}
+
+// commitMessage reads the message of a commit object
+func commitMessage(repo *gitRepo, hash string) (string, error) {
+	objType, data, err := repo.readObject(hash)
+	if err != nil {
+		return "", err
+	}
+	if objType != "commit" {
+		return "", fmt.Errorf("%s is a %s, not a commit", hash, objType)
+	}
+	_, message, _ := strings.Cut(string(data), "\n\n")
+	return message, nil
+}
+
+// appendDoc adds a line to the end of a do's doc, creating it if needed
+func appendDoc(svc *logbook.Service, do Do, line string) error {
+	text := do.Doc.Text
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	_, err := svc.SetDoc(do.ID, text+line+"\n")
+	return err
+}
+
+// applyCommit records a commit against the dos its trailers mention and
+// completes those it says are done, telling w about any it can't find.
+func applyCommit(w io.Writer, svc *logbook.Service, hash, message string) ([]commitRef, error) {
+	subject, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	short := hash
+	if len(short) > 7 {
+		short = short[:7]
+	}
+
+	var applied []commitRef
+	for _, ref := range parseCommitRefs(message) {
+		do, err := svc.Get(ref.DoID)
+		if errors.Is(err, logbook.ErrNotFound) {
+			fmt.Fprintf(w, "captain: no do under %d\n", ref.DoID)
+			continue
+		} else if err != nil {
+			return applied, err
+		}
+
+		// The commit is noted and the do completed together
+		err = svc.Transaction(func(tx *logbook.Service) error {
+			if err := appendDoc(tx, do, fmt.Sprintf("- `%s` %s", short, subject)); err != nil {
+				return fmt.Errorf("could not update doc for %d: %w", do.ID, err)
+			}
+
+			if ref.Done {
+				if _, err := tx.Complete(do.ID); err != nil {
+					return fmt.Errorf("could not complete %d: %w", do.ID, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return applied, err
+		}
+		applied = append(applied, ref)
+	}
+	return applied, nil
+}
+
+// gitHookScript calls back into this binary after each commit, with the
+// config, profile and logbook in use when it was installed. It never fails,
+// a commit shouldn't be held up by the logbook.
+func gitHookScript(executable string, cfg *Config) string {
+	command := []string{
+		"CAPTAIN_DIR=" + shellQuote(cfg.CaptainDir),
+		"CAPTAIN_DB=" + shellQuote(cfg.DBFile),
+		shellQuote(executable),
+	}
+	if cfg.ConfigFile != "" {
+		command = append(command, "--config", shellQuote(cfg.ConfigFile))
+	}
+	if cfg.Profile != "" {
+		command = append(command, "--profile", shellQuote(cfg.Profile))
+	}
+	command = append(command, "hook", "post-commit")
+	return fmt.Sprintf("#!/bin/sh\n%s\n%s || true\n", gitHookMarker, strings.Join(command, " "))
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// installGitHook writes the post-commit hook where git will run it,
+// refusing to replace a hook captain didn't install unless forced.
+func installGitHook(repo *gitRepo, executable string, cfg *Config, force bool) (string, error) {
+	dir := repo.hooksDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, "post-commit")
+	if existing, err := os.ReadFile(path); err == nil && !force && !strings.Contains(string(existing), gitHookMarker) {
+		return path, fmt.Errorf("%s already exists, pass --force to replace it", path)
+	}
+	return path, os.WriteFile(path, []byte(gitHookScript(executable, cfg)), 0o755)
+}
+
+var hookCmd = &cobra.Command{
+	Use:   "hook",
+	Short: "Update dos from git commits",
+}
+
+var hookInstallGitCmd = &cobra.Command{
+	Use:   "install-git [repo] --force",
+	Short: "Install a post-commit hook that updates dos from commit trailers",
+	Long: `Install a post-commit hook in a local repository. After each commit, trailers
+in the commit message update the dos they mention:
+
+  Captain: did 42      completes do 42
+  Captain: 42, 43      notes the commit on dos 42 and 43
+  Refs: cap#42         notes the commit on do 42
+
+The commit hash and subject are appended to each do's doc. The hook updates the
+logbook of the config and profile in use when it's installed, and goes in
+core.hooksPath when git is set up to look for hooks there.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		force, _ := cmd.Flags().GetBool("force")
+
+		path := "."
+		if len(args) > 0 {
+			path = args[0]
+		}
+
+		repo, err := openGitRepo(path)
+		if err != nil {
+			return fmt.Errorf("could not open repository: %w", err)
+		}
+
+		executable, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("could not find the captain binary: %w", err)
+		}
+
+		hook, err := installGitHook(repo, executable, &cfg, force)
+		if err != nil {
+			return fmt.Errorf("could not install hook: %w", err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Installed %s\n", hook)
+		return nil
+	},
+}
+
+var hookPostCommitCmd = &cobra.Command{
+	Use:    "post-commit",
+	Short:  "Apply the trailers of the last commit, run by the git hook",
+	Hidden: true,
+	Args:   cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, err := openGitRepo(".")
+		if err != nil {
+			return err
+		}
+
+		hash, err := repo.readRef("HEAD")
+		if err != nil {
+			return fmt.Errorf("could not read HEAD: %w", err)
+		}
+
+		message, err := commitMessage(repo, hash)
+		if err != nil {
+			return fmt.Errorf("could not read commit: %w", err)
+		}
+		if len(parseCommitRefs(message)) == 0 {
+			return nil
+		}
+
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		applied, err := applyCommit(out, svc, hash, message)
+		if err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "captain: %v\n", err)
+		}
+		for _, ref := range applied {
+			if ref.Done {
+				fmt.Fprintf(out, "captain: marked %d as done\n", ref.DoID)
+			} else {
+				fmt.Fprintf(out, "captain: noted commit on %d\n", ref.DoID)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	hookInstallGitCmd.Flags().Bool("force", false, "Replace an existing post-commit hook")
+
+	hookCmd.AddCommand(hookInstallGitCmd, hookPostCommitCmd)
+	RootCmd.AddCommand(hookCmd)
+}
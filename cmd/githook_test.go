@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCommitRefs(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		expected []commitRef
+	}{
+		{
+			name:     "did",
+			message:  "Fix the parser\n\nCaptain: did 42\n",
+			expected: []commitRef{{DoID: 42, Done: true}},
+		},
+		{
+			name:     "several refs",
+			message:  "Fix the parser\n\nLonger description.\n\nRefs: cap#7, cap#9\nSigned-off-by: A <a@example.com>\n",
+			expected: []commitRef{{DoID: 7}, {DoID: 9}},
+		},
+		{
+			name:     "mention then did",
+			message:  "Fix\n\nCaptain: 3, #4\nCaptain: done 3",
+			expected: []commitRef{{DoID: 3, Done: true}, {DoID: 4}},
+		},
+		{
+			name:     "subject only",
+			message:  "Captain: did 42",
+			expected: nil,
+		},
+		{
+			name:     "not in the last paragraph",
+			message:  "Fix\n\nCaptain: did 42\n\nBody text",
+			expected: nil,
+		},
+		{
+			name:     "unknown verb",
+			message:  "Fix\n\nCaptain: scratch 42",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refs := parseCommitRefs(tt.message)
+			if len(refs) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, refs)
+			}
+			for i := range refs {
+				if refs[i] != tt.expected[i] {
+					t.Errorf("Expected %v, got %v", tt.expected[i], refs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestApplyCommit(t *testing.T) {
+	conn, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	done := Do{Description: "Fix the parser", Type: PR, Priority: Medium}
+	noted := Do{Description: "Parser follow ups", Type: Task, Priority: Low}
+	conn.Create(&done)
+	conn.Create(&noted)
+	conn.Create(&DoDoc{DoID: noted.ID, Text: "Existing notes"})
+
+	message := "Fix the parser\n\nCaptain: did 1\nRefs: cap#2, cap#99\n"
+	out := &bytes.Buffer{}
+	applied, err := applyCommit(out, testService(t, conn), "0123456789abcdef0123456789abcdef01234567", message)
+	if err != nil {
+		t.Fatalf("Failed to apply commit: %v", err)
+	}
+	if len(applied) != 2 {
+		t.Fatalf("Expected 2 dos updated, got %v", applied)
+	}
+	if out.String() != "captain: no do under 99\n" {
+		t.Errorf("Expected the missing do to be reported, got %q", out.String())
+	}
+
+	var fetched Do
+	conn.Preload("Doc").First(&fetched, done.ID)
+	if !fetched.Completed || fetched.CompletedAt == nil {
+		t.Error("Expected the do to be completed")
+	}
+	if fetched.Doc.Text != "- `0123456` Fix the parser\n" {
+		t.Errorf("Unexpected doc %q", fetched.Doc.Text)
+	}
+
+	var other Do
+	conn.Preload("Doc").First(&other, noted.ID)
+	if other.Completed {
+		t.Error("Expected a referenced do to stay open")
+	}
+	if other.Doc.Text != "Existing notes\n- `0123456` Fix the parser\n" {
+		t.Errorf("Unexpected doc %q", other.Doc.Text)
+	}
+}
+
+func TestApplyCommitIsUndoneOnFailure(t *testing.T) {
+	conn, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	do := Do{Description: "Fix the parser", Type: PR, Priority: Medium}
+	conn.Create(&do)
+	refuseWrites(t, conn, "UPDATE", "dos", "NEW.completed")
+
+	if _, err := applyCommit(io.Discard, testService(t, conn), "0123456789abcdef", "Fix the parser\n\nCaptain: did 1\n"); err == nil {
+		t.Fatal("Expected the commit to fail")
+	}
+	var docs int64
+	conn.Model(&DoDoc{}).Count(&docs)
+	if docs != 0 {
+		t.Errorf("Expected the commit not to be noted when the do couldn't be completed")
+	}
+}
+
+func TestInstallGitHook(t *testing.T) {
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(t.TempDir(), "gitconfig"))
+	f := newGitFixture(t)
+	f.commit("main.txt", "Fix the parser\n\nCaptain: did 5")
+
+	repo, err := openGitRepo(f.dir)
+	if err != nil {
+		t.Fatalf("Failed to open repo: %v", err)
+	}
+
+	head, _ := repo.readRef("HEAD")
+	message, err := commitMessage(repo, head)
+	if err != nil {
+		t.Fatalf("Failed to read commit: %v", err)
+	}
+	if refs := parseCommitRefs(message); len(refs) != 1 || refs[0] != (commitRef{DoID: 5, Done: true}) {
+		t.Errorf("Expected the trailer to be read from the commit, got %v", refs)
+	}
+
+	hookCfg := Config{CaptainDir: "/home/me/.captain", DBFile: "work.db", ConfigFile: "/home/me/.config/captain/config.ini", Profile: "work"}
+	path, err := installGitHook(repo, "/usr/local/bin/captain", &hookCfg, false)
+	if err != nil {
+		t.Fatalf("Failed to install: %v", err)
+	}
+	if path != filepath.Join(repo.common, "hooks", "post-commit") {
+		t.Errorf("Expected the hook in .git/hooks, got %s", path)
+	}
+	script, _ := os.ReadFile(path)
+	expected := "CAPTAIN_DIR='/home/me/.captain' CAPTAIN_DB='work.db' '/usr/local/bin/captain' " +
+		"--config '/home/me/.config/captain/config.ini' --profile 'work' hook post-commit"
+	if !strings.Contains(string(script), expected) {
+		t.Errorf("Expected the hook to keep the logbook it was installed with, got %q", script)
+	}
+
+	// Reinstalling our own hook is fine, replacing someone else's isn't
+	if _, err := installGitHook(repo, "/usr/local/bin/captain", &hookCfg, false); err != nil {
+		t.Errorf("Expected to replace our own hook, got %v", err)
+	}
+	os.WriteFile(filepath.Join(filepath.Dir(path), "post-commit"), []byte("#!/bin/sh\nlint\n"), 0o755)
+	if _, err := installGitHook(repo, "/usr/local/bin/captain", &hookCfg, false); err == nil {
+		t.Error("Expected an existing hook to be kept")
+	}
+	if _, err := installGitHook(repo, "/usr/local/bin/captain", &hookCfg, true); err != nil {
+		t.Errorf("Expected --force to replace the hook, got %v", err)
+	}
+}
+
+func TestInstallGitHookInHooksPath(t *testing.T) {
+	global := filepath.Join(t.TempDir(), "gitconfig")
+	t.Setenv("GIT_CONFIG_GLOBAL", global)
+	f := newGitFixture(t)
+
+	repo, err := openGitRepo(f.dir)
+	if err != nil {
+		t.Fatalf("Failed to open repo: %v", err)
+	}
+
+	os.WriteFile(global, []byte("[core]\n\thooksPath = /shared/hooks\n"), 0o644)
+	if dir := repo.hooksDir(); dir != "/shared/hooks" {
+		t.Errorf("Expected the user's hooksPath, got %s", dir)
+	}
+
+	f.git("config", "core.hooksPath", ".githooks")
+	path, err := installGitHook(repo, "/usr/local/bin/captain", &Config{}, false)
+	if err != nil {
+		t.Fatalf("Failed to install: %v", err)
+	}
+	if path != filepath.Join(f.dir, ".githooks", "post-commit") {
+		t.Errorf("Expected the hook in the repository's hooksPath, got %s", path)
+	}
+}
+
+func TestApplyCommitFiresOnComplete(t *testing.T) {
+	conn, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	conn.Create(&Do{Description: "Fix the parser", Type: PR, Priority: Medium})
+	conn.Create(&Do{Description: "Parser follow ups", Type: Task, Priority: Low})
+	svc := testService(t, conn)
+
+	dir := hooksDir(&cfg)
+	os.MkdirAll(dir, 0o755)
+	fired := filepath.Join(t.TempDir(), "fired")
+	writeHook(t, dir, onComplete, `echo "$CAPTAIN_DO_ID" >> "`+fired+`"`)
+
+	if _, err := applyCommit(io.Discard, svc, "0123456789abcdef", "Fix the parser\n\nCaptain: did 1\nRefs: cap#2\n"); err != nil {
+		t.Fatalf("Failed to apply commit: %v", err)
+	}
+	if got, _ := os.ReadFile(fired); string(got) != "1\n" {
+		t.Errorf("Expected on-complete to fire for the done do only, got %q", got)
+	}
+}
@@ -0,0 +1,557 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+var (
+	errGitRefNotFound    = errors.New("ref not found")
+	errGitObjectNotFound = errors.New("object not found")
+)
+
+// gitRepo reads refs and commits straight out of a repository's .git
+// directory, so PR dos can be synced offline and without git installed.
+type gitRepo struct {
+	Root   string // the work tree
+	dir    string // the .git directory
+	common string // where refs and objects live, differs for worktrees
+
+	packs   []*gitPack
+	loaded  bool
+	parents map[string][]string
+}
+
+// openGitRepo finds the repository containing path
+func openGitRepo(path string) (*gitRepo, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for dir := path; ; dir = filepath.Dir(dir) {
+		dotGit := filepath.Join(dir, ".git")
+		info, err := os.Stat(dotGit)
+		if err == nil {
+			repo := &gitRepo{Root: dir, dir: dotGit, parents: map[string][]string{}}
+
+			// Worktrees and submodules have a file pointing at the real one
+			if !info.IsDir() {
+				content, err := os.ReadFile(dotGit)
+				if err != nil {
+					return nil, err
+				}
+				target, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "gitdir:")
+				if !ok {
+					return nil, fmt.Errorf("%s is not a git directory", dotGit)
+				}
+				repo.dir = strings.TrimSpace(target)
+				if !filepath.IsAbs(repo.dir) {
+					repo.dir = filepath.Join(dir, repo.dir)
+				}
+			}
+
+			repo.common = repo.dir
+			if content, err := os.ReadFile(filepath.Join(repo.dir, "commondir")); err == nil {
+				repo.common = strings.TrimSpace(string(content))
+				if !filepath.IsAbs(repo.common) {
+					repo.common = filepath.Join(repo.dir, repo.common)
+				}
+			}
+			return repo, nil
+		}
+
+		if dir == filepath.Dir(dir) {
+			return nil, fmt.Errorf("no git repository at '%s'", path)
+		}
+	}
+}
+
+// hooksDir is where git looks for the repository's hooks: core.hooksPath
+// when it's set in the repository's or the user's git config, otherwise the
+// hooks directory of .git.
+func (r *gitRepo) hooksDir() string {
+	configs := []string{filepath.Join(r.common, "config")}
+	if global := os.Getenv("GIT_CONFIG_GLOBAL"); global != "" {
+		configs = append(configs, global)
+	} else if home, err := os.UserHomeDir(); err == nil {
+		configHome := os.Getenv("XDG_CONFIG_HOME")
+		if configHome == "" {
+			configHome = filepath.Join(home, ".config")
+		}
+		configs = append(configs, filepath.Join(home, ".gitconfig"), filepath.Join(configHome, "git", "config"))
+	}
+
+	// The repository's config wins over the user's
+	for _, path := range configs {
+		file, err := ini.LoadSources(ini.LoadOptions{Loose: true, Insensitive: true}, path)
+		if err != nil {
+			continue
+		}
+		hooksPath := file.Section("core").Key("hookspath").String()
+		if hooksPath == "" {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(hooksPath, "~/"); ok {
+			if home, err := os.UserHomeDir(); err == nil {
+				hooksPath = filepath.Join(home, rest)
+			}
+		}
+		if !filepath.IsAbs(hooksPath) {
+			hooksPath = filepath.Join(r.Root, hooksPath)
+		}
+		return hooksPath
+	}
+	return filepath.Join(r.common, "hooks")
+}
+
+// readRef resolves a ref such as HEAD or refs/heads/main to a commit hash
+func (r *gitRepo) readRef(name string) (string, error) {
+	for depth := 0; depth < 10; depth++ {
+		value, err := r.rawRef(name)
+		if err != nil {
+			return "", err
+		}
+		target, symbolic := strings.CutPrefix(value, "ref: ")
+		if !symbolic {
+			return value, nil
+		}
+		name = strings.TrimSpace(target)
+	}
+	return "", fmt.Errorf("too many levels of symbolic refs for %s", name)
+}
+
+// rawRef reads a ref without following it when it's symbolic
+func (r *gitRepo) rawRef(name string) (string, error) {
+	// HEAD is per worktree, everything else is shared
+	for _, dir := range []string{r.dir, r.common} {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err == nil {
+			return strings.TrimSpace(string(content)), nil
+		}
+	}
+
+	file, err := os.Open(filepath.Join(r.common, "packed-refs"))
+	if err != nil {
+		return "", errGitRefNotFound
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "^") {
+			continue
+		}
+		hash, ref, ok := strings.Cut(line, " ")
+		if ok && ref == name {
+			return hash, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errGitRefNotFound
+}
+
+// currentBranch is the branch HEAD points at, or "" when detached
+func (r *gitRepo) currentBranch() string {
+	head, err := r.rawRef("HEAD")
+	if err != nil {
+		return ""
+	}
+	ref, _ := strings.CutPrefix(head, "ref: ")
+	branch, ok := strings.CutPrefix(ref, "refs/heads/")
+	if !ok {
+		return ""
+	}
+	return branch
+}
+
+// readObject returns the type and content of an object
+func (r *gitRepo) readObject(hash string) (string, []byte, error) {
+	if len(hash) != 40 {
+		return "", nil, fmt.Errorf("bad object id '%s'", hash)
+	}
+
+	path := filepath.Join(r.common, "objects", hash[:2], hash[2:])
+	if file, err := os.Open(path); err == nil {
+		defer file.Close()
+		return readLooseObject(file)
+	}
+
+	if err := r.loadPacks(); err != nil {
+		return "", nil, err
+	}
+	raw, err := hex.DecodeString(hash)
+	if err != nil {
+		return "", nil, fmt.Errorf("bad object id '%s'", hash)
+	}
+	for _, pack := range r.packs {
+		if offset, ok := pack.find(raw); ok {
+			return pack.read(r, offset)
+		}
+	}
+	return "", nil, errGitObjectNotFound
+}
+
+func readLooseObject(r io.Reader) (string, []byte, error) {
+	z, err := zlib.NewReader(r)
+	if err != nil {
+		return "", nil, err
+	}
+	defer z.Close()
+
+	content, err := io.ReadAll(z)
+	if err != nil {
+		return "", nil, err
+	}
+	header, data, ok := bytes.Cut(content, []byte{0})
+	if !ok {
+		return "", nil, errors.New("bad object header")
+	}
+	objType, _, _ := strings.Cut(string(header), " ")
+	return objType, data, nil
+}
+
+func (r *gitRepo) loadPacks() error {
+	if r.loaded {
+		return nil
+	}
+	r.loaded = true
+
+	indexes, err := filepath.Glob(filepath.Join(r.common, "objects", "pack", "*.idx"))
+	if err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		pack, err := openGitPack(index)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(index), err)
+		}
+		r.packs = append(r.packs, pack)
+	}
+	return nil
+}
+
+// commitParents returns the parents of a commit
+func (r *gitRepo) commitParents(hash string) ([]string, error) {
+	if parents, ok := r.parents[hash]; ok {
+		return parents, nil
+	}
+
+	objType, data, err := r.readObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if objType != "commit" {
+		return nil, fmt.Errorf("%s is a %s, not a commit", hash, objType)
+	}
+
+	var parents []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			break
+		}
+		if parent, ok := strings.CutPrefix(line, "parent "); ok {
+			parents = append(parents, parent)
+		}
+	}
+	r.parents[hash] = parents
+	return parents, nil
+}
+
+// walk visits every commit reachable from tips, skipping those in stop and
+// the history missing from a shallow clone.
+func (r *gitRepo) walk(tips []string, stop map[string]bool, visit func(hash string)) error {
+	seen := map[string]bool{}
+	queue := append([]string{}, tips...)
+
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if seen[hash] || stop[hash] {
+			continue
+		}
+		seen[hash] = true
+
+		parents, err := r.commitParents(hash)
+		if errors.Is(err, errGitObjectNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		visit(hash)
+		queue = append(queue, parents...)
+	}
+	return nil
+}
+
+// reachable returns every commit reachable from tips
+func (r *gitRepo) reachable(tips ...string) (map[string]bool, error) {
+	found := map[string]bool{}
+	err := r.walk(tips, nil, func(hash string) { found[hash] = true })
+	return found, err
+}
+
+// ahead counts the commits reachable from head but not from base
+func (r *gitRepo) ahead(head string, base map[string]bool) (int, error) {
+	count := 0
+	err := r.walk([]string{head}, base, func(string) { count++ })
+	return count, err
+}
+
+// gitPack is a packfile along with its version 2 index
+type gitPack struct {
+	path    string
+	fanout  [256]uint32
+	names   []byte
+	offsets []byte
+	large   []byte
+}
+
+func openGitPack(index string) (*gitPack, error) {
+	idx, err := os.ReadFile(index)
+	if err != nil {
+		return nil, err
+	}
+	if len(idx) < 8+256*4 || !bytes.Equal(idx[:4], []byte{0xff, 't', 'O', 'c'}) || binary.BigEndian.Uint32(idx[4:8]) != 2 {
+		return nil, errors.New("unsupported pack index")
+	}
+
+	pack := &gitPack{path: strings.TrimSuffix(index, ".idx") + ".pack"}
+	for i := range pack.fanout {
+		pack.fanout[i] = binary.BigEndian.Uint32(idx[8+i*4:])
+	}
+
+	count := int(pack.fanout[255])
+	names := 8 + 256*4
+	crcs := names + count*20
+	offsets := crcs + count*4
+	large := offsets + count*4
+	if len(idx) < large {
+		return nil, errors.New("truncated pack index")
+	}
+
+	pack.names = idx[names:crcs]
+	pack.offsets = idx[offsets:large]
+	pack.large = idx[large:]
+	return pack, nil
+}
+
+// find looks up the offset of an object in the pack
+func (p *gitPack) find(hash []byte) (int64, bool) {
+	lo := 0
+	if hash[0] > 0 {
+		lo = int(p.fanout[hash[0]-1])
+	}
+	hi := int(p.fanout[hash[0]])
+
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(p.names[(lo+i)*20:(lo+i+1)*20], hash) >= 0
+	})
+	if i >= hi || !bytes.Equal(p.names[i*20:(i+1)*20], hash) {
+		return 0, false
+	}
+
+	offset := binary.BigEndian.Uint32(p.offsets[i*4:])
+	if offset&0x80000000 == 0 {
+		return int64(offset), true
+	}
+	at := int(offset&0x7fffffff) * 8
+	if at+8 > len(p.large) {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint64(p.large[at:])), true
+}
+
+var gitPackTypes = map[byte]string{1: "commit", 2: "tree", 3: "blob", 4: "tag"}
+
+const (
+	gitOfsDelta = 6
+	gitRefDelta = 7
+)
+
+// read returns the object at offset, applying any deltas
+func (p *gitPack) read(repo *gitRepo, offset int64) (string, []byte, error) {
+	file, err := os.Open(p.path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+	return p.readAt(repo, file, offset, 0)
+}
+
+func (p *gitPack) readAt(repo *gitRepo, file *os.File, offset int64, depth int) (string, []byte, error) {
+	if depth > 50 {
+		return "", nil, errors.New("delta chain too long")
+	}
+
+	header := make([]byte, 32)
+	n, err := file.ReadAt(header, offset)
+	if n == 0 && err != nil {
+		return "", nil, err
+	}
+	header = header[:n]
+
+	pos := 0
+	next := func() (byte, error) {
+		if pos >= len(header) {
+			return 0, errors.New("truncated pack entry")
+		}
+		c := header[pos]
+		pos++
+		return c, nil
+	}
+
+	c, err := next()
+	if err != nil {
+		return "", nil, err
+	}
+	objType := (c >> 4) & 7
+	for c&0x80 != 0 {
+		if c, err = next(); err != nil {
+			return "", nil, err
+		}
+	}
+
+	var baseType string
+	var base []byte
+	switch objType {
+	case gitOfsDelta:
+		if c, err = next(); err != nil {
+			return "", nil, err
+		}
+		back := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			if c, err = next(); err != nil {
+				return "", nil, err
+			}
+			back = ((back + 1) << 7) | int64(c&0x7f)
+		}
+		baseType, base, err = p.readAt(repo, file, offset-back, depth+1)
+	case gitRefDelta:
+		if pos+20 > len(header) {
+			return "", nil, errors.New("truncated pack entry")
+		}
+		baseHash := hex.EncodeToString(header[pos : pos+20])
+		pos += 20
+		baseType, base, err = repo.readObject(baseHash)
+	default:
+		if _, ok := gitPackTypes[objType]; !ok {
+			return "", nil, fmt.Errorf("unknown pack object type %d", objType)
+		}
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	z, err := zlib.NewReader(io.NewSectionReader(file, offset+int64(pos), 1<<62))
+	if err != nil {
+		return "", nil, err
+	}
+	defer z.Close()
+	data, err := io.ReadAll(z)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if base == nil {
+		return gitPackTypes[objType], data, nil
+	}
+	data, err = applyGitDelta(base, data)
+	return baseType, data, err
+}
+
+// applyGitDelta rebuilds an object from its base and a delta
+func applyGitDelta(base, delta []byte) ([]byte, error) {
+	errBad := errors.New("bad delta")
+
+	pos := 0
+	size := func() (int, error) {
+		n, shift := 0, 0
+		for {
+			if pos >= len(delta) {
+				return 0, errBad
+			}
+			c := delta[pos]
+			pos++
+			n |= int(c&0x7f) << shift
+			shift += 7
+			if c&0x80 == 0 {
+				return n, nil
+			}
+		}
+	}
+
+	baseSize, err := size()
+	if err != nil || baseSize != len(base) {
+		return nil, errBad
+	}
+	resultSize, err := size()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, 0, resultSize)
+	for pos < len(delta) {
+		op := delta[pos]
+		pos++
+
+		switch {
+		case op&0x80 != 0:
+			var from, n int
+			for i := 0; i < 4; i++ {
+				if op&(1<<i) != 0 {
+					if pos >= len(delta) {
+						return nil, errBad
+					}
+					from |= int(delta[pos]) << (8 * i)
+					pos++
+				}
+			}
+			for i := 0; i < 3; i++ {
+				if op&(1<<(4+i)) != 0 {
+					if pos >= len(delta) {
+						return nil, errBad
+					}
+					n |= int(delta[pos]) << (8 * i)
+					pos++
+				}
+			}
+			if n == 0 {
+				n = 0x10000
+			}
+			if from+n > len(base) {
+				return nil, errBad
+			}
+			result = append(result, base[from:from+n]...)
+		case op != 0:
+			if pos+int(op) > len(delta) {
+				return nil, errBad
+			}
+			result = append(result, delta[pos:pos+int(op)]...)
+			pos += int(op)
+		default:
+			return nil, errBad
+		}
+	}
+
+	if len(result) != resultSize {
+		return nil, errBad
+	}
+	return result, nil
+}
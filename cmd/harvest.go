@@ -0,0 +1,486 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"captain/logbook"
+
+	"github.com/fatih/color"
+	sebtable "github.com/s3bw/table"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var markerRegex = regexp.MustCompile(`\b(TODO|ASK|TELL)(?:\(([^)]*)\))?:\s*(.+)$`)
+
+// harvestNearby is how many lines a marker can move while being edited and
+// still be treated as the same marker.
+const harvestNearby = 3
+
+// marker is a TODO:, ASK(name): or TELL(name): found in a notes file
+type marker struct {
+	Path string
+	Line int
+	Type DoType
+	Name string
+	Text string
+}
+
+// Key identifies a marker by what it says rather than where it is
+func (m marker) Key() string {
+	return fmt.Sprintf("%s|%s|%s", m.Type, m.Name, m.Text)
+}
+
+func parseMarkers(path string, r io.Reader) ([]marker, error) {
+	var markers []marker
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		m := markerRegex.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+
+		text := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(m[3]), "-->"))
+		if text == "" {
+			continue
+		}
+
+		doType := Task
+		switch m[1] {
+		case "ASK":
+			doType = Ask
+		case "TELL":
+			doType = Tell
+		}
+
+		markers = append(markers, marker{
+			Path: path,
+			Line: line,
+			Type: doType,
+			Name: strings.TrimSpace(m[2]),
+			Text: text,
+		})
+	}
+	return markers, scanner.Err()
+}
+
+// scanMarkers walks root for files with one of exts, skipping hidden
+// directories, and returns their markers.
+func scanMarkers(root string, exts []string) ([]marker, error) {
+	var markers []marker
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		matched := false
+		for _, ext := range exts {
+			if strings.EqualFold(filepath.Ext(path), "."+strings.TrimPrefix(ext, ".")) {
+				matched = true
+			}
+		}
+		if !matched {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		found, err := parseMarkers(path, file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		markers = append(markers, found...)
+		return nil
+	})
+
+	return markers, err
+}
+
+type harvestMatch struct {
+	Marker  marker
+	Harvest Harvest
+}
+
+// harvestPlan is what a harvest would do to bring the dos in line with the
+// markers in the notes.
+type harvestPlan struct {
+	New     []marker
+	Moved   []harvestMatch
+	Changed []harvestMatch
+	Removed []Harvest
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// planHarvest matches markers to previously harvested dos. Markers with the
+// same text in the same file are the same do, even if they've moved. Of the
+// rest, a marker close to where a harvested one used to be has changed.
+func planHarvest(markers []marker, known []Harvest) harvestPlan {
+	var plan harvestPlan
+
+	used := make([]bool, len(known))
+	var unmatched []marker
+
+	for _, m := range markers {
+		found := -1
+		for i, h := range known {
+			if used[i] || h.Path != m.Path || h.Marker != m.Key() {
+				continue
+			}
+			// Prefer the one closest to where it was
+			if found < 0 || absInt(h.Line-m.Line) < absInt(known[found].Line-m.Line) {
+				found = i
+			}
+		}
+
+		if found < 0 {
+			unmatched = append(unmatched, m)
+			continue
+		}
+
+		used[found] = true
+		if known[found].Line != m.Line {
+			plan.Moved = append(plan.Moved, harvestMatch{m, known[found]})
+		}
+	}
+
+	for _, m := range unmatched {
+		found := -1
+		for i, h := range known {
+			if used[i] || h.Path != m.Path || absInt(h.Line-m.Line) > harvestNearby {
+				continue
+			}
+			if found < 0 || absInt(h.Line-m.Line) < absInt(known[found].Line-m.Line) {
+				found = i
+			}
+		}
+
+		if found < 0 {
+			plan.New = append(plan.New, m)
+			continue
+		}
+
+		used[found] = true
+		plan.Changed = append(plan.Changed, harvestMatch{m, known[found]})
+	}
+
+	for i, h := range known {
+		if !used[i] {
+			plan.Removed = append(plan.Removed, h)
+		}
+	}
+
+	return plan
+}
+
+func harvestDoc(m marker, root string) string {
+	rel, err := filepath.Rel(root, m.Path)
+	if err != nil {
+		rel = m.Path
+	}
+
+	prefix := "TODO"
+	switch m.Type {
+	case Ask:
+		prefix = "ASK"
+	case Tell:
+		prefix = "TELL"
+	}
+	if m.Name != "" {
+		prefix += "(" + m.Name + ")"
+	}
+
+	return fmt.Sprintf("Harvested from `%s:%d`\n\n> %s: %s\n", rel, m.Line, prefix, m.Text)
+}
+
+// markerCrew is who the marker names, if anyone
+func markerCrew(m marker) []string {
+	if m.Name == "" {
+		return nil
+	}
+	return []string{m.Name}
+}
+
+// harvestNew adds a do for a new marker. Like the changes below it's made in
+// a transaction, so the do, its doc, crew and harvest are saved together or
+// not at all.
+func harvestNew(svc *logbook.Service, m marker, root string) (Do, error) {
+	var do Do
+	err := svc.Transaction(func(tx *logbook.Service) error {
+		var err error
+		do, err = tx.AddDo(logbook.NewDo{
+			Do:      Do{Description: m.Text, Type: m.Type, Priority: Medium},
+			For:     m.Name,
+			Recruit: true,
+			Doc:     harvestDoc(m, root),
+		})
+		if err != nil {
+			return err
+		}
+
+		conn, err := storeConn(tx)
+		if err != nil {
+			return err
+		}
+		harvest := Harvest{DoID: do.ID, Path: m.Path, Line: m.Line, Marker: m.Key()}
+		if err := conn.Create(&harvest).Error; err != nil {
+			return logbook.StorageError("record harvest", err)
+		}
+		return nil
+	})
+	return do, err
+}
+
+func harvestMoved(svc *logbook.Service, match harvestMatch, root string) error {
+	return svc.Transaction(func(tx *logbook.Service) error {
+		conn, err := storeConn(tx)
+		if err != nil {
+			return err
+		}
+		match.Harvest.Line = match.Marker.Line
+		if err := conn.Save(&match.Harvest).Error; err != nil {
+			return logbook.StorageError("update harvest", err)
+		}
+		_, err = tx.SetDoc(match.Harvest.DoID, harvestDoc(match.Marker, root))
+		return err
+	})
+}
+
+func harvestChanged(svc *logbook.Service, match harvestMatch, root string) error {
+	return svc.Transaction(func(tx *logbook.Service) error {
+		_, err := tx.Update(match.Harvest.DoID, func(do *Do) error {
+			do.Description = match.Marker.Text
+			do.Type = match.Marker.Type
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if crew := markerCrew(match.Marker); crew != nil {
+			if _, err := assignRecruiting(tx, match.Harvest.DoID, crew...); err != nil {
+				return err
+			}
+		}
+
+		conn, err := storeConn(tx)
+		if err != nil {
+			return err
+		}
+		match.Harvest.Line = match.Marker.Line
+		match.Harvest.Marker = match.Marker.Key()
+		if err := conn.Save(&match.Harvest).Error; err != nil {
+			return logbook.StorageError("update harvest", err)
+		}
+		_, err = tx.SetDoc(match.Harvest.DoID, harvestDoc(match.Marker, root))
+		return err
+	})
+}
+
+func harvestRemoved(svc *logbook.Service, harvest Harvest) error {
+	return svc.Transaction(func(tx *logbook.Service) error {
+		if _, err := tx.Complete(harvest.DoID); err != nil {
+			return err
+		}
+		return forgetHarvest(tx, harvest)
+	})
+}
+
+// forgetHarvest stops following a marker, leaving its do as it is
+func forgetHarvest(svc *logbook.Service, harvest Harvest) error {
+	conn, err := storeConn(svc)
+	if err != nil {
+		return err
+	}
+	if err := conn.Delete(&harvest).Error; err != nil {
+		return logbook.StorageError("delete harvest", err)
+	}
+	return nil
+}
+
+// harvestedUnder finds the markers harvested from files under root. The
+// prefix is compared as it is, a LIKE would match _ and % in the path as
+// wildcards and ignore case.
+func harvestedUnder(conn *gorm.DB, root string) ([]Harvest, error) {
+	prefix := root + string(filepath.Separator)
+
+	var known []Harvest
+	err := conn.Preload("Do").
+		Where("substr(path, 1, ?) = ?", utf8.RuneCountInString(prefix), prefix).
+		Find(&known).Error
+	return known, err
+}
+
+func HarvestLog(w io.Writer, plan harvestPlan, root string) {
+	if len(plan.New)+len(plan.Changed)+len(plan.Removed)+len(plan.Moved) == 0 {
+		fmt.Fprintln(w, "Nothing to harvest.")
+		return
+	}
+
+	rel := func(path string, line int) string {
+		if r, err := filepath.Rel(root, path); err == nil {
+			path = r
+		}
+		return fmt.Sprintf("%s:%d", path, line)
+	}
+
+	tbl := sebtable.New("action", "at", "do", "marker").WithWriter(w)
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	tbl.WithHeaderFormatter(headerFmt)
+
+	for _, m := range plan.New {
+		tbl.AddRow("new", rel(m.Path, m.Line), "", m.Text)
+	}
+	for _, match := range plan.Moved {
+		tbl.AddRow("moved", rel(match.Marker.Path, match.Marker.Line), match.Harvest.DoID, match.Marker.Text)
+	}
+	for _, match := range plan.Changed {
+		tbl.AddRow("changed", rel(match.Marker.Path, match.Marker.Line), match.Harvest.DoID, match.Marker.Text)
+	}
+	for _, h := range plan.Removed {
+		tbl.AddRow("removed", rel(h.Path, h.Line), h.DoID, h.Do.Description)
+	}
+
+	tbl.Print()
+}
+
+var harvestCmd = &cobra.Command{
+	Use:   "harvest <dir> --ext=md,txt --dry-run --yes",
+	Short: "Turn TODO:, ASK(name): and TELL(name): markers in notes into dos",
+	Long: `Walk a directory of notes for TODO:, ASK(name): and TELL(name): markers and
+add a do for each new one, with a reference back to the file and line in its
+doc. Running it again offers to update dos whose markers have changed and to
+complete dos whose markers have been removed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		exts, _ := cmd.Flags().GetStringSlice("ext")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		yes, _ := cmd.Flags().GetBool("yes")
+
+		root, err := filepath.Abs(args[0])
+		if err != nil {
+			return invalidf("bad directory '%s': %v", args[0], err)
+		}
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			return notFoundf("no directory at '%s'", args[0])
+		}
+
+		markers, err := scanMarkers(root, exts)
+		if err != nil {
+			return fmt.Errorf("could not scan '%s': %w", root, err)
+		}
+
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+		conn, err := storeConn(svc)
+		if err != nil {
+			return err
+		}
+
+		known, err := harvestedUnder(conn, root)
+		if err != nil {
+			return logbook.StorageError("fetch harvested dos", err)
+		}
+
+		plan := planHarvest(markers, known)
+		out := cmd.OutOrStdout()
+		HarvestLog(out, plan, root)
+
+		if dryRun {
+			return nil
+		}
+
+		for _, m := range plan.New {
+			do, err := harvestNew(svc, m, root)
+			if err != nil {
+				return fmt.Errorf("could not harvest marker: %w", err)
+			}
+			fmt.Fprintf(out, "Added %s: (id=%d)\n", do.Type, do.ID)
+		}
+
+		for _, match := range plan.Moved {
+			if err := harvestMoved(svc, match, root); err != nil {
+				return fmt.Errorf("could not update harvest: %w", err)
+			}
+		}
+
+		for _, match := range plan.Changed {
+			preview := match.Harvest.Do
+			preview.Description = fmt.Sprintf("%s -> %s", preview.Description, match.Marker.Text)
+			if !yes {
+				ok, err := confirm(preview, "Marker changed, update this do?", greenStyle)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					continue
+				}
+			}
+			if err := harvestChanged(svc, match, root); err != nil {
+				return fmt.Errorf("could not update do: %w", err)
+			}
+			fmt.Fprintf(out, "Updated do %d\n", match.Harvest.DoID)
+		}
+
+		for _, h := range plan.Removed {
+			// Already dealt with, just forget the marker
+			if h.Do.Completed || h.Do.Deleted {
+				if err := forgetHarvest(svc, h); err != nil {
+					return err
+				}
+				continue
+			}
+			if !yes {
+				ok, err := confirm(h.Do, "Marker removed, complete this do?", greenStyle)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					continue
+				}
+			}
+			if err := harvestRemoved(svc, h); err != nil {
+				return fmt.Errorf("could not complete do: %w", err)
+			}
+			fmt.Fprintf(out, "Marked %d as done\n", h.DoID)
+		}
+		return nil
+	},
+}
+
+func init() {
+	harvestCmd.Flags().StringSlice("ext", []string{"md", "markdown", "txt", "rst", "org"}, "File extensions to scan")
+	harvestCmd.Flags().Bool("dry-run", false, "Show what would change without changing anything")
+	harvestCmd.Flags().BoolP("yes", "y", false, "Update and complete dos without asking")
+
+	RootCmd.AddCommand(harvestCmd)
+}
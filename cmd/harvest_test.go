@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"captain/logbook"
+)
+
+func TestParseMarkers(t *testing.T) {
+	input := `# Design
+
+TODO: write the migration plan
+Some text ASK(alice): who owns the cron job?
+<!-- TELL(bob): the freeze moved -->
+TODO(carol): review the schema
+TODO:
+Not a marker: TODOS are fine
+`
+
+	markers, err := parseMarkers("notes.md", strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	expected := []marker{
+		{Path: "notes.md", Line: 3, Type: Task, Text: "write the migration plan"},
+		{Path: "notes.md", Line: 4, Type: Ask, Name: "alice", Text: "who owns the cron job?"},
+		{Path: "notes.md", Line: 5, Type: Tell, Name: "bob", Text: "the freeze moved"},
+		{Path: "notes.md", Line: 6, Type: Task, Name: "carol", Text: "review the schema"},
+	}
+
+	if len(markers) != len(expected) {
+		t.Fatalf("Expected %d markers, got %d: %+v", len(expected), len(markers), markers)
+	}
+	for i, e := range expected {
+		if markers[i] != e {
+			t.Errorf("Expected %+v, got %+v", e, markers[i])
+		}
+	}
+}
+
+func TestPlanHarvest(t *testing.T) {
+	known := []Harvest{
+		{DoID: 1, Path: "a.md", Line: 3, Marker: marker{Type: Task, Text: "same"}.Key()},
+		{DoID: 2, Path: "a.md", Line: 10, Marker: marker{Type: Task, Text: "old wording"}.Key()},
+		{DoID: 3, Path: "a.md", Line: 30, Marker: marker{Type: Task, Text: "gone"}.Key()},
+		{DoID: 4, Path: "b.md", Line: 1, Marker: marker{Type: Task, Text: "unchanged"}.Key()},
+	}
+
+	markers := []marker{
+		{Path: "a.md", Line: 5, Type: Task, Text: "same"},
+		{Path: "a.md", Line: 11, Type: Task, Text: "new wording"},
+		{Path: "a.md", Line: 50, Type: Task, Text: "brand new"},
+		{Path: "b.md", Line: 1, Type: Task, Text: "unchanged"},
+	}
+
+	plan := planHarvest(markers, known)
+
+	if len(plan.Moved) != 1 || plan.Moved[0].Harvest.DoID != 1 || plan.Moved[0].Marker.Line != 5 {
+		t.Errorf("Expected do 1 to have moved to line 5, got %+v", plan.Moved)
+	}
+	if len(plan.Changed) != 1 || plan.Changed[0].Harvest.DoID != 2 || plan.Changed[0].Marker.Text != "new wording" {
+		t.Errorf("Expected do 2 to have changed, got %+v", plan.Changed)
+	}
+	if len(plan.New) != 1 || plan.New[0].Text != "brand new" {
+		t.Errorf("Expected one new marker, got %+v", plan.New)
+	}
+	if len(plan.Removed) != 1 || plan.Removed[0].DoID != 3 {
+		t.Errorf("Expected do 3 to be removed, got %+v", plan.Removed)
+	}
+}
+
+func TestHarvestRoundTrip(t *testing.T) {
+	conn, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	root := t.TempDir()
+	notes := filepath.Join(root, "notes.md")
+	os.WriteFile(notes, []byte("TODO: first\nASK(alice): second\n"), 0o644)
+	os.WriteFile(filepath.Join(root, "ignored.go"), []byte("// TODO: not a note\n"), 0o644)
+
+	markers, err := scanMarkers(root, []string{"md"})
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	if len(markers) != 2 {
+		t.Fatalf("Expected 2 markers, got %d", len(markers))
+	}
+
+	plan := planHarvest(markers, nil)
+	for _, m := range plan.New {
+		if _, err := harvestNew(testService(t, conn), m, root); err != nil {
+			t.Fatalf("Failed to harvest: %v", err)
+		}
+	}
+
+	var ask Do
+	if err := conn.Preload("Tags").Preload("Doc").Where("type = ?", Ask).First(&ask).Error; err != nil {
+		t.Fatalf("Failed to fetch ask: %v", err)
+	}
+	if len(ask.Tags) != 1 || ask.Tags[0].Name != "alice" {
+		t.Errorf("Expected the ask to be for alice, got %v", ask.Tags)
+	}
+	if !strings.Contains(ask.Doc.Text, "notes.md:2") {
+		t.Errorf("Expected a back-reference in the doc, got %q", ask.Doc.Text)
+	}
+
+	// Drop the first marker and run again
+	os.WriteFile(notes, []byte("ASK(alice): second\n"), 0o644)
+	markers, _ = scanMarkers(root, []string{"md"})
+
+	var known []Harvest
+	conn.Preload("Do").Find(&known)
+	plan = planHarvest(markers, known)
+
+	if len(plan.New) != 0 || len(plan.Removed) != 1 || len(plan.Moved) != 1 {
+		t.Fatalf("Expected one removed and one moved, got %+v", plan)
+	}
+
+	if err := harvestMoved(testService(t, conn), plan.Moved[0], root); err != nil {
+		t.Fatalf("Failed to move: %v", err)
+	}
+	if err := harvestRemoved(testService(t, conn), plan.Removed[0]); err != nil {
+		t.Fatalf("Failed to remove: %v", err)
+	}
+
+	var first Do
+	conn.First(&first, plan.Removed[0].DoID)
+	if !first.Completed {
+		t.Error("Expected the removed marker's do to be completed")
+	}
+
+	var doc DoDoc
+	conn.Where("do_id = ?", ask.ID).First(&doc)
+	if !strings.Contains(doc.Text, "notes.md:1") {
+		t.Errorf("Expected the back-reference to follow the marker, got %q", doc.Text)
+	}
+}
+
+func TestHarvestNewIsUndoneOnFailure(t *testing.T) {
+	conn, cleanup := setupTestDB(t)
+	defer cleanup()
+	refuseWrites(t, conn, "INSERT", "harvests", "1")
+
+	m := marker{Path: "/notes/todo.md", Line: 1, Type: Ask, Name: "alice", Text: "second"}
+	if _, err := harvestNew(testService(t, conn), m, "/notes"); err == nil {
+		t.Fatal("Expected the harvest to fail")
+	}
+
+	var dos, docs, crew int64
+	conn.Model(&Do{}).Count(&dos)
+	conn.Model(&DoDoc{}).Count(&docs)
+	conn.Model(&DoTag{}).Count(&crew)
+	if dos != 0 || docs != 0 || crew != 0 {
+		t.Errorf("Expected nothing saved, got %d dos, %d docs and %d assigned", dos, docs, crew)
+	}
+}
+
+func TestHarvestedUnderMatchesThePathExactly(t *testing.T) {
+	conn, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for i, path := range []string{"/notes/my_notes/a.md", "/notes/myXnotes/b.md", "/notes/MY_NOTES/c.md", "/notes/my_notes.md"} {
+		conn.Create(&Harvest{DoID: uint(i + 1), Path: path, Line: 1})
+	}
+
+	known, err := harvestedUnder(conn, "/notes/my_notes")
+	if err != nil {
+		t.Fatalf("Failed to fetch: %v", err)
+	}
+	if len(known) != 1 || known[0].Path != "/notes/my_notes/a.md" {
+		t.Errorf("Expected only the marker under the directory, got %+v", known)
+	}
+}
+
+func TestHarvestCommandAsksBeforeCompleting(t *testing.T) {
+	conn, cleanup := setupTestDB(t)
+	defer cleanup()
+	store := logbook.NewSQLStore(conn, t.TempDir())
+
+	root := t.TempDir()
+	notes := filepath.Join(root, "notes.md")
+	os.WriteFile(notes, []byte("TODO: first\n"), 0o644)
+	if out, err := runCaptain(t, store, "harvest", root); err != nil || !strings.Contains(out, "Added task: (id=1)") {
+		t.Fatalf("Expected the marker to be harvested, got %v:\n%s", err, out)
+	}
+
+	os.WriteFile(notes, []byte("Nothing left\n"), 0o644)
+	out, err := runCaptain(t, store, "harvest", root)
+	if err != nil || !strings.Contains(out, "Marked 1 as done") {
+		t.Errorf("Expected the do to be completed once confirmed, got %v:\n%s", err, out)
+	}
+}
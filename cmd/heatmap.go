@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"captain/logbook"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+// heatWeeks is the number of weeks shown, a year like GitHub's calendar
+const heatWeeks = 53
+
+// heatColours are the cell colours from no completions to the busiest days
+var heatColours = []lipgloss.Color{"237", "22", "28", "34", "46"}
+
+type heatDay struct {
+	Date   time.Time
+	Future bool
+	Dos    []Do
+}
+
+// buildHeatmap lays completed dos out in days, one column per week starting
+// on Monday, ending with the week that contains end.
+func buildHeatmap(dos []Do, end time.Time, weeks int) []heatDay {
+	start := startOfWeek(end).AddDate(0, 0, -7*(weeks-1))
+	days := make([]heatDay, weeks*7)
+	index := map[string]int{}
+
+	for i := range days {
+		date := start.AddDate(0, 0, i)
+		days[i] = heatDay{Date: date, Future: date.After(end)}
+		index[date.Format("2006-01-02")] = i
+	}
+
+	for _, do := range dos {
+		if do.CompletedAt == nil {
+			continue
+		}
+		if i, ok := index[do.CompletedAt.In(end.Location()).Format("2006-01-02")]; ok {
+			days[i].Dos = append(days[i].Dos, do)
+		}
+	}
+
+	return days
+}
+
+// heatLevel buckets a count into one of the heatColours relative to max
+func heatLevel(count, max int) int {
+	if count == 0 || max == 0 {
+		return 0
+	}
+	levels := len(heatColours) - 1
+	level := (count*levels + max - 1) / max
+	if level > levels {
+		level = levels
+	}
+	return level
+}
+
+type heatmapModel struct {
+	days     []heatDay
+	cursor   int
+	unhide   bool
+	quitting bool
+}
+
+func newHeatmapModel(days []heatDay, unhide bool) heatmapModel {
+	// Start the cursor on the most recent day that isn't in the future
+	cursor := 0
+	for i, day := range days {
+		if !day.Future {
+			cursor = i
+		}
+	}
+	return heatmapModel{days: days, cursor: cursor, unhide: unhide}
+}
+
+func (m heatmapModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m heatmapModel) move(step int) heatmapModel {
+	next := m.cursor + step
+	if next >= 0 && next < len(m.days) && !m.days[next].Future {
+		m.cursor = next
+	}
+	return m
+}
+
+func (m heatmapModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "up", "k":
+			return m.move(-1), nil
+		case "down", "j":
+			return m.move(1), nil
+		case "left", "h":
+			return m.move(-7), nil
+		case "right", "l":
+			return m.move(7), nil
+		case "q", "esc", "ctrl+c", "enter":
+			m.quitting = true
+			return m, tea.Quit
+		}
+	}
+	return m, nil
+}
+
+func (m heatmapModel) View() string {
+	return renderHeatmap(m.days, m.cursor, m.unhide, true)
+}
+
+// renderHeatmap draws the calendar grid. When cursor is in range that day is
+// highlighted, and with drill set its completed dos are listed underneath.
+func renderHeatmap(days []heatDay, cursor int, unhide bool, drill bool) string {
+	var b strings.Builder
+
+	max, total := 0, 0
+	for _, day := range days {
+		total += len(day.Dos)
+		if len(day.Dos) > max {
+			max = len(day.Dos)
+		}
+	}
+
+	weeks := len(days) / 7
+
+	// Month labels above the first week of each month
+	labels := []rune(strings.Repeat(" ", weeks*2))
+	for w := 0; w < weeks; w++ {
+		first := days[w*7].Date
+		if w == 0 || first.Month() != days[(w-1)*7].Date.Month() {
+			month := []rune(first.Format("Jan"))
+			if w*2+len(month) <= len(labels) {
+				copy(labels[w*2:], month)
+			}
+		}
+	}
+	b.WriteString("    ")
+	b.WriteString(normalStyle.Render(string(labels)))
+	b.WriteString("\n")
+
+	weekdays := []string{"Mon", "", "Wed", "", "Fri", "", ""}
+	for row := 0; row < 7; row++ {
+		b.WriteString(normalStyle.Render(fmt.Sprintf("%-4s", weekdays[row])))
+		for w := 0; w < weeks; w++ {
+			i := w*7 + row
+			day := days[i]
+			if day.Future {
+				b.WriteString("  ")
+				continue
+			}
+
+			cell := "■"
+			if i == cursor {
+				cell = "▣"
+			}
+			colour := heatColours[heatLevel(len(day.Dos), max)]
+			style := lipgloss.NewStyle().Foreground(colour)
+			if i == cursor {
+				style = highlightStyle
+			}
+			b.WriteString(style.Render(cell))
+			b.WriteString(" ")
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	b.WriteString(normalStyle.Render(fmt.Sprintf("%d completed in the last year  less ", total)))
+	for _, colour := range heatColours {
+		b.WriteString(lipgloss.NewStyle().Foreground(colour).Render("■"))
+	}
+	b.WriteString(normalStyle.Render(" more"))
+	b.WriteString("\n")
+
+	if !drill || cursor < 0 || cursor >= len(days) {
+		return b.String()
+	}
+
+	day := days[cursor]
+	b.WriteString("\n")
+	b.WriteString(highlightStyle.Render(day.Date.Format("Monday 02-Jan-06")))
+	b.WriteString(fmt.Sprintf(" (%d done)\n", len(day.Dos)))
+	for _, do := range day.Dos {
+		description := do.Description
+		if do.Sensitive && !unhide {
+			description = strings.Repeat("⠿", len(do.Description))
+		}
+		b.WriteString(fmt.Sprintf("  %s %-4d %s %s\n", done, do.ID, fmtDo(do), description))
+	}
+
+	b.WriteString("\n")
+	b.WriteString(normalStyle.Render("←/→ weeks • ↑/↓ days • q to quit"))
+
+	return b.String()
+}
+
+var heatmapCmd = &cobra.Command{
+	Use:   "heatmap --type=<type> --for=<tag.name> --unhide --print",
+	Short: "Show a calendar heatmap of completed dos",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		doType, _ := cmd.Flags().GetString("type")
+		forTag, _ := cmd.Flags().GetString("for")
+		unhide, _ := cmd.Flags().GetBool("unhide")
+		static, _ := cmd.Flags().GetBool("print")
+
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		start := startOfWeek(now).AddDate(0, 0, -7*(heatWeeks-1))
+
+		completed := true
+		query := logbook.Query{
+			Completed:      &completed,
+			CompletedSince: &start,
+			For:            forTag,
+			Promoted:       true,
+			Sort:           logbook.SortCompleted,
+			Asc:            true,
+		}
+		if doType != "" {
+			query.Type = mapType(doType)
+		}
+
+		dos, err := svc.Query(query)
+		if err != nil {
+			return err
+		}
+
+		days := buildHeatmap(dos, now, heatWeeks)
+
+		if static {
+			fmt.Fprint(cmd.OutOrStdout(), renderHeatmap(days, -1, unhide, false))
+			return nil
+		}
+
+		p := tea.NewProgram(newHeatmapModel(days, unhide))
+		if _, err := p.Run(); err != nil {
+			return fmt.Errorf("could not run program: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	heatmapCmd.Flags().String("type", "", "Filter by type (task/ask/tell/brag/learn/pr/meta)")
+	heatmapCmd.Flags().String("for", "", "Filter by tag/person")
+	heatmapCmd.Flags().BoolP("unhide", "u", false, "unhide sensitive tasks")
+	heatmapCmd.Flags().Bool("print", false, "print the heatmap without the interactive drill-down")
+
+	RootCmd.AddCommand(heatmapCmd)
+}
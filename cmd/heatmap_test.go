@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeatLevel(t *testing.T) {
+	tests := []struct {
+		count, max, expected int
+	}{
+		{0, 0, 0},
+		{0, 10, 0},
+		{1, 10, 1},
+		{5, 10, 2},
+		{10, 10, 4},
+		{1, 1, 4},
+	}
+
+	for _, tt := range tests {
+		if result := heatLevel(tt.count, tt.max); result != tt.expected {
+			t.Errorf("heatLevel(%d, %d) = %d, expected %d", tt.count, tt.max, result, tt.expected)
+		}
+	}
+}
+
+func TestBuildHeatmap(t *testing.T) {
+	end := time.Date(2025, 3, 12, 18, 0, 0, 0, time.UTC) // Wednesday
+	completed := func(t time.Time) *time.Time { return &t }
+
+	dos := []Do{
+		{ID: 1, Completed: true, CompletedAt: completed(end.Add(-2 * time.Hour))},
+		{ID: 2, Completed: true, CompletedAt: completed(end.Add(-3 * time.Hour))},
+		{ID: 3, Completed: true, CompletedAt: completed(end.AddDate(0, 0, -9))},
+		{ID: 4, Completed: true, CompletedAt: completed(end.AddDate(-2, 0, 0))}, // out of range
+		{ID: 5},
+	}
+
+	days := buildHeatmap(dos, end, 2)
+	if len(days) != 14 {
+		t.Fatalf("Expected 14 days, got %d", len(days))
+	}
+
+	if days[0].Date.Weekday() != time.Monday {
+		t.Errorf("Expected grid to start on a Monday, got %s", days[0].Date.Weekday())
+	}
+
+	// Wednesday of the second week
+	if len(days[9].Dos) != 2 {
+		t.Errorf("Expected 2 dos on %s, got %d", days[9].Date.Format("2006-01-02"), len(days[9].Dos))
+	}
+
+	// Monday of the first week
+	if len(days[0].Dos) != 1 || days[0].Dos[0].ID != 3 {
+		t.Errorf("Expected do 3 on the first Monday, got %+v", days[0].Dos)
+	}
+
+	if !days[10].Future || days[9].Future {
+		t.Error("Expected only the days after end to be in the future")
+	}
+}
+
+func TestRenderHeatmapDrillDown(t *testing.T) {
+	end := time.Date(2025, 3, 12, 18, 0, 0, 0, time.UTC)
+	completedAt := end.Add(-time.Hour)
+	dos := []Do{
+		{ID: 7, Description: "Shipped it", Type: Brag, Completed: true, CompletedAt: &completedAt},
+		{ID: 8, Description: "secret", Type: Task, Sensitive: true, Completed: true, CompletedAt: &completedAt},
+	}
+
+	days := buildHeatmap(dos, end, 2)
+	m := newHeatmapModel(days, false)
+
+	view := stripANSI(m.View())
+	if !strings.Contains(view, "Shipped it") {
+		t.Error("Expected the drill-down to list the selected day's dos")
+	}
+	if strings.Contains(view, "secret") {
+		t.Error("Expected sensitive dos to be hidden")
+	}
+
+	// Moving into the future is not allowed
+	if moved := m.move(1); moved.cursor != m.cursor {
+		t.Error("Expected the cursor to stay put when moving into the future")
+	}
+}
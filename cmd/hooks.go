@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"captain/logbook"
+
+	"github.com/fatih/color"
+	sebtable "github.com/s3bw/table"
+	"github.com/spf13/cobra"
+)
+
+type hookEvent = logbook.Event
+
+const (
+	onCreate   = logbook.OnCreate
+	onComplete = logbook.OnComplete
+	onScratch  = logbook.OnScratch
+	onReassign = logbook.OnReassign
+	onDoc      = logbook.OnDoc
+	onPromote  = logbook.OnPromote
+)
+
+var hookEvents = []hookEvent{onCreate, onComplete, onScratch, onReassign, onDoc, onPromote}
+
+// hookOutput is where hooks and their warnings write to, the command's
+// stderr so they don't end up in output that's piped somewhere
+var hookOutput io.Writer = os.Stderr
+
+// errHook is returned for a change that a hook cancelled
+var errHook error = &logbook.Error{Kind: logbook.ErrCancelled, Msg: "cancelled by hook"}
+
+const (
+	hookWarn  = "warn"
+	hookAbort = "abort"
+)
+
+func hooksDir(cfg *Config) string {
+	return filepath.Join(cfg.CaptainDir, "hooks")
+}
+
+// hookPath is where the script for an event lives, e.g. hooks/on-complete
+func hookPath(dir string, event hookEvent) string {
+	return filepath.Join(dir, "on-"+string(event))
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && info.Mode()&0o111 != 0
+}
+
+// runHook runs the hook for an event with the do as JSON on stdin. A
+// missing hook is not an error.
+func runHook(dir string, event hookEvent, do Do, timeout time.Duration) error {
+	path := hookPath(dir, event)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if !isExecutable(path) {
+		return fmt.Errorf("%s is not executable", path)
+	}
+
+	payload, err := json.Marshal(do)
+	if err != nil {
+		return err
+	}
+
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = hookOutput
+	cmd.Stderr = hookOutput
+	cmd.WaitDelay = time.Second
+	cmd.Env = append(os.Environ(),
+		"CAPTAIN_EVENT="+string(event),
+		fmt.Sprintf("CAPTAIN_DO_ID=%d", do.ID),
+	)
+
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("on-%s timed out after %s", event, timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("on-%s failed: %w", event, err)
+	}
+	return nil
+}
+
+// fireHook runs the hook for an event before the change is saved, with the
+// do as it will be. It returns false when the hook failed and the failure
+// policy is abort, in which case the change should not be made.
+func fireHook(event hookEvent, do Do) bool {
+	err := runHook(hooksDir(&cfg), event, do, cfg.HookTimeout)
+	if err == nil {
+		return true
+	}
+
+	if cfg.HookFailure == hookAbort {
+		fmt.Fprintf(hookOutput, "Hook %v, cancelled\n", err)
+		return false
+	}
+	fmt.Fprintf(hookOutput, "Warning: hook %v\n", err)
+	return true
+}
+
+// runHooks fires the hook for a change made through a logbook.Service
+func runHooks(event hookEvent, do Do) error {
+	if !fireHook(event, do) {
+		return errHook
+	}
+	return nil
+}
+
+// ranHooks fires the hook for a change made in a transaction once it's saved.
+// It's too late to cancel the change, so a failing hook is only a warning.
+func ranHooks(event hookEvent, do Do) {
+	if err := runHook(hooksDir(&cfg), event, do, cfg.HookTimeout); err != nil {
+		fmt.Fprintf(hookOutput, "Warning: hook %v\n", err)
+	}
+}
+
+var hooksCmd = &cobra.Command{
+	Use:   "hooks",
+	Short: "Manage scripts run when dos change",
+	Long: `Scripts in the hooks directory under the captain directory are run when a
+do is created, completed, scratched, reassigned, documented or promoted. A hook
+is named after its event, e.g. hooks/on-complete, and gets the do as JSON on
+stdin. Hooks run before the change is saved; set hook_failure to abort to
+cancel the change when a hook fails or runs longer than hook_timeout.
+
+Changes saved together, e.g. by import, harvest, pr sync or a commit's trailers,
+run their hooks after they're saved, and can't be cancelled by one.`,
+}
+
+var hooksListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List hooks and whether they're installed",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := hooksDir(&cfg)
+		out := cmd.OutOrStdout()
+
+		tbl := sebtable.New("event", "hook", "status").WithWriter(out)
+		headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+		tbl.WithHeaderFormatter(headerFmt)
+
+		for _, event := range hookEvents {
+			path := hookPath(dir, event)
+			status := color.New(color.FgHiBlack).Sprintf("none")
+			if _, err := os.Stat(path); err == nil {
+				status = color.New(color.FgGreen).Sprintf("installed")
+				if !isExecutable(path) {
+					status = color.New(color.FgRed).Sprintf("not executable")
+				}
+			}
+			tbl.AddRow(event, path, status)
+		}
+		tbl.Print()
+
+		fmt.Fprintf(out, "timeout: %s, on failure: %s\n", cfg.HookTimeout, cfg.HookFailure)
+		return nil
+	},
+}
+
+var hooksTestCmd = &cobra.Command{
+	Use:   "test <event> [do_id]",
+	Short: "Run a hook with a do, or a sample do",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		event := hookEvent(args[0])
+
+		known := false
+		for _, e := range hookEvents {
+			known = known || e == event
+		}
+		if !known {
+			return invalidf("no such event: '%s' %v", event, hookEvents)
+		}
+
+		dir := hooksDir(&cfg)
+		if _, err := os.Stat(hookPath(dir, event)); err != nil {
+			return notFoundf("no hook at %s", hookPath(dir, event))
+		}
+
+		do := Do{
+			Description: "Test the on-" + string(event) + " hook",
+			Type:        Task,
+			Priority:    Medium,
+			CreatedAt:   time.Now(),
+		}
+		if len(args) > 1 {
+			id, err := parseID(args[1])
+			if err != nil {
+				return err
+			}
+			svc, err := newService(&cfg)
+			if err != nil {
+				return err
+			}
+			if do, err = svc.Find(id); err != nil {
+				return err
+			}
+		}
+
+		start := time.Now()
+		if err := runHook(dir, event, do, cfg.HookTimeout); err != nil {
+			return fmt.Errorf("hook %w", err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Hook on-%s ran in %s\n", event, time.Since(start).Round(time.Millisecond))
+		return nil
+	},
+}
+
+func init() {
+	hooksCmd.AddCommand(hooksListCmd, hooksTestCmd)
+	RootCmd.AddCommand(hooksCmd)
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"captain/logbook"
+)
+
+func writeHook(t *testing.T, dir string, event hookEvent, script string) {
+	t.Helper()
+	if err := os.WriteFile(hookPath(dir, event), []byte("#!/bin/sh\n"+script+"\n"), 0o755); err != nil {
+		t.Fatalf("Failed to write hook: %v", err)
+	}
+}
+
+func TestRunHook(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.json")
+
+	do := Do{ID: 7, Description: "Ship it", Type: Task, Priority: High, Tags: []Tag{{Name: "alice"}}}
+
+	if err := runHook(dir, onComplete, do, time.Second); err != nil {
+		t.Errorf("Expected a missing hook to be skipped, got %v", err)
+	}
+
+	writeHook(t, dir, onComplete, `cat > "`+out+`"; echo "$CAPTAIN_EVENT $CAPTAIN_DO_ID" >> "`+out+`.env"`)
+	if err := runHook(dir, onComplete, do, time.Second); err != nil {
+		t.Fatalf("Failed to run hook: %v", err)
+	}
+
+	var received Do
+	content, _ := os.ReadFile(out)
+	if err := json.Unmarshal(content, &received); err != nil {
+		t.Fatalf("Expected JSON on stdin, got %q", content)
+	}
+	if received.ID != 7 || received.Description != "Ship it" || len(received.Tags) != 1 {
+		t.Errorf("Unexpected do %+v", received)
+	}
+	if env, _ := os.ReadFile(out + ".env"); strings.TrimSpace(string(env)) != "complete 7" {
+		t.Errorf("Unexpected environment %q", env)
+	}
+
+	writeHook(t, dir, onScratch, "exit 3")
+	if err := runHook(dir, onScratch, do, time.Second); err == nil {
+		t.Error("Expected a failing hook to return an error")
+	}
+
+	writeHook(t, dir, onDoc, "exec sleep 5")
+	start := time.Now()
+	err := runHook(dir, onDoc, do, 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Error("Expected the hook to be killed at the timeout")
+	}
+
+	os.WriteFile(hookPath(dir, onPromote), []byte("#!/bin/sh\n"), 0o644)
+	if err := runHook(dir, onPromote, do, time.Second); err == nil {
+		t.Error("Expected a non-executable hook to return an error")
+	}
+}
+
+func TestFireHookPolicy(t *testing.T) {
+	original := cfg
+	defer func() { cfg = original }()
+
+	cfg.CaptainDir = t.TempDir()
+	os.MkdirAll(hooksDir(&cfg), 0o755)
+	writeHook(t, hooksDir(&cfg), onCreate, "exit 1")
+
+	cfg.HookFailure = hookWarn
+	if !fireHook(onCreate, Do{}) {
+		t.Error("Expected a failing hook to only warn")
+	}
+
+	cfg.HookFailure = hookAbort
+	if fireHook(onCreate, Do{}) {
+		t.Error("Expected a failing hook to abort")
+	}
+	if !fireHook(onComplete, Do{}) {
+		t.Error("Expected no hook to never abort")
+	}
+}
+
+func TestHooksTestCommand(t *testing.T) {
+	store := logbook.NewMemStore()
+	runCaptain(t, store, "do", "Ship it")
+
+	dir := filepath.Join(captainDirs[t], "hooks")
+	os.MkdirAll(dir, 0o755)
+	writeHook(t, dir, onComplete, "cat > /dev/null")
+
+	out, err := runCaptain(t, store, "hooks", "test", "complete", "1 OR 1=1")
+	if ExitCode(err) != exitInvalid || !strings.Contains(out, "'1 OR 1=1' is not a do id") {
+		t.Errorf("Expected the id to be refused, got %v:\n%s", err, out)
+	}
+
+	out, err = runCaptain(t, store, "hooks", "test", "complete", "1")
+	if err != nil || !strings.Contains(out, "Hook on-complete ran in") {
+		t.Errorf("Expected the hook to run, got %v:\n%s", err, out)
+	}
+}
+
+func TestHookOutputGoesToStderr(t *testing.T) {
+	store := logbook.NewMemStore()
+	dir := t.TempDir()
+	t.Setenv("CAPTAIN_DIR", dir)
+	os.MkdirAll(hooksDir(&Config{CaptainDir: dir}), 0o755)
+	writeHook(t, hooksDir(&Config{CaptainDir: dir}), onCreate, "echo from the hook; exit 1")
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	RootCmd.SetOut(stdout)
+	RootCmd.SetErr(stderr)
+	defer RootCmd.SetOut(nil)
+	defer RootCmd.SetErr(nil)
+
+	originalCfg, originalOpen := cfg, openStore
+	defer func() { cfg, openStore = originalCfg, originalOpen }()
+	openStore = func(*Config) (logbook.Store, error) { return store, nil }
+	defer resetCommands(RootCmd)
+
+	RootCmd.SetArgs([]string{"do", "Piped"})
+	if err := execute(RootCmd); err != nil {
+		t.Fatalf("Expected a failing hook to only warn, got %v", err)
+	}
+	if strings.Contains(stdout.String(), "hook") {
+		t.Errorf("Expected nothing from the hook on stdout, got %q", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "from the hook") || !strings.Contains(stderr.String(), "Warning: hook") {
+		t.Errorf("Expected the hook and its warning on stderr, got %q", stderr.String())
+	}
+}
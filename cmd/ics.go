@@ -0,0 +1,323 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	icsDate     = "20060102"
+	icsDateTime = "20060102T150405Z"
+	icsLocal    = "20060102T150405"
+)
+
+// icsPriority maps priorities onto the iCalendar 1-9 scale
+func icsPriority(p DoPrio) int {
+	switch p {
+	case High:
+		return 1
+	case Low:
+		return 9
+	default:
+		return 5
+	}
+}
+
+func mapICSPriority(p int) DoPrio {
+	switch {
+	case p >= 1 && p <= 4:
+		return High
+	case p >= 6:
+		return Low
+	default:
+		return Medium
+	}
+}
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+var icsUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+// writeICSLine writes a content line folded at 75 octets as per RFC 5545.
+// The space starting each continuation line counts towards its 75.
+func writeICSLine(w io.Writer, line string) error {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		// Don't split a multi-byte rune
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		if _, err := fmt.Fprintf(w, "%s\r\n ", line[:cut]); err != nil {
+			return err
+		}
+		line = line[cut:]
+		limit = 74
+	}
+	_, err := fmt.Fprintf(w, "%s\r\n", line)
+	return err
+}
+
+func exportICS(w io.Writer, dos []Do) error {
+	now := time.Now().UTC().Format(icsDateTime)
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//captain//captain//EN",
+	}
+
+	for _, do := range dos {
+		categories := []string{icsEscaper.Replace(string(do.Type))}
+		for _, tag := range do.Tags {
+			categories = append(categories, icsEscaper.Replace(tag.Name))
+		}
+
+		lines = append(lines,
+			"BEGIN:VTODO",
+			"UID:"+do.UID,
+			"DTSTAMP:"+now,
+			"CREATED:"+do.CreatedAt.UTC().Format(icsDateTime),
+			"SUMMARY:"+icsEscaper.Replace(do.Description),
+			fmt.Sprintf("PRIORITY:%d", icsPriority(do.Priority)),
+			"CATEGORIES:"+strings.Join(categories, ","),
+		)
+		if do.Doc.ID != 0 {
+			lines = append(lines, "DESCRIPTION:"+icsEscaper.Replace(do.Doc.Text))
+		}
+		if do.ScheduledAt != nil {
+			lines = append(lines, "DTSTART;VALUE=DATE:"+do.ScheduledAt.Format(icsDate))
+		}
+		if do.DueAt != nil {
+			lines = append(lines, "DUE;VALUE=DATE:"+do.DueAt.Format(icsDate))
+		}
+		if do.Completed {
+			lines = append(lines, "STATUS:COMPLETED")
+			if do.CompletedAt != nil {
+				lines = append(lines, "COMPLETED:"+do.CompletedAt.UTC().Format(icsDateTime))
+			}
+		} else {
+			lines = append(lines, "STATUS:NEEDS-ACTION")
+		}
+		lines = append(lines, "END:VTODO")
+	}
+
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		if err := writeICSLine(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type icsProperty struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// parseICSLine splits a content line into its name, parameters and value
+func parseICSLine(line string) (icsProperty, bool) {
+	prop := icsProperty{Params: map[string]string{}}
+
+	// The value starts at the first colon that isn't inside a quoted parameter
+	inQuotes := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			inQuotes = !inQuotes
+		}
+		if r == ':' && !inQuotes {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return prop, false
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	prop.Name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		if key, value, ok := strings.Cut(param, "="); ok {
+			prop.Params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+		}
+	}
+	prop.Value = line[colon+1:]
+	return prop, true
+}
+
+func parseICSTime(prop icsProperty) (*time.Time, error) {
+	var t time.Time
+	var err error
+	switch {
+	case prop.Params["VALUE"] == "DATE" || len(prop.Value) == len(icsDate):
+		t, err = time.ParseInLocation(icsDate, prop.Value, time.Local)
+	case strings.HasSuffix(prop.Value, "Z"):
+		t, err = time.Parse(icsDateTime, prop.Value)
+	default:
+		loc := time.Local
+		if tzid := prop.Params["TZID"]; tzid != "" {
+			if l, lerr := time.LoadLocation(tzid); lerr == nil {
+				loc = l
+			}
+		}
+		t, err = time.ParseInLocation(icsLocal, prop.Value, loc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bad %s '%s': %w", prop.Name, prop.Value, err)
+	}
+	return &t, nil
+}
+
+// splitICSList splits a comma separated value, respecting escaped commas
+func splitICSList(value string) []string {
+	var items []string
+	var current strings.Builder
+	escaped := false
+	for _, r := range value {
+		switch {
+		case escaped:
+			current.WriteRune('\\')
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ',':
+			items = append(items, icsUnescaper.Replace(current.String()))
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	items = append(items, icsUnescaper.Replace(current.String()))
+	return items
+}
+
+// isDoType reports whether s names one of the do types
+func isDoType(s string) bool {
+	return mapType(s) != Task || s == string(Task)
+}
+
+// importICS reads VTODO and VEVENT components as dos. Categories that name a
+// do type set the type, any others are crew if they're in the crew already.
+func importICS(r io.Reader) ([]importedDo, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	// Unfold continuation lines first
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var items []importedDo
+	var current *importedDo
+	var component string
+	depth := 0
+
+	for n, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		prop, ok := parseICSLine(line)
+		if !ok {
+			return nil, fmt.Errorf("line %d: not a content line", n+1)
+		}
+
+		switch prop.Name {
+		case "BEGIN":
+			value := strings.ToUpper(prop.Value)
+			if current == nil && (value == "VTODO" || value == "VEVENT") {
+				component = value
+				current = &importedDo{Do: Do{Type: Task, Priority: Medium, CreatedAt: time.Now()}}
+				depth = 0
+			} else if current != nil {
+				// Nested components such as VALARM are skipped
+				depth++
+			}
+			continue
+		case "END":
+			if current != nil && depth > 0 {
+				depth--
+			} else if current != nil && strings.ToUpper(prop.Value) == component {
+				if current.Do.Description != "" {
+					items = append(items, *current)
+				}
+				current = nil
+			}
+			continue
+		}
+
+		if current == nil || depth > 0 {
+			continue
+		}
+
+		var err error
+		switch prop.Name {
+		case "UID":
+			current.Do.UID = prop.Value
+		case "SUMMARY":
+			current.Do.Description = icsUnescaper.Replace(prop.Value)
+		case "DESCRIPTION":
+			current.Doc = icsUnescaper.Replace(prop.Value)
+		case "PRIORITY":
+			p, _ := strconv.Atoi(prop.Value)
+			current.Do.Priority = mapICSPriority(p)
+		case "CATEGORIES":
+			for _, category := range splitICSList(prop.Value) {
+				category = strings.TrimSpace(category)
+				if category == "" {
+					continue
+				}
+				if isDoType(category) {
+					current.Do.Type = mapType(category)
+				} else {
+					current.Categories = append(current.Categories, category)
+				}
+			}
+		case "CREATED":
+			var created *time.Time
+			if created, err = parseICSTime(prop); err == nil {
+				current.Do.CreatedAt = *created
+			}
+		case "DTSTART":
+			current.Do.ScheduledAt, err = parseICSTime(prop)
+		case "DUE":
+			current.Do.DueAt, err = parseICSTime(prop)
+		case "STATUS":
+			if strings.ToUpper(prop.Value) == "COMPLETED" {
+				current.Do.Completed = true
+			}
+		case "COMPLETED":
+			current.Do.Completed = true
+			current.Do.CompletedAt, err = parseICSTime(prop)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+	}
+
+	// Completed without a timestamp is completed now
+	for i := range items {
+		if items[i].Do.Completed && items[i].Do.CompletedAt == nil {
+			now := time.Now()
+			items[i].Do.CompletedAt = &now
+		}
+	}
+
+	return items, nil
+}
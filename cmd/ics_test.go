@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestICSRoundTrip(t *testing.T) {
+	due := time.Date(2025, 3, 14, 0, 0, 0, 0, time.Local)
+	completedAt := time.Date(2025, 3, 10, 17, 30, 0, 0, time.UTC)
+
+	dos := []Do{
+		{
+			UID:         "abc@captain",
+			Description: "Ask about the release, today; please",
+			Type:        Ask,
+			Priority:    High,
+			DueAt:       &due,
+			Tags:        []Tag{{Name: "alice"}},
+			Doc:         DoDoc{ID: 1, Text: "Line one\nLine two"},
+		},
+		{
+			UID:         "def@captain",
+			Description: strings.Repeat("A very long description ", 5),
+			Type:        PR,
+			Priority:    Low,
+			Completed:   true,
+			CompletedAt: &completedAt,
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := exportICS(&buf, dos); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	for _, line := range strings.Split(buf.String(), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("Expected lines to be folded at 75 octets, got %d: %s", len(line), line)
+		}
+	}
+
+	items, err := importICS(&buf)
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(items))
+	}
+
+	ask := items[0]
+	if ask.Do.UID != "abc@captain" {
+		t.Errorf("Expected UID to be preserved, got %s", ask.Do.UID)
+	}
+	if ask.Do.Description != dos[0].Description {
+		t.Errorf("Expected description %q, got %q", dos[0].Description, ask.Do.Description)
+	}
+	if ask.Do.Type != Ask || ask.Do.Priority != High {
+		t.Errorf("Expected ask/high, got %s/%s", ask.Do.Type, ask.Do.Priority)
+	}
+	if len(ask.Categories) != 1 || ask.Categories[0] != "alice" {
+		t.Errorf("Expected categories [alice], got %v", ask.Categories)
+	}
+	if ask.Doc != "Line one\nLine two" {
+		t.Errorf("Expected doc to be preserved, got %q", ask.Doc)
+	}
+	if ask.Do.DueAt == nil || !ask.Do.DueAt.Equal(due) {
+		t.Errorf("Expected due %v, got %v", due, ask.Do.DueAt)
+	}
+
+	pr := items[1]
+	if pr.Do.Description != dos[1].Description {
+		t.Errorf("Expected folded description to be unfolded, got %q", pr.Do.Description)
+	}
+	if !pr.Do.Completed || pr.Do.CompletedAt == nil || !pr.Do.CompletedAt.Equal(completedAt) {
+		t.Errorf("Expected completed at %v, got %v", completedAt, pr.Do.CompletedAt)
+	}
+	if pr.Do.Type != PR || pr.Do.Priority != Low {
+		t.Errorf("Expected PR/low, got %s/%s", pr.Do.Type, pr.Do.Priority)
+	}
+}
+
+func TestWriteICSLineFoldsAt75Octets(t *testing.T) {
+	for _, line := range []string{
+		"SUMMARY:" + strings.Repeat("x", 300),
+		"SUMMARY:" + strings.Repeat("é", 150),
+	} {
+		var buf bytes.Buffer
+		if err := writeICSLine(&buf, line); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+
+		folded := strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n")
+		unfolded := folded[0]
+		for i, part := range folded {
+			if len(part) > 75 {
+				t.Errorf("Expected line %d folded at 75 octets, got %d", i, len(part))
+			}
+			if i > 0 {
+				unfolded += strings.TrimPrefix(part, " ")
+			}
+		}
+		if unfolded != line {
+			t.Errorf("Expected the line back unfolded, got %q", unfolded)
+		}
+	}
+}
+
+func TestImportICSEvents(t *testing.T) {
+	input := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:event-1",
+		"SUMMARY:Planning",
+		"DTSTART;TZID=UTC:20250317T100000",
+		"BEGIN:VALARM",
+		"SUMMARY:Reminder",
+		"END:VALARM",
+		"END:VEVENT",
+		"BEGIN:VTODO",
+		"SUMMARY:Done thing",
+		"STATUS:COMPLETED",
+		"PRIORITY:0",
+		"END:VTODO",
+		"END:VCALENDAR",
+	}, "\n")
+
+	items, err := importICS(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(items))
+	}
+
+	event := items[0]
+	if event.Do.Description != "Planning" {
+		t.Errorf("Expected the alarm summary to be ignored, got %q", event.Do.Description)
+	}
+	if event.Do.ScheduledAt == nil || event.Do.ScheduledAt.UTC().Hour() != 10 {
+		t.Errorf("Expected the event to be scheduled at 10:00 UTC, got %v", event.Do.ScheduledAt)
+	}
+
+	todo := items[1]
+	if !todo.Do.Completed || todo.Do.CompletedAt == nil {
+		t.Error("Expected a completed todo without a timestamp to be completed now")
+	}
+	if todo.Do.Priority != Medium {
+		t.Errorf("Expected undefined priority to be medium, got %s", todo.Do.Priority)
+	}
+}
+
+func TestMapICSPriority(t *testing.T) {
+	for _, p := range []DoPrio{Low, Medium, High} {
+		if result := mapICSPriority(icsPriority(p)); result != p {
+			t.Errorf("Expected %s to round trip, got %s", p, result)
+		}
+	}
+}
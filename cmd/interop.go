@@ -0,0 +1,416 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"captain/logbook"
+
+	"github.com/spf13/cobra"
+)
+
+// exporter writes dos, preloaded with their Tags and Doc, in some format
+type exporter func(w io.Writer, dos []Do) error
+
+// importer reads dos from some format
+type importer func(r io.Reader) ([]importedDo, error)
+
+var exporters = map[string]exporter{
+	"ics":         exportICS,
+	"md":          exportMarkdown,
+	"todotxt":     exportTodoTxt,
+	"taskwarrior": exportTaskwarrior,
+}
+
+// importers also lists file extensions so the format can be inferred
+var importers = map[string]importer{
+	"ics":         importICS,
+	"md":          importMarkdown,
+	"todotxt":     importTodoTxt,
+	"txt":         importTodoTxt,
+	"taskwarrior": importTaskwarrior,
+	"json":        importTaskwarrior,
+}
+
+// importedDo is a do read from another format along with the crew it is for
+// and any documentation to attach to it. An empty Type or Priority, or a nil
+// date, leaves an existing do's value as it is.
+type importedDo struct {
+	Do   Do
+	Crew []string
+	Doc  string
+	// Categories are names that are only crew if they're in it already, so
+	// calendar categories, contexts and tags like @phone don't all become
+	// recruits.
+	Categories []string
+	// Parent is the position of the parent do in the import plus one, or 0
+	// for a top level do.
+	Parent int
+}
+
+func formatNames[T any](formats map[string]T) string {
+	var names []string
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "/")
+}
+
+// newUID creates a unique id for a do that's being exported for the first time
+func newUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate uid: %w", err)
+	}
+	return hex.EncodeToString(b) + "@captain", nil
+}
+
+// ensureUIDs gives every do without a UID a new one and saves it, so that
+// re-importing an export updates the same rows.
+func ensureUIDs(svc *logbook.Service, dos []Do) error {
+	var uids map[int]string
+	err := svc.Transaction(func(tx *logbook.Service) error {
+		// A retry starts over, the last try's uids were never saved
+		uids = map[int]string{}
+		for i := range dos {
+			if dos[i].UID != "" {
+				continue
+			}
+			uid, err := newUID()
+			if err != nil {
+				return err
+			}
+			_, err = tx.Update(dos[i].ID, func(do *Do) error {
+				do.UID = uid
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			uids[i] = uid
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i, uid := range uids {
+		dos[i].UID = uid
+	}
+	return nil
+}
+
+// findImported is the do exported with uid, scratched or promoted or not
+func findImported(svc *logbook.Service, uid string) (Do, bool, error) {
+	if uid == "" {
+		return Do{}, false, nil
+	}
+	dos, err := svc.Query(logbook.Query{UID: uid, Deleted: true, Promoted: true, Limit: 1})
+	if err != nil || len(dos) == 0 {
+		return Do{}, false, err
+	}
+	return dos[0], true, nil
+}
+
+// previewImport turns imported dos into dos for DoTable, using the id of the
+// existing do for any that would be updated.
+func previewImport(svc *logbook.Service, items []importedDo) ([]Do, error) {
+	var preview []Do
+	for _, item := range items {
+		do := item.Do
+
+		existing, found, err := findImported(svc, do.UID)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			do.ID = existing.ID
+		}
+		if do.Type == "" {
+			do.Type = existing.Type
+		}
+		if do.Type == "" {
+			do.Type = Task
+		}
+		if do.Priority == "" {
+			do.Priority = existing.Priority
+		}
+		if do.Priority == "" {
+			do.Priority = Medium
+		}
+
+		crew, err := importCrew(svc, item)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range crew {
+			do.Tags = append(do.Tags, Tag{Name: name})
+		}
+		do.Doc = DoDoc{Text: item.Doc}
+		preview = append(preview, do)
+	}
+	return preview, nil
+}
+
+// applyImport creates or, when a do with the same UID exists, updates each
+// imported do along with its crew and documentation. The dos are imported
+// all at once, or when one fails none of them are.
+func applyImport(svc *logbook.Service, items []importedDo) (created int, updated int, err error) {
+	err = svc.Transaction(func(tx *logbook.Service) error {
+		created, updated, err = importDos(tx, items)
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return created, updated, nil
+}
+
+// importDos makes the changes through svc so hooks run as they would for
+// the same change made by hand. A do that's since been scratched or
+// promoted is left as it is.
+func importDos(svc *logbook.Service, items []importedDo) (created int, updated int, err error) {
+	ids := make([]uint, len(items))
+
+	for i, item := range items {
+		do := item.Do
+
+		if item.Parent > 0 && item.Parent <= i {
+			parentID := ids[item.Parent-1]
+			do.ParentID = &parentID
+		}
+
+		existing, found, err := findImported(svc, do.UID)
+		if err != nil {
+			return created, updated, err
+		}
+
+		switch {
+		case found && (existing.Deleted || existing.Promoted):
+			ids[i] = existing.ID
+			continue
+		case found:
+			do, err = importChanges(svc, existing, do)
+			if err != nil {
+				return created, updated, fmt.Errorf("could not update do %d: %w", existing.ID, err)
+			}
+			updated++
+		default:
+			do, err = svc.AddDo(logbook.NewDo{Do: do, Doc: item.Doc})
+			if err != nil {
+				return created, updated, err
+			}
+			created++
+		}
+		ids[i] = do.ID
+
+		crew, err := importCrew(svc, item)
+		if err != nil {
+			return created, updated, err
+		}
+		if len(crew) > 0 {
+			if _, err := assignRecruiting(svc, do.ID, crew...); err != nil {
+				return created, updated, err
+			}
+		}
+
+		if found && strings.TrimSpace(item.Doc) != "" {
+			if _, err := svc.SetDoc(do.ID, item.Doc); err != nil {
+				return created, updated, err
+			}
+		}
+	}
+	return created, updated, nil
+}
+
+// importCrew is who an imported do is for: its crew and any of its
+// categories already in the crew
+func importCrew(svc *logbook.Service, item importedDo) ([]string, error) {
+	crew := item.Crew
+	for _, name := range item.Categories {
+		_, err := svc.Store().Tag(name)
+		if errors.Is(err, logbook.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		crew = append(crew, name)
+	}
+	return crew, nil
+}
+
+// importChanges updates existing with the fields an import gives,
+// completing it as the complete command would when it's newly done
+func importChanges(svc *logbook.Service, existing, do Do) (Do, error) {
+	changed, err := svc.Update(existing.ID, func(existing *Do) error {
+		existing.Description = do.Description
+		if do.Type != "" {
+			existing.Type = do.Type
+		}
+		if do.Priority != "" {
+			existing.Priority = do.Priority
+		}
+		if do.DueAt != nil {
+			existing.DueAt = do.DueAt
+		}
+		if do.ScheduledAt != nil {
+			existing.ScheduledAt = do.ScheduledAt
+		}
+		if do.ParentID != nil {
+			existing.ParentID = do.ParentID
+		}
+		if !do.Completed {
+			existing.Completed = false
+			existing.CompletedAt = nil
+		}
+		if do.Estimate > 0 {
+			existing.Estimate = do.Estimate
+		}
+		return nil
+	})
+	if err != nil || !do.Completed || existing.Completed {
+		// Keep the original completion time when it's already done
+		return changed, err
+	}
+
+	if _, err := svc.Complete(existing.ID); err != nil {
+		return changed, err
+	}
+	return svc.Update(existing.ID, func(existing *Do) error {
+		if do.CompletedAt != nil {
+			existing.CompletedAt = do.CompletedAt
+		}
+		return nil
+	})
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export [format] --format=<format> --all --file=<path>",
+	Short: "Export dos to another format",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		all, _ := cmd.Flags().GetBool("all")
+		path, _ := cmd.Flags().GetString("file")
+
+		if len(args) > 0 {
+			format = args[0]
+		}
+
+		export, ok := exporters[format]
+		if !ok {
+			return invalidf("no such format: '%s' (%s)", format, formatNames(exporters))
+		}
+
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+
+		query := logbook.Query{Sort: logbook.SortCreated, Asc: true}
+		if !all {
+			query.Completed = new(bool)
+		}
+
+		dos, err := svc.Query(query)
+		if err != nil {
+			return err
+		}
+
+		if err := ensureUIDs(svc, dos); err != nil {
+			return fmt.Errorf("could not assign uids: %w", err)
+		}
+
+		var w io.Writer = cmd.OutOrStdout()
+		if path != "" {
+			file, err := os.Create(path)
+			if err != nil {
+				return fmt.Errorf("could not create '%s': %w", path, err)
+			}
+			defer file.Close()
+			w = file
+		}
+
+		if err := export(w, dos); err != nil {
+			return fmt.Errorf("could not export: %w", err)
+		}
+
+		if path != "" {
+			fmt.Fprintf(cmd.OutOrStdout(), "Exported %d dos to %s\n", len(dos), path)
+		}
+		return nil
+	},
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import [format] <file> --dry-run",
+	Short: "Import dos from another format",
+	Long:  "Import dos from a file, the format is taken from the file extension unless given",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		path := args[len(args)-1]
+		format := strings.TrimPrefix(filepath.Ext(path), ".")
+		if len(args) == 2 {
+			format = args[0]
+		}
+
+		parse, ok := importers[format]
+		if !ok {
+			return invalidf("no such format: '%s' (%s)", format, formatNames(importers))
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return notFoundf("could not open '%s': %v", path, err)
+		}
+		defer file.Close()
+
+		items, err := parse(file)
+		if err != nil {
+			return invalidf("could not parse '%s': %v", path, err)
+		}
+
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+
+		if dryRun {
+			preview, err := previewImport(svc, items)
+			if err != nil {
+				return err
+			}
+			DoTable(cmd.OutOrStdout(), preview, false)
+			fmt.Fprintf(cmd.OutOrStdout(), "Dry run, %d dos would be imported\n", len(items))
+			return nil
+		}
+
+		created, updated, err := applyImport(svc, items)
+		if err != nil {
+			return fmt.Errorf("nothing was imported: %w", err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Imported %d new and updated %d dos\n", created, updated)
+		return nil
+	},
+}
+
+func init() {
+	exportCmd.Flags().String("format", "ics", fmt.Sprintf("Set the format (%s)", formatNames(exporters)))
+	exportCmd.Flags().Bool("all", false, "include completed dos")
+	exportCmd.Flags().StringP("file", "f", "", "Write to a file instead of stdout")
+
+	importCmd.Flags().Bool("dry-run", false, "Preview the dos without importing them")
+
+	RootCmd.AddCommand(exportCmd, importCmd)
+}
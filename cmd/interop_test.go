@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestApplyImportUpdatesByUID(t *testing.T) {
+	conn, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	items := []importedDo{
+		{
+			Do:   Do{UID: "one@captain", Description: "First", Type: Ask, Priority: Medium},
+			Crew: []string{"alice"},
+			Doc:  "Some notes",
+		},
+		{
+			Do: Do{Description: "No uid", Type: Task, Priority: Low},
+		},
+	}
+
+	created, updated, err := applyImport(testService(t, conn), items)
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if created != 2 || updated != 0 {
+		t.Errorf("Expected 2 created and 0 updated, got %d and %d", created, updated)
+	}
+
+	// Re-import with changes
+	items[0].Do.Description = "First, renamed"
+	items[0].Do.Completed = true
+	items[0].Crew = []string{"bob"}
+	items[0].Doc = "Updated notes"
+
+	created, updated, err = applyImport(testService(t, conn), items[:1])
+	if err != nil {
+		t.Fatalf("Failed to re-import: %v", err)
+	}
+	if created != 0 || updated != 1 {
+		t.Errorf("Expected 0 created and 1 updated, got %d and %d", created, updated)
+	}
+
+	var count int64
+	conn.Model(&Do{}).Count(&count)
+	if count != 2 {
+		t.Errorf("Expected 2 dos, got %d", count)
+	}
+
+	var fetched Do
+	if err := conn.Preload("Tags").Preload("Doc").Where("uid = ?", "one@captain").First(&fetched).Error; err != nil {
+		t.Fatalf("Failed to fetch do: %v", err)
+	}
+	if fetched.Description != "First, renamed" || !fetched.Completed {
+		t.Errorf("Expected the do to be updated, got %+v", fetched)
+	}
+	if len(fetched.Tags) != 1 || fetched.Tags[0].Name != "bob" {
+		t.Errorf("Expected to be reassigned to bob, got %v", fetched.Tags)
+	}
+	if fetched.Doc.Text != "Updated notes" {
+		t.Errorf("Expected doc to be updated, got %q", fetched.Doc.Text)
+	}
+
+	var docs int64
+	conn.Model(&DoDoc{}).Count(&docs)
+	if docs != 1 {
+		t.Errorf("Expected a single doc, got %d", docs)
+	}
+}
+
+func TestEnsureUIDs(t *testing.T) {
+	conn, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	dos := []Do{
+		{Description: "Needs one", Type: Task, Priority: Medium},
+		{Description: "Has one", Type: Task, Priority: Medium, UID: "kept@captain"},
+	}
+	for i := range dos {
+		conn.Create(&dos[i])
+	}
+
+	if err := ensureUIDs(testService(t, conn), dos); err != nil {
+		t.Fatalf("Failed to ensure uids: %v", err)
+	}
+
+	var fetched Do
+	conn.First(&fetched, dos[0].ID)
+	if fetched.UID == "" || fetched.UID != dos[0].UID {
+		t.Errorf("Expected a saved uid, got %q", fetched.UID)
+	}
+	if dos[1].UID != "kept@captain" {
+		t.Errorf("Expected existing uid to be kept, got %s", dos[1].UID)
+	}
+}
+
+func TestEnsureUIDsOnlyKeepsSavedUIDs(t *testing.T) {
+	conn, cleanup := setupTestDB(t)
+	defer cleanup()
+	refuseWrites(t, conn, "UPDATE", "dos", "NEW.description = 'Second'")
+
+	dos := []Do{
+		{Description: "First", Type: Task, Priority: Medium},
+		{Description: "Second", Type: Task, Priority: Medium},
+	}
+	for i := range dos {
+		conn.Create(&dos[i])
+	}
+
+	if err := ensureUIDs(testService(t, conn), dos); err == nil {
+		t.Fatal("Expected the uids not to be saved")
+	}
+	if dos[0].UID != "" {
+		t.Errorf("Expected no uid for a do whose uid was rolled back, got %q", dos[0].UID)
+	}
+}
+
+func TestApplyImportIsAllOrNothing(t *testing.T) {
+	conn, cleanup := setupTestDB(t)
+	defer cleanup()
+	refuseWrites(t, conn, "INSERT", "do_docs", "NEW.text = 'Broken notes'")
+
+	items := []importedDo{
+		{Do: Do{Description: "First", Type: Task, Priority: Medium}, Crew: []string{"alice"}},
+		{Do: Do{Description: "Second", Type: Task, Priority: Medium}, Doc: "Broken notes"},
+	}
+	created, updated, err := applyImport(testService(t, conn), items)
+	if err == nil || created != 0 || updated != 0 {
+		t.Fatalf("Expected the import to fail with nothing counted, got %d, %d, %v", created, updated, err)
+	}
+
+	var dos, tags int64
+	conn.Model(&Do{}).Count(&dos)
+	conn.Model(&Tag{}).Count(&tags)
+	if dos != 0 || tags != 0 {
+		t.Errorf("Expected nothing imported, got %d dos and %d tags", dos, tags)
+	}
+}
+
+func TestApplyImportOnlyAssignsKnownCategories(t *testing.T) {
+	conn, cleanup := setupTestDB(t)
+	defer cleanup()
+	svc := testService(t, conn)
+	svc.Recruit("alice")
+
+	items := []importedDo{
+		{Do: Do{Description: "From a calendar", Type: Task, Priority: Medium}, Categories: []string{"alice", "Work"}},
+	}
+	if _, _, err := applyImport(svc, items); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+
+	var do Do
+	conn.Preload("Tags").First(&do)
+	if len(do.Tags) != 1 || do.Tags[0].Name != "alice" {
+		t.Errorf("Expected the do to be for alice only, got %v", do.Tags)
+	}
+	var tags int64
+	conn.Model(&Tag{}).Count(&tags)
+	if tags != 1 {
+		t.Errorf("Expected no one recruited from a category, got %d tags", tags)
+	}
+}
@@ -2,18 +2,19 @@ package cmd
 
 import (
 	"fmt"
-	"log"
-	"os"
+	"io"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
+
+	"captain/logbook"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/lipgloss/table"
 	"github.com/fatih/color"
 	"github.com/mattn/go-runewidth"
 	sebtable "github.com/s3bw/table"
-	"gorm.io/gorm"
 )
 
 type checkBox string
@@ -88,6 +89,39 @@ func fmtDate(task Do) string {
 	return colour.Sprintf("%s", date.Format("02-Jan-06 15:04"))
 }
 
+// fmtMinutes renders a number of minutes as a short duration, e.g. 1h30m or
+// 1d2h. A day is 24 hours.
+func fmtMinutes(minutes int) string {
+	if minutes <= 0 {
+		return "-"
+	}
+
+	d := time.Duration(minutes) * time.Minute
+	days := int(d.Hours()) / 24
+	hours := int(d.Hours()) % 24
+	mins := minutes % 60
+
+	var parts []string
+	if days > 0 {
+		parts = append(parts, fmt.Sprintf("%dd", days))
+	}
+	if hours > 0 {
+		parts = append(parts, fmt.Sprintf("%dh", hours))
+	}
+	if mins > 0 || len(parts) == 0 {
+		parts = append(parts, fmt.Sprintf("%dm", mins))
+	}
+	return strings.Join(parts, "")
+}
+
+// fmtDay renders an optional date as a day, or "-" when unset
+func fmtDay(date *time.Time) string {
+	if date == nil {
+		return "-"
+	}
+	return date.Format("02-Jan-06")
+}
+
 var ansiRegex = regexp.MustCompile(`\x1b\[[0-9;]*m`)
 
 func stripANSI(s string) string {
@@ -98,17 +132,23 @@ func WidthFunc(s string) int {
 	return runewidth.StringWidth(stripANSI(s))
 }
 
-func DoLog(conn *gorm.DB, query *gorm.DB, unhide bool) {
-	var tasks []Do
-
-	if err := query.Preload("Doc").Preload("Tags").Find(&tasks).Error; err != nil {
-		log.Fatalf("could not fetch tasks: %v", err)
+func DoLog(w io.Writer, svc *logbook.Service, query logbook.Query, unhide bool) error {
+	tasks, err := svc.Query(query)
+	if err != nil {
+		return err
 	}
 
+	DoTable(w, tasks, unhide)
+	return nil
+}
+
+// DoTable prints dos as the log table. Dos that haven't been saved yet, such
+// as an import preview, are shown with an id of "new".
+func DoTable(w io.Writer, tasks []Do, unhide bool) {
 	if len(tasks) == 0 {
-		fmt.Println("No tasks found.")
+		fmt.Fprintln(w, "No tasks found.")
 	} else {
-		re := lipgloss.NewRenderer(os.Stdout)
+		re := lipgloss.NewRenderer(w)
 		baseStyle := re.NewStyle().Padding(0, 1)
 
 		// Header
@@ -119,16 +159,24 @@ func DoLog(conn *gorm.DB, query *gorm.DB, unhide bool) {
 
 		for _, task := range tasks {
 			docIndicator := ""
-			if task.Doc.ID != 0 { // If Doc exists, it will have a non-zero ID
+			if task.Doc.ID != 0 || task.Doc.Text != "" { // If Doc exists, it will have a non-zero ID
 				docIndicator = "✻"
 			}
 
+			id := strconv.Itoa(int(task.ID))
+			if task.ID == 0 {
+				id = "new"
+			}
+
 			tag := ""
 			if len(task.Tags) > 0 {
 				tag = task.Tags[0].Name
 			}
 
 			taskType := fmtDo(task)
+			if task.Git != nil {
+				taskType += " " + fmtGit(*task.Git)
+			}
 			checkBx := fmtBox(task)
 			prio := fmtPrio(task)
 
@@ -139,7 +187,7 @@ func DoLog(conn *gorm.DB, query *gorm.DB, unhide bool) {
 
 			data = append(data, []string{
 				string(checkBx),
-				strconv.Itoa(int(task.ID)),
+				id,
 				description,
 				fmtDate(task),
 				docIndicator,
@@ -180,17 +228,17 @@ func DoLog(conn *gorm.DB, query *gorm.DB, unhide bool) {
 				return baseStyle.Foreground(lipgloss.Color("245"))
 			})
 
-		fmt.Println(t)
+		fmt.Fprintln(w, t)
 	}
 }
 
-func CrewLog(crew []Mate) {
+func CrewLog(w io.Writer, crew []Mate) {
 	if len(crew) == 0 {
-		fmt.Println("We've got no crew!")
+		fmt.Fprintln(w, "We've got no crew!")
 		return
 	}
 
-	tbl := sebtable.New("name", "count")
+	tbl := sebtable.New("name", "count").WithWriter(w)
 	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
 	tbl.WithHeaderFormatter(headerFmt)
 
@@ -201,26 +249,30 @@ func CrewLog(crew []Mate) {
 	tbl.Print()
 }
 
-func DoDetails(conn *gorm.DB, query *gorm.DB) {
-	var task Do
-	if err := query.Preload("Doc").Preload("Tags").First(&task).Error; err != nil {
-		log.Fatalf("could not fetch task: %v", err)
-	}
-
-	fmt.Printf("[id=%d]: \t%s\n", task.ID, highlightStyle.Render(task.Description))
+func DoDetails(w io.Writer, task Do) {
+	fmt.Fprintf(w, "[id=%d]: \t%s\n", task.ID, highlightStyle.Render(task.Description))
 	// Fix display of tags on a single line
 	tagString := ""
 	for _, tag := range task.Tags {
 		tagString += tag.Name
 	}
-	fmt.Printf("for: \t\t%s\n", tagString)
-	fmt.Printf("type: \t\t%s\n", fmtDo(task))
-	fmt.Printf("prio: \t\t%s\n", fmtPrio(task))
-	fmt.Printf("pinned: \t%s\n", fmtBool(task.Pinned))
-	fmt.Printf("sensitive: \t%s\n", fmtBool(task.Sensitive))
-	fmt.Printf("deleted: \t%s\n", fmtBool(task.Deleted))
-	fmt.Printf("reason: \t%s\n", fmtReason(task))
-	fmt.Printf("doc: \t\t%s\n", fmtBool(task.Doc.ID != 0))
-	fmt.Printf("created_at: \t%s\n", task.CreatedAt)
-	fmt.Printf("completed_at: \t%s\n", task.CompletedAt)
+	fmt.Fprintf(w, "for: \t\t%s\n", tagString)
+	fmt.Fprintf(w, "type: \t\t%s\n", fmtDo(task))
+	fmt.Fprintf(w, "prio: \t\t%s\n", fmtPrio(task))
+	fmt.Fprintf(w, "estimate: \t%s\n", fmtMinutes(task.Estimate))
+	fmt.Fprintf(w, "due: \t\t%s\n", fmtDay(task.DueAt))
+	fmt.Fprintf(w, "scheduled: \t%s\n", fmtDay(task.ScheduledAt))
+	if task.ParentID != nil {
+		fmt.Fprintf(w, "parent: \t%d\n", *task.ParentID)
+	}
+	if task.Git != nil {
+		fmt.Fprintf(w, "branch: \t%s %s\n", task.Git.Branch, fmtGit(*task.Git))
+	}
+	fmt.Fprintf(w, "pinned: \t%s\n", fmtBool(task.Pinned))
+	fmt.Fprintf(w, "sensitive: \t%s\n", fmtBool(task.Sensitive))
+	fmt.Fprintf(w, "deleted: \t%s\n", fmtBool(task.Deleted))
+	fmt.Fprintf(w, "reason: \t%s\n", fmtReason(task))
+	fmt.Fprintf(w, "doc: \t\t%s\n", fmtBool(task.Doc.ID != 0))
+	fmt.Fprintf(w, "created_at: \t%s\n", task.CreatedAt)
+	fmt.Fprintf(w, "completed_at: \t%s\n", task.CompletedAt)
 }
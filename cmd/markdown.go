@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	mdItem    = regexp.MustCompile(`^(\s*)[-*+] \[([ xX])\] (.*)$`)
+	mdHeading = regexp.MustCompile(`^#+\s+(.*)$`)
+	mdID      = regexp.MustCompile(`\s*<!--\s*captain:(\S+)\s*-->`)
+	mdMention = regexp.MustCompile(`(^|\s)@([\w.-]+)`)
+)
+
+// mdTypes is the order types are grouped in when exporting
+var mdTypes = []DoType{Task, Ask, Tell, Brag, Learn, PR, Meta}
+
+// exportMarkdown writes a checklist grouped by type, with children nested
+// under their parent. Each item ends with its uid in a comment so that a
+// re-import matches it to the same do.
+func exportMarkdown(w io.Writer, dos []Do) error {
+	present := map[uint]bool{}
+	children := map[uint][]Do{}
+	for _, do := range dos {
+		present[do.ID] = true
+	}
+	for _, do := range dos {
+		if do.ParentID != nil && present[*do.ParentID] {
+			children[*do.ParentID] = append(children[*do.ParentID], do)
+		}
+	}
+
+	var write func(do Do, depth int) error
+	write = func(do Do, depth int) error {
+		box := " "
+		if do.Completed {
+			box = "x"
+		}
+
+		line := strings.Repeat("  ", depth) + fmt.Sprintf("- [%s] %s", box, strings.ReplaceAll(do.Description, "\n", " "))
+		for _, tag := range do.Tags {
+			line += " @" + tag.Name
+		}
+		line += fmt.Sprintf(" <!-- captain:%s -->", do.UID)
+
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+		for _, child := range children[do.ID] {
+			if err := write(child, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	first := true
+	for _, doType := range mdTypes {
+		var group []Do
+		for _, do := range dos {
+			isChild := do.ParentID != nil && present[*do.ParentID]
+			if do.Type == doType && !isChild {
+				group = append(group, do)
+			}
+		}
+		if len(group) == 0 {
+			continue
+		}
+
+		if !first {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		if _, err := fmt.Fprintf(w, "## %s\n\n", doType); err != nil {
+			return err
+		}
+		for _, do := range group {
+			if err := write(do, 0); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mdIndent measures leading whitespace, counting a tab as four spaces
+func mdIndent(s string) int {
+	width := 0
+	for _, r := range s {
+		if r == '\t' {
+			width += 4
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+// importMarkdown reads "- [ ]" checklist items. Unchecked items become dos,
+// checked items only complete dos already matched by their uid comment,
+// indented items are children, and @mentions are crew. A heading naming a
+// do type sets the type of the items under it.
+func importMarkdown(r io.Reader) ([]importedDo, error) {
+	var items []importedDo
+
+	type open struct {
+		indent int
+		index  int // position in items plus one, 0 when skipped
+	}
+	var stack []open
+	var headingType DoType
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if m := mdHeading.FindStringSubmatch(line); m != nil {
+			heading := strings.TrimSpace(m[1])
+			headingType = ""
+			if isDoType(heading) {
+				headingType = mapType(heading)
+			}
+			stack = nil
+			continue
+		}
+
+		m := mdItem.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		indent := mdIndent(m[1])
+		checked := m[2] != " "
+		text := m[3]
+
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		parent := 0
+		if len(stack) > 0 {
+			parent = stack[len(stack)-1].index
+		}
+
+		item := importedDo{Parent: parent}
+		item.Do.Type = headingType
+
+		if id := mdID.FindStringSubmatch(text); id != nil {
+			item.Do.UID = id[1]
+			text = mdID.ReplaceAllString(text, "")
+		}
+
+		for _, mention := range mdMention.FindAllStringSubmatch(text, -1) {
+			item.Crew = append(item.Crew, mention[2])
+		}
+		text = mdMention.ReplaceAllString(text, "")
+		item.Do.Description = strings.Join(strings.Fields(text), " ")
+
+		// Checked items we've never seen are already done, nothing to track
+		if item.Do.Description == "" || (checked && item.Do.UID == "") {
+			stack = append(stack, open{indent: indent})
+			continue
+		}
+
+		if checked {
+			now := time.Now()
+			item.Do.Completed = true
+			item.Do.CompletedAt = &now
+		}
+
+		items = append(items, item)
+		stack = append(stack, open{indent: indent, index: len(items)})
+	}
+
+	return items, scanner.Err()
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestImportMarkdown(t *testing.T) {
+	input := `# Standup 12-Mar
+
+Some prose that isn't a checklist.
+
+- [ ] Write the migration
+  - [ ] Backfill the status @alice
+    - [ ] Check the counts
+- [x] Something done before captain knew about it
+  - [ ] Follow up on it
+- [x] Finished this <!-- captain:abc@captain -->
+
+## ask
+
+- [ ] When is the freeze? @bob @carol
+`
+
+	items, err := importMarkdown(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+
+	if len(items) != 6 {
+		t.Fatalf("Expected 6 items, got %d: %+v", len(items), items)
+	}
+
+	expected := []struct {
+		description string
+		parent      int
+		crew        string
+		doType      DoType
+	}{
+		{"Write the migration", 0, "", ""},
+		{"Backfill the status", 1, "alice", ""},
+		{"Check the counts", 2, "", ""},
+		{"Follow up on it", 0, "", ""},
+		{"Finished this", 0, "", ""},
+		{"When is the freeze?", 0, "bob,carol", Ask},
+	}
+
+	for i, e := range expected {
+		item := items[i]
+		if item.Do.Description != e.description {
+			t.Errorf("Item %d: expected %q, got %q", i, e.description, item.Do.Description)
+		}
+		if item.Parent != e.parent {
+			t.Errorf("Item %d: expected parent %d, got %d", i, e.parent, item.Parent)
+		}
+		if strings.Join(item.Crew, ",") != e.crew {
+			t.Errorf("Item %d: expected crew %q, got %v", i, e.crew, item.Crew)
+		}
+		if item.Do.Type != e.doType {
+			t.Errorf("Item %d: expected type %q, got %q", i, e.doType, item.Do.Type)
+		}
+	}
+
+	finished := items[4]
+	if finished.Do.UID != "abc@captain" || !finished.Do.Completed {
+		t.Errorf("Expected the checked item to complete abc@captain, got %+v", finished.Do)
+	}
+}
+
+func TestMarkdownRoundTrip(t *testing.T) {
+	conn, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	items, err := importMarkdown(strings.NewReader("- [ ] Parent @alice\n  - [ ] Child\n- [ ] Other\n"))
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if _, _, err := applyImport(testService(t, conn), items); err != nil {
+		t.Fatalf("Failed to apply import: %v", err)
+	}
+
+	var dos []Do
+	conn.Preload("Tags").Order("id").Find(&dos)
+	if len(dos) != 3 {
+		t.Fatalf("Expected 3 dos, got %d", len(dos))
+	}
+	if dos[1].ParentID == nil || *dos[1].ParentID != dos[0].ID {
+		t.Errorf("Expected the child to point at its parent, got %v", dos[1].ParentID)
+	}
+	if err := ensureUIDs(testService(t, conn), dos); err != nil {
+		t.Fatalf("Failed to ensure uids: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := exportMarkdown(&buf, dos); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "## task") {
+		t.Errorf("Expected items to be grouped by type, got:\n%s", out)
+	}
+	if !strings.Contains(out, "\n  - [ ] Child <!-- captain:") {
+		t.Errorf("Expected the child to be nested, got:\n%s", out)
+	}
+	if !strings.Contains(out, "- [ ] Parent @alice <!-- captain:") {
+		t.Errorf("Expected crew as mentions, got:\n%s", out)
+	}
+
+	// Tick the child off and re-import
+	ticked := strings.Replace(out, "- [ ] Child", "- [x] Child", 1)
+	items, err = importMarkdown(strings.NewReader(ticked))
+	if err != nil {
+		t.Fatalf("Failed to re-import: %v", err)
+	}
+	created, updated, err := applyImport(testService(t, conn), items)
+	if err != nil {
+		t.Fatalf("Failed to apply re-import: %v", err)
+	}
+	if created != 0 || updated != 3 {
+		t.Errorf("Expected 0 created and 3 updated, got %d and %d", created, updated)
+	}
+
+	var child Do
+	conn.Preload("Tags").First(&child, dos[1].ID)
+	if !child.Completed || child.CompletedAt == nil {
+		t.Error("Expected the ticked child to be completed")
+	}
+
+	var parent Do
+	conn.Preload("Tags").First(&parent, dos[0].ID)
+	if parent.Completed || len(parent.Tags) != 1 || parent.Priority != Medium {
+		t.Errorf("Expected the parent to be unchanged, got %+v", parent)
+	}
+}
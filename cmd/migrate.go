@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+
+	"captain/logbook"
+
+	"github.com/fatih/color"
+	sebtable "github.com/s3bw/table"
+	"github.com/spf13/cobra"
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manage the logbook database",
+}
+
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Run the schema migrations, backing the database up first",
+	Long: `Run the schema migrations the database is missing. With --to the
+database is taken to that version instead, undoing newer migrations where
+they can be undone. A backup is made in the backups directory before any
+migration runs.
+
+Every command migrates the database to the latest version this captain knows
+about, so a --to below it is undone again by the next command. Use it right
+before switching to an older captain, whose latest version it is.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+
+		version := logbook.Latest(logbook.Migrations)
+		if cmd.Flags().Changed("to") {
+			version, _ = cmd.Flags().GetInt("to")
+		}
+
+		conn, err := logbook.Connect(dbPath(&cfg))
+		if err != nil {
+			return err
+		}
+		backup, ran, err := logbook.Migrate(conn, dbPath(&cfg), logbook.Migrations, version)
+		if backup != "" {
+			fmt.Fprintf(out, "Backed up to %s\n", backup)
+		}
+		for _, step := range ran {
+			fmt.Fprintf(out, "Migrated %s\n", step)
+		}
+		if err != nil {
+			return err
+		}
+		if len(ran) == 0 {
+			fmt.Fprintf(out, "Already at version %d\n", version)
+		}
+		if latest := logbook.Latest(logbook.Migrations); version < latest {
+			fmt.Fprintf(out, "The next command migrates it back to version %d, switch to an older captain first\n", latest)
+		}
+		return nil
+	},
+}
+
+var dbStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show which schema migrations have been applied",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conn, err := logbook.Connect(dbPath(&cfg))
+		if err != nil {
+			return err
+		}
+		statuses, err := logbook.Statuses(conn, logbook.Migrations)
+		if err != nil {
+			return err
+		}
+
+		tbl := sebtable.New("version", "name", "applied").WithWriter(cmd.OutOrStdout())
+		headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+		tbl.WithHeaderFormatter(headerFmt)
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format("2006-01-02 15:04")
+			}
+			tbl.AddRow(status.Version, status.Name, applied)
+		}
+		tbl.Print()
+		return nil
+	},
+}
+
+func init() {
+	dbMigrateCmd.Flags().Int("to", 0, "schema version to migrate to, the latest by default")
+	dbCmd.AddCommand(dbMigrateCmd, dbStatusCmd)
+	RootCmd.AddCommand(dbCmd)
+}
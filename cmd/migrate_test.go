@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"captain/logbook"
+)
+
+func TestDBMigrateCommands(t *testing.T) {
+	out, err := runCaptain(t, nil, "db", "migrate", "--to", "1")
+	if err != nil || !strings.Contains(out, "Migrated 1 initial schema") {
+		t.Fatalf("Expected the first migration, got %q, %v", out, err)
+	}
+	if strings.Contains(out, "Backed up") {
+		t.Errorf("Expected no backup of a new database, got %q", out)
+	}
+
+	out, err = runCaptain(t, nil, "db", "status")
+	if err != nil || strings.Count(out, "pending") != 2 || !strings.Contains(out, "index docs by do") {
+		t.Errorf("Expected only migrations 2 and 3 to be pending, got %q, %v", out, err)
+	}
+
+	out, err = runCaptain(t, nil, "db", "migrate")
+	if err != nil || !strings.Contains(out, "Backed up to") || !strings.Contains(out, "Migrated 2 index docs by do") {
+		t.Errorf("Expected a backup then migrations 2 and 3, got %q, %v", out, err)
+	}
+
+	out, err = runCaptain(t, nil, "db", "migrate", "--to", "1")
+	if err != nil || !strings.Contains(out, "Migrated 2 index docs by do (down)") {
+		t.Errorf("Expected migrations 3 and 2 undone, got %q, %v", out, err)
+	}
+	if !strings.Contains(out, "The next command migrates it back to version 3") {
+		t.Errorf("Expected a warning that it doesn't last, got %q", out)
+	}
+
+	out, err = runCaptain(t, nil, "db", "migrate", "--to", "9")
+	if !errors.Is(err, logbook.ErrInvalid) {
+		t.Errorf("Expected ErrInvalid for an unknown version, got %q, %v", out, err)
+	}
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const pluginPrefix = "captain-"
+
+// plugin is an executable named captain-<name> that runs as `captain <name>`
+type plugin struct {
+	Name string
+	Path string
+}
+
+func pluginsDir(cfg *Config) string {
+	return filepath.Join(cfg.CaptainDir, "plugins")
+}
+
+// discoverPlugins finds captain-* executables in dirs. When a name is found
+// more than once the first directory wins, as with PATH.
+func discoverPlugins(dirs []string) []plugin {
+	seen := map[string]bool{}
+	var plugins []plugin
+
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := strings.CutPrefix(entry.Name(), pluginPrefix)
+			if !ok || name == "" || seen[name] {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if !isExecutable(path) {
+				continue
+			}
+			seen[name] = true
+			plugins = append(plugins, plugin{Name: name, Path: path})
+		}
+	}
+
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+	return plugins
+}
+
+// pluginEnv passes the resolved config on to a plugin
+func pluginEnv(cfg *Config) []string {
+	return []string{
+		"CAPTAIN_DIR=" + cfg.CaptainDir,
+		"CAPTAIN_DB=" + dbPath(cfg),
+		"CAPTAIN_PROFILE=" + cfg.Profile,
+		"CAPTAIN_LOOKBACK_DAYS=" + strconv.Itoa(cfg.LookBackDays),
+		"CAPTAIN_LOG_LENGTH=" + strconv.Itoa(cfg.LogLength),
+	}
+}
+
+// pluginExit is a plugin that exited with a status other than 0, which
+// captain exits with too
+type pluginExit struct {
+	name string
+	code int
+}
+
+func (e *pluginExit) Error() string {
+	return fmt.Sprintf("plugin '%s' exited with status %d", e.name, e.code)
+}
+
+func pluginCommand(p plugin) *cobra.Command {
+	return &cobra.Command{
+		Use:                p.Name,
+		Short:              fmt.Sprintf("Plugin (%s)", p.Path),
+		DisableFlagParsing: true,
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return nil, cobra.ShellCompDirectiveDefault
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			plugin := exec.Command(p.Path, args...)
+			plugin.Stdin = cmd.InOrStdin()
+			plugin.Stdout = cmd.OutOrStdout()
+			plugin.Stderr = cmd.ErrOrStderr()
+			plugin.Env = append(os.Environ(), pluginEnv(&cfg)...)
+
+			// A plugin reports its own errors, captain exits as it did
+			err := plugin.Run()
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				cmd.SilenceErrors = true
+				return &pluginExit{name: p.Name, code: exitErr.ExitCode()}
+			}
+			if err != nil {
+				return fmt.Errorf("could not run plugin '%s': %w", p.Name, err)
+			}
+			return nil
+		},
+	}
+}
+
+// addPlugins registers plugins from the captain directory and PATH as
+// subcommands, skipping any that would shadow a built in command.
+func addPlugins(root *cobra.Command, cfg *Config) {
+	dirs := append([]string{pluginsDir(cfg)}, filepath.SplitList(os.Getenv("PATH"))...)
+
+	for _, p := range discoverPlugins(dirs) {
+		// Cobra adds these itself when it runs
+		if p.Name == "help" || p.Name == "completion" || strings.HasPrefix(p.Name, "__") {
+			continue
+		}
+		if existing, _, err := root.Find([]string{p.Name}); err == nil && existing != root {
+			continue
+		}
+		root.AddCommand(pluginCommand(p))
+	}
+}
+
+// Execute runs captain, with any plugins available as subcommands. Errors
+// are reported on stderr before it returns; ExitCode gives the status to exit
+// with.
+func Execute() error {
+	// A config that can't be loaded is reported when the command runs
+	if early, err := earlyConfig(os.Args[1:]); err == nil {
+		addPlugins(RootCmd, &early)
+	}
+	return execute(RootCmd)
+}
+
+// earlyConfig loads the config before cobra has parsed the arguments, to
+// find the plugins with.
+func earlyConfig(args []string) (Config, error) {
+	flags := pflag.NewFlagSet("early", pflag.ContinueOnError)
+	flags.ParseErrorsWhitelist.UnknownFlags = true
+	flags.SetOutput(io.Discard)
+	path := flags.String("config", "", "")
+	profile := flags.String("profile", "", "")
+	// Only --config and --profile matter, the command reports the rest
+	_ = flags.Parse(args)
+	return LoadConfig(*path, *profile)
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func writePlugin(t *testing.T, dir, name string, mode os.FileMode) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), mode); err != nil {
+		t.Fatalf("Failed to write plugin: %v", err)
+	}
+}
+
+func TestDiscoverPlugins(t *testing.T) {
+	first := t.TempDir()
+	second := t.TempDir()
+
+	writePlugin(t, first, "captain-report", 0o755)
+	writePlugin(t, first, "captain-notes.txt", 0o644)
+	writePlugin(t, first, "other-tool", 0o755)
+	writePlugin(t, second, "captain-report", 0o755)
+	writePlugin(t, second, "captain-burndown", 0o755)
+	os.Mkdir(filepath.Join(second, "captain-dir"), 0o755)
+
+	plugins := discoverPlugins([]string{first, "", filepath.Join(first, "missing"), second})
+
+	expected := []plugin{
+		{Name: "burndown", Path: filepath.Join(second, "captain-burndown")},
+		{Name: "report", Path: filepath.Join(first, "captain-report")},
+	}
+	if !slices.Equal(plugins, expected) {
+		t.Errorf("Expected %v, got %v", expected, plugins)
+	}
+}
+
+func TestAddPlugins(t *testing.T) {
+	dir := t.TempDir()
+	writePlugin(t, dir, "captain-burndown", 0o755)
+	writePlugin(t, dir, "captain-log", 0o755)
+	writePlugin(t, dir, "captain-help", 0o755)
+	t.Setenv("PATH", "")
+
+	root := &cobra.Command{Use: "cap"}
+	root.AddCommand(&cobra.Command{Use: "log", Run: func(*cobra.Command, []string) {}})
+
+	addPlugins(root, &Config{CaptainDir: filepath.Dir(dir)})
+	if len(root.Commands()) != 1 {
+		t.Fatalf("Expected no plugins outside the plugins directory, got %d commands", len(root.Commands()))
+	}
+
+	os.Rename(dir, filepath.Join(filepath.Dir(dir), "plugins"))
+	addPlugins(root, &Config{CaptainDir: filepath.Dir(dir)})
+
+	var names []string
+	for _, c := range root.Commands() {
+		names = append(names, c.Name())
+	}
+	if !slices.Equal(names, []string{"burndown", "log"}) {
+		t.Errorf("Expected burndown to be added without shadowing log, got %v", names)
+	}
+}
+
+func TestPluginEnv(t *testing.T) {
+	env := pluginEnv(&Config{CaptainDir: "/home/me/.captain", DBFile: "do.db", Profile: "work", LookBackDays: 7, LogLength: 10})
+
+	for _, expected := range []string{
+		"CAPTAIN_DIR=/home/me/.captain",
+		"CAPTAIN_DB=/home/me/.captain/do.db",
+		"CAPTAIN_PROFILE=work",
+	} {
+		if !slices.Contains(env, expected) {
+			t.Errorf("Expected %s in %v", expected, env)
+		}
+	}
+}
+
+func TestPluginExitsAsItDid(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\nread line\necho \"out $line $1\"\necho err >&2\nexit 3\n"
+	os.WriteFile(filepath.Join(dir, "captain-report"), []byte(script), 0o755)
+
+	// As RootCmd does once a command runs
+	root := &cobra.Command{Use: "cap", SilenceUsage: true}
+	root.AddCommand(pluginCommand(plugin{Name: "report", Path: filepath.Join(dir, "captain-report")}))
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	root.SetIn(strings.NewReader("in\n"))
+	root.SetOut(stdout)
+	root.SetErr(stderr)
+	root.SetArgs([]string{"report", "--weekly"})
+
+	err := root.Execute()
+	if code := ExitCode(err); code != 3 {
+		t.Errorf("Expected the plugin's exit status, got %d (%v)", code, err)
+	}
+	if stdout.String() != "out in --weekly\n" {
+		t.Errorf("Expected the plugin's stdout, got %q", stdout.String())
+	}
+	if stderr.String() != "err\n" {
+		t.Errorf("Expected only the plugin's stderr, got %q", stderr.String())
+	}
+}
@@ -0,0 +1,307 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"captain/logbook"
+
+	"github.com/fatih/color"
+	sebtable "github.com/s3bw/table"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+const (
+	prOpen    = "open"
+	prMerged  = "merged"
+	prDeleted = "deleted"
+	prMissing = "missing"
+)
+
+// prBases are the branches a PR merges into when none is given
+var prBases = []string{"main", "master"}
+
+// baseTips resolves the base branch, locally and on origin, to its commits
+func baseTips(repo *gitRepo, base string) ([]string, error) {
+	candidates := prBases
+	if base != "" {
+		candidates = []string{base}
+	}
+
+	for _, name := range candidates {
+		var tips []string
+		for _, ref := range []string{"refs/heads/" + name, "refs/remotes/origin/" + name} {
+			hash, err := repo.readRef(ref)
+			if errors.Is(err, errGitRefNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			tips = append(tips, hash)
+		}
+		if len(tips) > 0 {
+			return tips, nil
+		}
+	}
+	return nil, fmt.Errorf("no base branch found (tried %v)", candidates)
+}
+
+// checkBranch works out the state of the link's branch. A branch is merged
+// when its commits are reachable from the base. One still sitting on the
+// base's tip is only merged if it has been seen ahead of it before, as it
+// could otherwise be a branch with no commits yet. A deleted branch whose
+// last seen commit is in the base was merged too, by the same rule.
+//
+// Squash and rebase merges put new commits on the base, so a branch merged
+// that way is still open, or deleted once it's removed, and its do has to
+// be completed by hand.
+func checkBranch(repo *gitRepo, link GitLink) (GitLink, error) {
+	tips, err := baseTips(repo, link.Base)
+	if err != nil {
+		return link, err
+	}
+
+	merged, err := repo.reachable(tips...)
+	if err != nil {
+		return link, err
+	}
+
+	// A branch on the base's tip is only merged if it had commits of its own
+	seenAhead := link.State == prMerged || link.Ahead > 0
+	isTip := func(head string) bool {
+		return slices.Contains(tips, head)
+	}
+
+	head, err := repo.readRef("refs/heads/" + link.Branch)
+	if errors.Is(err, errGitRefNotFound) {
+		head, err = repo.readRef("refs/remotes/origin/" + link.Branch)
+	}
+	if errors.Is(err, errGitRefNotFound) {
+		link.Ahead = 0
+		link.State = prDeleted
+		if link.Head != "" && merged[link.Head] && (!isTip(link.Head) || seenAhead) {
+			link.State = prMerged
+		}
+		return link, nil
+	}
+	if err != nil {
+		return link, err
+	}
+
+	switch {
+	case merged[head] && (!isTip(head) || seenAhead):
+		link.State = prMerged
+		link.Ahead = 0
+	default:
+		link.State = prOpen
+		link.Ahead, err = repo.ahead(head, merged)
+		if err != nil {
+			return link, err
+		}
+	}
+	link.Head = head
+	return link, nil
+}
+
+// syncLink refreshes a link from its repository and completes the do when
+// the branch has been merged.
+func syncLink(svc *logbook.Service, link GitLink) (GitLink, error) {
+	repo, err := openGitRepo(link.Repo)
+	if err != nil {
+		link.State = prMissing
+	} else if link, err = checkBranch(repo, link); err != nil {
+		return link, err
+	}
+
+	now := time.Now()
+	link.SyncedAt = &now
+
+	// The link is saved with the do it completes
+	err = svc.Transaction(func(tx *logbook.Service) error {
+		conn, err := storeConn(tx)
+		if err != nil {
+			return err
+		}
+		if err := conn.Save(&link).Error; err != nil {
+			return logbook.StorageError("save link", err)
+		}
+
+		if link.State != prMerged {
+			return nil
+		}
+		_, err = tx.Complete(link.DoID)
+		return err
+	})
+	return link, err
+}
+
+// fmtGit shows the state of a linked branch, e.g. "merged" or "+3"
+func fmtGit(link GitLink) string {
+	switch link.State {
+	case prMerged:
+		return color.New(color.FgMagenta).Sprintf("merged")
+	case prOpen:
+		return color.New(color.FgGreen).Sprintf("+%d", link.Ahead)
+	case prDeleted, prMissing:
+		return color.New(color.FgHiBlack).Sprintf("%s", link.State)
+	default:
+		return ""
+	}
+}
+
+func PRLog(w io.Writer, links []GitLink, dos map[uint]Do) {
+	tbl := sebtable.New("#", "do", "repo", "branch", "state").WithWriter(w)
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	tbl.WithHeaderFormatter(headerFmt)
+
+	for _, link := range links {
+		tbl.AddRow(link.DoID, dos[link.DoID].Description, link.Repo, link.Branch, fmtGit(link))
+	}
+	tbl.Print()
+}
+
+var prCmd = &cobra.Command{
+	Use:   "pr",
+	Short: "Link PR dos to git branches",
+}
+
+var prLinkCmd = &cobra.Command{
+	Use:   "link <do_id> --repo=<path> --branch=<branch> --base=<branch>",
+	Short: "Link a do to a branch in a local repository",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
+		}
+		path, _ := cmd.Flags().GetString("repo")
+		branch, _ := cmd.Flags().GetString("branch")
+		base, _ := cmd.Flags().GetString("base")
+
+		repo, err := openGitRepo(path)
+		if err != nil {
+			return fmt.Errorf("could not open repository: %w", err)
+		}
+
+		if branch == "" {
+			branch = repo.currentBranch()
+		}
+		if branch == "" {
+			return invalidf("HEAD is detached, pass --branch")
+		}
+
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+		conn, err := storeConn(svc)
+		if err != nil {
+			return err
+		}
+
+		do, err := svc.Get(id)
+		if err != nil {
+			return err
+		}
+
+		// Relinking a do keeps its link, with the new branch
+		var link GitLink
+		err = conn.Where("do_id = ?", do.ID).First(&link).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return logbook.StorageError("fetch link", err)
+		}
+		link.DoID = do.ID
+		link.Repo = repo.Root
+		link.Branch = branch
+		link.Base = base
+		link.Head = ""
+		link.Ahead = 0
+
+		link, err = syncLink(svc, link)
+		if err != nil {
+			return fmt.Errorf("could not read branch: %w", err)
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Linked %d to %s (%s)\n", do.ID, branch, link.State)
+		return nil
+	},
+}
+
+var prSyncCmd = &cobra.Command{
+	Use:   "sync [do_id]",
+	Short: "Check linked branches and complete dos whose branch was merged",
+	Long: `Check linked branches and complete dos whose branch was merged. A branch is
+merged once its commits are in the base branch, so a branch that was squashed or
+rebased onto the base isn't seen as merged: it stays open, or shows as deleted
+once it's removed, and its do has to be completed with did.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var id uint
+		if len(args) > 0 {
+			var err error
+			if id, err = parseID(args[0]); err != nil {
+				return err
+			}
+		}
+
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+		conn, err := storeConn(svc)
+		if err != nil {
+			return err
+		}
+
+		query := conn.Joins("JOIN dos ON dos.id = git_links.do_id").
+			Where("dos.deleted = ?", false)
+		if len(args) > 0 {
+			query = query.Where("git_links.do_id = ?", id)
+		}
+
+		var links []GitLink
+		if err := query.Find(&links).Error; err != nil {
+			return logbook.StorageError("fetch links", err)
+		}
+		if len(links) == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "No linked branches.")
+			return nil
+		}
+
+		dos := map[uint]Do{}
+		failed := 0
+		for i, link := range links {
+			synced, err := syncLink(svc, link)
+			if err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Could not sync %d: %v\n", link.DoID, err)
+				failed++
+				continue
+			}
+			links[i] = synced
+
+			if do, err := svc.Find(link.DoID); err == nil {
+				dos[do.ID] = do
+			}
+		}
+
+		PRLog(cmd.OutOrStdout(), links, dos)
+		if failed > 0 {
+			return fmt.Errorf("could not sync %d of %d linked branches", failed, len(links))
+		}
+		return nil
+	},
+}
+
+func init() {
+	prLinkCmd.Flags().String("repo", ".", "Path to the repository")
+	prLinkCmd.Flags().String("branch", "", "Branch to link, defaults to the checked out branch")
+	prLinkCmd.Flags().String("base", "", "Branch it merges into (default main or master)")
+
+	prCmd.AddCommand(prLinkCmd, prSyncCmd)
+	RootCmd.AddCommand(prCmd)
+}
@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"captain/logbook"
+)
+
+// gitFixture runs git in a scratch repository. The reader is checked against
+// what git itself wrote, so these tests are skipped when git isn't installed.
+type gitFixture struct {
+	t   *testing.T
+	dir string
+}
+
+func newGitFixture(t *testing.T) *gitFixture {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	f := &gitFixture{t: t, dir: t.TempDir()}
+	f.git("init", "-q", "-b", "main")
+	f.commit("main.txt", "initial")
+	return f
+}
+
+func (f *gitFixture) git(args ...string) string {
+	f.t.Helper()
+	cmd := exec.Command("git", append([]string{
+		"-c", "user.name=Test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false",
+	}, args...)...)
+	cmd.Dir = f.dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		f.t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commit appends to a file, so that packing has deltas to make
+func (f *gitFixture) commit(file, message string) {
+	f.t.Helper()
+	path := filepath.Join(f.dir, file)
+	content, _ := os.ReadFile(path)
+	os.WriteFile(path, append(content, []byte(strings.Repeat(message+"\n", 50))...), 0o644)
+	f.git("add", file)
+	f.git("commit", "-q", "-m", message)
+}
+
+func TestGitRepoReadsObjects(t *testing.T) {
+	f := newGitFixture(t)
+	f.commit("log.txt", "second")
+	f.git("checkout", "-q", "-b", "feat/x")
+	f.commit("log.txt", "third")
+
+	check := func() {
+		repo, err := openGitRepo(f.dir)
+		if err != nil {
+			t.Fatalf("Failed to open repo: %v", err)
+		}
+
+		for _, line := range strings.Split(f.git("rev-list", "--objects", "--all"), "\n") {
+			hash, _, _ := strings.Cut(line, " ")
+			objType, data, err := repo.readObject(hash)
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", hash, err)
+			}
+			if want := f.git("cat-file", "-t", hash); objType != want {
+				t.Errorf("Expected %s to be a %s, got %s", hash, want, objType)
+			}
+			if objType == "tree" {
+				continue
+			}
+			if want := f.git("cat-file", objType, hash); !bytes.Equal(bytes.TrimSpace(data), []byte(want)) {
+				t.Errorf("Content of %s doesn't match git", hash)
+			}
+		}
+
+		head, err := repo.readRef("HEAD")
+		if err != nil || head != f.git("rev-parse", "HEAD") {
+			t.Errorf("Expected HEAD to resolve to %s, got %s (%v)", f.git("rev-parse", "HEAD"), head, err)
+		}
+		if branch := repo.currentBranch(); branch != "feat/x" {
+			t.Errorf("Expected current branch feat/x, got %s", branch)
+		}
+	}
+
+	t.Run("loose", func(t *testing.T) { check() })
+
+	// Packs objects as deltas and moves refs into packed-refs
+	f.git("gc", "-q", "--aggressive")
+	t.Run("packed", func(t *testing.T) { check() })
+}
+
+func TestCheckBranch(t *testing.T) {
+	f := newGitFixture(t)
+	f.git("checkout", "-q", "-b", "feat/x")
+
+	repo, err := openGitRepo(f.dir)
+	if err != nil {
+		t.Fatalf("Failed to open repo: %v", err)
+	}
+	link := GitLink{Repo: f.dir, Branch: "feat/x"}
+
+	link, err = checkBranch(repo, link)
+	if err != nil || link.State != prOpen || link.Ahead != 0 {
+		t.Fatalf("Expected a new branch to be open, got %s +%d (%v)", link.State, link.Ahead, err)
+	}
+
+	f.commit("log.txt", "one")
+	f.commit("log.txt", "two")
+	link, _ = checkBranch(repo, link)
+	if link.State != prOpen || link.Ahead != 2 {
+		t.Errorf("Expected open +2, got %s +%d", link.State, link.Ahead)
+	}
+
+	f.git("checkout", "-q", "main")
+	f.git("merge", "-q", "--ff-only", "feat/x")
+	link, _ = checkBranch(repo, link)
+	if link.State != prMerged {
+		t.Errorf("Expected a fast-forwarded branch to be merged, got %s", link.State)
+	}
+
+	f.git("branch", "-q", "-d", "feat/x")
+	link, _ = checkBranch(repo, link)
+	if link.State != prMerged {
+		t.Errorf("Expected a deleted merged branch to stay merged, got %s", link.State)
+	}
+
+	gone := GitLink{Repo: f.dir, Branch: "feat/gone", Head: strings.Repeat("0", 40)}
+	gone, _ = checkBranch(repo, gone)
+	if gone.State != prDeleted {
+		t.Errorf("Expected an unmerged missing branch to be deleted, got %s", gone.State)
+	}
+}
+
+func TestCheckBranchDeletedWithoutCommitsIsNotMerged(t *testing.T) {
+	f := newGitFixture(t)
+	f.git("branch", "feat/empty")
+
+	repo, err := openGitRepo(f.dir)
+	if err != nil {
+		t.Fatalf("Failed to open repo: %v", err)
+	}
+	link, _ := checkBranch(repo, GitLink{Repo: f.dir, Branch: "feat/empty"})
+	if link.State != prOpen || link.Head == "" {
+		t.Fatalf("Expected an open branch on main's tip, got %s %q", link.State, link.Head)
+	}
+
+	f.git("branch", "-q", "-D", "feat/empty")
+	link, _ = checkBranch(repo, link)
+	if link.State != prDeleted {
+		t.Errorf("Expected a branch deleted without commits to be deleted, got %s", link.State)
+	}
+}
+
+func TestCheckBranchSquashIsNotMerged(t *testing.T) {
+	f := newGitFixture(t)
+	f.git("checkout", "-q", "-b", "feat/z")
+	f.commit("log.txt", "one")
+
+	repo, err := openGitRepo(f.dir)
+	if err != nil {
+		t.Fatalf("Failed to open repo: %v", err)
+	}
+	link, _ := checkBranch(repo, GitLink{Repo: f.dir, Branch: "feat/z"})
+
+	f.git("checkout", "-q", "main")
+	f.git("merge", "-q", "--squash", "feat/z")
+	f.git("commit", "-q", "-m", "squashed")
+	link, _ = checkBranch(repo, link)
+	if link.State != prOpen {
+		t.Errorf("Expected a squashed branch to look open, got %s", link.State)
+	}
+
+	f.git("branch", "-q", "-D", "feat/z")
+	link, _ = checkBranch(repo, link)
+	if link.State != prDeleted {
+		t.Errorf("Expected a squashed and deleted branch to look deleted, got %s", link.State)
+	}
+}
+
+func TestPRCommandsParseIDs(t *testing.T) {
+	store := logbook.NewMemStore()
+
+	for _, args := range [][]string{{"pr", "link", "12abc"}, {"pr", "sync", "1 OR 1=1"}} {
+		out, err := runCaptain(t, store, args...)
+		if ExitCode(err) != exitInvalid || !strings.Contains(out, "is not a do id") {
+			t.Errorf("Expected %v to refuse the id, got %v:\n%s", args, err, out)
+		}
+	}
+}
+
+func TestPRSyncFailsWhenALinkDoes(t *testing.T) {
+	conn, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	f := newGitFixture(t)
+	do := Do{Description: "Ship it", Type: PR, Priority: Medium}
+	conn.Create(&do)
+	conn.Create(&GitLink{DoID: do.ID, Repo: f.dir, Branch: "main", Base: "gone"})
+
+	out, err := runCaptain(t, logbook.NewSQLStore(conn, t.TempDir()), "pr", "sync")
+	if ExitCode(err) != exitFailure || !strings.Contains(out, "Could not sync 1") {
+		t.Errorf("Expected sync to fail, got %v:\n%s", err, out)
+	}
+}
+
+func TestSyncLinkCompletesMergedDo(t *testing.T) {
+	conn, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	f := newGitFixture(t)
+	f.git("checkout", "-q", "-b", "feat/y")
+	f.commit("log.txt", "work")
+
+	do := Do{Description: "Ship feat/y", Type: PR, Priority: Medium}
+	conn.Create(&do)
+	svc := testService(t, conn)
+
+	link, err := syncLink(svc, GitLink{DoID: do.ID, Repo: f.dir, Branch: "feat/y"})
+	if err != nil || link.State != prOpen {
+		t.Fatalf("Expected open, got %s (%v)", link.State, err)
+	}
+
+	f.git("checkout", "-q", "main")
+	f.commit("main.txt", "meanwhile")
+	f.git("merge", "-q", "--no-ff", "-m", "merge", "feat/y")
+
+	if link, err = syncLink(svc, link); err != nil || link.State != prMerged {
+		t.Fatalf("Expected merged, got %s (%v)", link.State, err)
+	}
+
+	var fetched Do
+	conn.Preload("Git").First(&fetched, do.ID)
+	if !fetched.Completed || fetched.CompletedAt == nil {
+		t.Error("Expected the do to be completed")
+	}
+	if fetched.Git == nil || fetched.Git.Branch != "feat/y" {
+		t.Errorf("Expected the link to be preloaded, got %+v", fetched.Git)
+	}
+}
@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"captain/logbook"
+
+	"github.com/fatih/color"
+	sebtable "github.com/s3bw/table"
+	"github.com/spf13/cobra"
+	"gopkg.in/ini.v1"
+)
+
+// configFile loads the config file for changes to its profiles
+func configFile(cfg *Config) (*ini.File, string, error) {
+	path := cfg.configPath()
+	file, err := ini.LooseLoad(path)
+	if err != nil {
+		return nil, path, fmt.Errorf("could not load config: %w", err)
+	}
+	return file, path, nil
+}
+
+// profileNames are the profiles in the config file, in the order they were
+// added
+func profileNames(file *ini.File) []string {
+	var names []string
+	for _, name := range file.SectionStrings() {
+		if name != ini.DefaultSection {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func checkProfileName(name string) error {
+	if strings.TrimSpace(name) != name || name == "" || name == ini.DefaultSection || strings.ContainsAny(name, "[]") {
+		return invalidf("'%s' can't be the name of a profile", name)
+	}
+	return nil
+}
+
+// writeProfile puts the settings of profile in its section of file. The
+// captain directory is left out when it's the one in use, so the profile
+// follows CAPTAIN_DIR like the rest.
+func writeProfile(file *ini.File, name string, profile *Config) error {
+	section := file.Section(name)
+	if err := section.ReflectFrom(profile); err != nil {
+		return fmt.Errorf("could not add profile: %w", err)
+	}
+	if profile.CaptainDir == cfg.CaptainDir {
+		section.DeleteKey("CaptainDir")
+	}
+	return nil
+}
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Manage profiles, each with its own settings and logbook",
+}
+
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the profiles",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, _, err := configFile(&cfg)
+		if err != nil {
+			return err
+		}
+
+		tbl := sebtable.New("", "profile", "db").WithWriter(cmd.OutOrStdout())
+		headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+		tbl.WithHeaderFormatter(headerFmt)
+		// The profile in use needn't have a section yet
+		names := profileNames(file)
+		if !slices.Contains(names, selectedProfile(file)) {
+			names = append([]string{selectedProfile(file)}, names...)
+		}
+		for _, name := range names {
+			profile, err := readProfile(file, cfg.CaptainDir, name)
+			if err != nil {
+				return err
+			}
+			active := ""
+			if name == cfg.Profile {
+				active = "*"
+			}
+			tbl.AddRow(active, name, dbPath(&profile))
+		}
+		tbl.Print()
+		return nil
+	},
+}
+
+var profileNewCmd = &cobra.Command{
+	Use:   "new <name>",
+	Short: "Add a profile with the default settings and a logbook of its own",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		db, _ := cmd.Flags().GetString("db")
+
+		if err := checkProfileName(name); err != nil {
+			return err
+		}
+		file, path, err := configFile(&cfg)
+		if err != nil {
+			return err
+		}
+		if file.HasSection(name) {
+			return existsf("profile '%s' already exists", name)
+		}
+
+		profile := defaultConfig(cfg.CaptainDir)
+		profile.DBFile = name + ".db"
+		if db != "" {
+			profile.DBFile = db
+		}
+		if err := writeProfile(file, name, &profile); err != nil {
+			return err
+		}
+		if err := saveConfig(file, path); err != nil {
+			return fmt.Errorf("could not save config: %w", err)
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Added profile '%s' (db: %s), switch to it with `captain profile use %s`\n", name, profile.DBFile, name)
+		return nil
+	},
+}
+
+var profileUseCmd = &cobra.Command{
+	Use:   "use <name>",
+	Short: "Switch to another profile",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		file, path, err := configFile(&cfg)
+		if err != nil {
+			return err
+		}
+		if _, err := readProfile(file, cfg.CaptainDir, name); err != nil {
+			return err
+		}
+		file.Section("").Key("profile").SetValue(name)
+		if err := saveConfig(file, path); err != nil {
+			return fmt.Errorf("could not save config: %w", err)
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Switched to profile '%s'\n", name)
+		return nil
+	},
+}
+
+var profileRmCmd = &cobra.Command{
+	Use:   "rm <name>",
+	Short: "Remove a profile, keeping its logbook",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		file, path, err := configFile(&cfg)
+		if err != nil {
+			return err
+		}
+		profile, err := readProfile(file, cfg.CaptainDir, name)
+		if err != nil {
+			return err
+		}
+		if name == selectedProfile(file) {
+			return invalidf("profile '%s' is in use, switch to another first", name)
+		}
+
+		file.DeleteSection(name)
+		if err := saveConfig(file, path); err != nil {
+			return fmt.Errorf("could not save config: %w", err)
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Removed profile '%s', its logbook is still at %s\n", name, dbPath(&profile))
+		return nil
+	},
+}
+
+var profileCopyCmd = &cobra.Command{
+	Use:   "copy <from> <to>",
+	Short: "Add a profile with the settings and a copy of the logbook of another",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+		from, to := args[0], args[1]
+		db, _ := cmd.Flags().GetString("db")
+
+		if err := checkProfileName(to); err != nil {
+			return err
+		}
+		file, path, err := configFile(&cfg)
+		if err != nil {
+			return err
+		}
+		source, err := readProfile(file, cfg.CaptainDir, from)
+		if err != nil {
+			return err
+		}
+		if file.HasSection(to) {
+			return existsf("profile '%s' already exists", to)
+		}
+
+		profile := source
+		profile.DBFile = to + ".db"
+		if db != "" {
+			profile.DBFile = db
+		}
+		if _, err := os.Stat(dbPath(&profile)); err == nil {
+			return existsf("%s already exists", dbPath(&profile))
+		}
+
+		// A profile that's never been used has no logbook to copy yet
+		if _, err := os.Stat(dbPath(&source)); err == nil {
+			conn, err := logbook.Connect(dbPath(&source))
+			if err != nil {
+				return err
+			}
+			if err := logbook.Backup(conn, dbPath(&profile)); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Copied %s to %s\n", dbPath(&source), dbPath(&profile))
+		}
+
+		if err := writeProfile(file, to, &profile); err != nil {
+			return err
+		}
+		if err := saveConfig(file, path); err != nil {
+			return fmt.Errorf("could not save config: %w", err)
+		}
+		fmt.Fprintf(out, "Added profile '%s' as a copy of '%s'\n", to, from)
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.PersistentFlags().String("profile", "", "Use another profile for this run (or set CAPTAIN_PROFILE)")
+
+	profileNewCmd.Flags().String("db", "", "Database file, <name>.db by default")
+	profileCopyCmd.Flags().String("db", "", "Database file for the copy, <to>.db by default")
+	profileCmd.AddCommand(profileListCmd, profileNewCmd, profileUseCmd, profileRmCmd, profileCopyCmd)
+	RootCmd.AddCommand(profileCmd)
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"captain/logbook"
+
+	"gopkg.in/ini.v1"
+)
+
+func TestProfileCommands(t *testing.T) {
+	dir := t.TempDir()
+	captainDirs[t] = dir
+	t.Cleanup(func() { delete(captainDirs, t) })
+	os.WriteFile(filepath.Join(dir, "config.ini"), []byte("profile = main\n\n[main]\ndbname = main.db\n"), 0o644)
+
+	conn, err := logbook.Open(filepath.Join(dir, "main.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	conn.Create(&Do{Description: "Main task", Type: Task, Priority: Medium})
+
+	active := func(out, name string) bool {
+		return regexp.MustCompile(`(?m)^\s*\*\s+` + name + `\s`).MatchString(out)
+	}
+
+	if out, err := runCaptain(t, nil, "profile", "new", "work"); err != nil || !strings.Contains(out, "Added profile 'work' (db: work.db)") {
+		t.Fatalf("Expected work added, got %q, %v", out, err)
+	}
+	if _, err := runCaptain(t, nil, "profile", "new", "work"); !errors.Is(err, logbook.ErrExists) {
+		t.Errorf("Expected ErrExists adding work again, got %v", err)
+	}
+	if _, err := runCaptain(t, nil, "profile", "new", "[bad]"); !errors.Is(err, logbook.ErrInvalid) {
+		t.Errorf("Expected ErrInvalid for a bad name, got %v", err)
+	}
+
+	out, err := runCaptain(t, nil, "profile", "copy", "main", "spare")
+	if err != nil || !strings.Contains(out, "Added profile 'spare' as a copy of 'main'") {
+		t.Fatalf("Expected spare copied from main, got %q, %v", out, err)
+	}
+	copied, err := logbook.Open(filepath.Join(dir, "spare.db"))
+	if err != nil {
+		t.Fatalf("Open copy: %v", err)
+	}
+	var do Do
+	if err := copied.First(&do).Error; err != nil || do.Description != "Main task" {
+		t.Errorf("Expected the copy to hold main's dos, got %+v, %v", do, err)
+	}
+
+	out, _ = runCaptain(t, nil, "profile", "list")
+	if !active(out, "main") || !strings.Contains(out, filepath.Join(dir, "work.db")) || !strings.Contains(out, "spare") {
+		t.Errorf("Expected main in use among work and spare, got %q", out)
+	}
+
+	// For a single run
+	if out, _ := runCaptain(t, nil, "--profile", "spare", "profile", "list"); !active(out, "spare") {
+		t.Errorf("Expected spare in use with --profile, got %q", out)
+	}
+	t.Setenv("CAPTAIN_PROFILE", "work")
+	if out, _ := runCaptain(t, nil, "profile", "list"); !active(out, "work") {
+		t.Errorf("Expected work in use with CAPTAIN_PROFILE, got %q", out)
+	}
+	if out, _ := runCaptain(t, logbook.NewMemStore(), "log"); !strings.Contains(out, "profile: work") {
+		t.Errorf("Expected the log to show the profile, got %q", out)
+	}
+	os.Unsetenv("CAPTAIN_PROFILE")
+	if _, err := runCaptain(t, nil, "--profile", "nope", "log"); !errors.Is(err, logbook.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing profile, got %v", err)
+	}
+
+	if _, err := runCaptain(t, nil, "profile", "use", "work"); err != nil {
+		t.Fatalf("use: %v", err)
+	}
+	file, _ := ini.Load(filepath.Join(dir, "config.ini"))
+	if got := file.Section("").Key("profile").String(); got != "work" {
+		t.Errorf("Expected work selected, got %s", got)
+	}
+	if _, err := runCaptain(t, nil, "profile", "rm", "work"); !errors.Is(err, logbook.ErrInvalid) {
+		t.Errorf("Expected ErrInvalid removing the profile in use, got %v", err)
+	}
+	if _, err := runCaptain(t, nil, "profile", "use", "ghost"); !errors.Is(err, logbook.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound using a missing profile, got %v", err)
+	}
+
+	runCaptain(t, nil, "profile", "use", "main")
+	if out, err := runCaptain(t, nil, "profile", "rm", "spare"); err != nil || !strings.Contains(out, "spare.db") {
+		t.Errorf("Expected spare removed with its logbook kept, got %q, %v", out, err)
+	}
+	if out, _ := runCaptain(t, nil, "profile", "list"); strings.Contains(out, "spare") {
+		t.Errorf("Expected spare gone, got %q", out)
+	}
+}
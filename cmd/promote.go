@@ -3,7 +3,6 @@ package cmd
 import (
 	"bufio"
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -13,68 +12,55 @@ var promoteCmd = &cobra.Command{
 	Use:   "promote <do_id>",
 	Short: "Promote a task to a .do file in VFS",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		id := args[0]
-		conn := OpenConn(&cfg)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
 
-		// Fetch task with doc
-		var do Do
-		result := conn.Preload("Doc").
-			Where("deleted = ? AND promoted = ?", false, false).
-			First(&do, id)
-		if result.Error != nil {
-			fmt.Printf("No task under id '%v' or already promoted\n", id)
-			return
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
 		}
 
-		// Get doc content
-		docContent := ""
-		if do.Doc.ID != 0 {
-			docContent = do.Doc.Text
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+
+		// Fetch task with doc
+		do, err := svc.Get(id)
+		if err != nil {
+			return err
+		}
+		if do.Promoted {
+			return existsf("do %d is already promoted", do.ID)
 		}
 
 		// Show task details
-		fmt.Printf("\nPromoting task (id=%d):\n", do.ID)
-		fmt.Printf("Description: %s\n", do.Description)
-		if docContent != "" {
-			fmt.Printf("Has documentation: Yes (%d chars)\n", len(docContent))
+		fmt.Fprintf(out, "\nPromoting task (id=%d):\n", do.ID)
+		fmt.Fprintf(out, "Description: %s\n", do.Description)
+		if do.Doc.Text != "" {
+			fmt.Fprintf(out, "Has documentation: Yes (%d chars)\n", len(do.Doc.Text))
 		} else {
-			fmt.Printf("Has documentation: No\n")
+			fmt.Fprintf(out, "Has documentation: No\n")
 		}
-		fmt.Println()
+		fmt.Fprintln(out)
 
 		// Prompt for filename
-		reader := bufio.NewReader(os.Stdin)
-		fmt.Print("Enter filename (without .do extension): ")
+		reader := bufio.NewReader(cmd.InOrStdin())
+		fmt.Fprint(out, "Enter filename (without .do extension): ")
 		filename, _ := reader.ReadString('\n')
 		filename = strings.TrimSpace(filename)
 
 		if filename == "" {
-			fmt.Println("Filename cannot be empty. Cancelled.")
-			return
-		}
-
-		// Initialize VFS
-		vfsManager, err := NewVFSManager(conn, cfg.CaptainDir)
-		if err != nil {
-			fmt.Printf("Error initializing VFS: %v\n", err)
-			return
+			return invalidf("filename cannot be empty")
 		}
 
-		// Create .do file
-		err = vfsManager.CreatePromotedFile(filename, do.Description, docContent)
-		if err != nil {
-			fmt.Printf("Error creating file: %v\n", err)
-			return
+		if _, err := svc.Promote(do.ID, filename); err != nil {
+			return err
 		}
 
-		// Mark as promoted
-		do.Promoted = true
-		conn.Save(&do)
-		vfsManager.Save()
-
-		fmt.Printf("\n✓ Task promoted to file: %s.do\n", filename)
-		fmt.Printf("✓ Task marked as promoted (id=%d)\n", do.ID)
+		fmt.Fprintf(out, "\n✓ Task promoted to file: %s.do\n", filename)
+		fmt.Fprintf(out, "✓ Task marked as promoted (id=%d)\n", do.ID)
+		return nil
 	},
 }
 
@@ -0,0 +1,498 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"captain/logbook"
+
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+// JSON-RPC 2.0 error codes, the application's own are below -32000
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+	rpcNotFound       = -32001
+	rpcConflict       = -32002
+	rpcCancelled      = -32003
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+func rpcErrorf(code int, format string, args ...any) *rpcError {
+	return &rpcError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// idParams picks out the do a method acts on
+type idParams struct {
+	ID        uint       `json:"id"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// setParams takes updated_at from doInput
+type setParams struct {
+	ID uint `json:"id"`
+	doInput
+}
+
+type scratchParams struct {
+	idParams
+	Reason string `json:"reason"`
+}
+
+type docParams struct {
+	idParams
+	Text string `json:"text"`
+}
+
+type logParams struct {
+	Type      string `json:"type"`
+	For       string `json:"for"`
+	Completed *bool  `json:"completed"`
+	Deleted   bool   `json:"deleted"`
+	Query     string `json:"q"`
+	Limit     int    `json:"limit"`
+}
+
+// rpcServer answers line delimited JSON-RPC requests, one at a time, and
+// notifies the client when dos change.
+type rpcServer struct {
+	conn *gorm.DB
+	svc  *logbook.Service
+
+	mu  sync.Mutex
+	out *json.Encoder
+
+	// busy is held while a request is handled. version is the database's
+	// data_version as of our last change, so that changes made by other
+	// processes can be told apart.
+	busy    sync.Mutex
+	watch   *sql.Conn
+	version int64
+}
+
+// newRPCServer answers requests with svc. Changes made by other processes
+// are only noticed when it's backed by a database.
+func newRPCServer(svc *logbook.Service, out io.Writer) *rpcServer {
+	conn, _ := storeConn(svc)
+	return &rpcServer{conn: conn, svc: svc, out: json.NewEncoder(out)}
+}
+
+func (s *rpcServer) send(v any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.out.Encode(v)
+}
+
+// notify tells the client about a change made through this server
+func (s *rpcServer) notify(event hookEvent, do Do) {
+	s.send(rpcNotification{
+		JSONRPC: "2.0",
+		Method:  "changed",
+		Params:  map[string]any{"event": event, "do": do},
+	})
+	s.syncVersion()
+}
+
+// dataVersion changes whenever another connection commits to the database
+func (s *rpcServer) dataVersion() (int64, error) {
+	var version int64
+	err := s.watch.QueryRowContext(context.Background(), "PRAGMA data_version").Scan(&version)
+	return version, err
+}
+
+func (s *rpcServer) syncVersion() {
+	if s.watch == nil {
+		return
+	}
+	if version, err := s.dataVersion(); err == nil {
+		s.version = version
+	}
+}
+
+// watchChanges polls for changes made outside this server, e.g. from the
+// command line, and sends a "dbChanged" notification for them.
+func (s *rpcServer) watchChanges(ctx context.Context, every time.Duration) error {
+	if s.conn == nil {
+		return fmt.Errorf("the logbook isn't kept in a database")
+	}
+	db, err := s.conn.DB()
+	if err != nil {
+		return err
+	}
+	if s.watch, err = db.Conn(ctx); err != nil {
+		return err
+	}
+	s.syncVersion()
+
+	go func() {
+		defer s.watch.Close()
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			s.busy.Lock()
+			version, err := s.dataVersion()
+			changed := err == nil && version != s.version
+			if changed {
+				s.version = version
+			}
+			s.busy.Unlock()
+
+			if changed {
+				s.send(rpcNotification{JSONRPC: "2.0", Method: "dbChanged", Params: map[string]any{}})
+			}
+		}
+	}()
+	return nil
+}
+
+// serve reads requests until the input is closed
+func (s *rpcServer) serve(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if reply := s.answer([]byte(line)); reply != nil {
+			s.send(reply)
+		}
+	}
+	return scanner.Err()
+}
+
+// answer replies to a line holding a request or a batch of them, returning
+// nil when there's no reply because they were all notifications
+func (s *rpcServer) answer(line []byte) any {
+	if line[0] != '[' {
+		if response := s.handle(line); response != nil {
+			return response
+		}
+		return nil
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(line, &batch); err != nil {
+		return &rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: rpcErrorf(rpcParseError, "parse error: %v", err)}
+	}
+	if len(batch) == 0 {
+		return &rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: rpcErrorf(rpcInvalidRequest, "invalid request: empty batch")}
+	}
+
+	var responses []*rpcResponse
+	for _, raw := range batch {
+		if response := s.handle(raw); response != nil {
+			responses = append(responses, response)
+		}
+	}
+	if len(responses) == 0 {
+		return nil
+	}
+	return responses
+}
+
+// handle answers a single request, or returns nil for a notification
+func (s *rpcServer) handle(line []byte) *rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		rpcErr := rpcErrorf(rpcParseError, "parse error: %v", err)
+		if json.Valid(line) {
+			// JSON that isn't a request, e.g. a number in a batch
+			rpcErr = rpcErrorf(rpcInvalidRequest, "invalid request: %v", err)
+		}
+		return &rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: rpcErr}
+	}
+
+	id := req.ID
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return &rpcResponse{JSONRPC: "2.0", ID: id, Error: rpcErrorf(rpcInvalidRequest, "invalid request")}
+	}
+
+	s.busy.Lock()
+	result, err := s.call(req.Method, req.Params)
+	s.busy.Unlock()
+
+	// Requests without an id are notifications and get no response
+	if len(req.ID) == 0 {
+		return nil
+	}
+
+	response := &rpcResponse{JSONRPC: "2.0", ID: id}
+	if err != nil {
+		var rpcErr *rpcError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = rpcErrorf(rpcInternalError, "%v", err)
+		}
+		response.Error = rpcErr
+		return response
+	}
+
+	response.Result, err = json.Marshal(result)
+	if err != nil {
+		response.Result = nil
+		response.Error = rpcErrorf(rpcInternalError, "%v", err)
+	}
+	return response
+}
+
+func decodeParams(raw json.RawMessage, v any) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return rpcErrorf(rpcInvalidParams, "invalid params: %v", err)
+	}
+	return nil
+}
+
+func (s *rpcServer) call(method string, raw json.RawMessage) (any, error) {
+	switch method {
+	case "do":
+		var params doInput
+		if err := decodeParams(raw, &params); err != nil {
+			return nil, err
+		}
+		return s.create(params)
+	case "did":
+		var params idParams
+		if err := decodeParams(raw, &params); err != nil {
+			return nil, err
+		}
+		return s.change(params, onComplete, func(do *Do) error {
+			_, err := s.svc.Complete(do.ID)
+			return err
+		})
+	case "scratch":
+		var params scratchParams
+		if err := decodeParams(raw, &params); err != nil {
+			return nil, err
+		}
+		return s.change(params.idParams, onScratch, func(do *Do) error {
+			_, err := s.svc.Scratch(do.ID, params.Reason)
+			return err
+		})
+	case "set":
+		var params setParams
+		if err := decodeParams(raw, &params); err != nil {
+			return nil, err
+		}
+		if err := applyInput(&Do{}, params.doInput); err != nil {
+			return nil, rpcErrorf(rpcInvalidParams, "%v", err)
+		}
+		return s.change(idParams{params.ID, params.UpdatedAt}, "set", func(do *Do) error {
+			return s.svc.Transaction(func(tx *logbook.Service) error {
+				_, err := tx.Update(do.ID, func(do *Do) error {
+					return applyInput(do, params.doInput)
+				})
+				switch {
+				case err != nil || params.For == nil:
+					return err
+				case *params.For == "":
+					_, err = tx.Unassign(do.ID)
+				default:
+					_, err = assignRecruiting(tx, do.ID, *params.For)
+				}
+				return err
+			})
+		})
+	case "doc.get":
+		var params idParams
+		if err := decodeParams(raw, &params); err != nil {
+			return nil, err
+		}
+		do, err := s.find(params.ID)
+		if err != nil {
+			return nil, err
+		}
+		return do.Doc, nil
+	case "doc.set":
+		var params docParams
+		if err := decodeParams(raw, &params); err != nil {
+			return nil, err
+		}
+		return s.change(params.idParams, onDoc, func(do *Do) error {
+			_, err := s.svc.SetDoc(do.ID, params.Text)
+			return err
+		})
+	case "log":
+		var params logParams
+		if err := decodeParams(raw, &params); err != nil {
+			return nil, err
+		}
+		return s.log(params)
+	case "crew":
+		return s.svc.Crew()
+	default:
+		return nil, rpcErrorf(rpcMethodNotFound, "no method '%s'", method)
+	}
+}
+
+func (s *rpcServer) find(id uint) (Do, error) {
+	do, err := s.svc.Get(id)
+	if err != nil {
+		return do, changeError(err)
+	}
+	return do, nil
+}
+
+// changeError maps the errors from a change to an error code
+func changeError(err error) error {
+	switch {
+	case errors.Is(err, errConflict):
+		return rpcErrorf(rpcConflict, "%v", err)
+	case errors.Is(err, errHook), errors.Is(err, logbook.ErrCancelled):
+		return rpcErrorf(rpcCancelled, "%v", err)
+	case errors.Is(err, logbook.ErrNotFound):
+		return rpcErrorf(rpcNotFound, "%v", err)
+	case errors.Is(err, logbook.ErrInvalid):
+		return rpcErrorf(rpcInvalidParams, "%v", err)
+	default:
+		return err
+	}
+}
+
+func (s *rpcServer) create(params doInput) (Do, error) {
+	if params.Description == nil {
+		return Do{}, rpcErrorf(rpcInvalidParams, "description is required")
+	}
+
+	add := logbook.NewDo{Do: Do{Type: Task, Priority: Medium}, Recruit: true}
+	if err := applyInput(&add.Do, params); err != nil {
+		return add.Do, rpcErrorf(rpcInvalidParams, "%v", err)
+	}
+	if params.For != nil {
+		add.For = *params.For
+	}
+
+	do, err := s.svc.AddDo(add)
+	if err != nil {
+		return do, changeError(err)
+	}
+	s.notify(onCreate, do)
+	return do, nil
+}
+
+// change runs a change to a do after checking its version, and notifies
+// the client with the do as it is afterwards.
+func (s *rpcServer) change(params idParams, event hookEvent, apply func(do *Do) error) (Do, error) {
+	do, err := s.find(params.ID)
+	if err != nil {
+		return do, err
+	}
+	if err := checkVersion(do, params.UpdatedAt); err != nil {
+		return do, changeError(err)
+	}
+	if err := apply(&do); err != nil {
+		return do, changeError(err)
+	}
+
+	changed, err := s.svc.Find(do.ID)
+	if err != nil {
+		return changed, err
+	}
+	s.notify(event, changed)
+	return changed, nil
+}
+
+func (s *rpcServer) log(params logParams) ([]Do, error) {
+	query := logbook.Query{
+		For:       params.For,
+		Completed: params.Completed,
+		Deleted:   params.Deleted,
+		Search:    params.Query,
+		Limit:     params.Limit,
+	}
+	if params.Type != "" {
+		query.Type = mapType(params.Type)
+	}
+	if query.Limit <= 0 {
+		query.Limit = 100
+	}
+	return s.svc.Query(query)
+}
+
+var rpcCmd = &cobra.Command{
+	Use:   "rpc",
+	Short: "Speak JSON-RPC 2.0 on stdin and stdout for editor integrations",
+	Long: `Read line delimited JSON-RPC 2.0 requests on stdin and answer on stdout.
+A line can be a batch of requests, which is answered with a batch.
+
+Methods: do, did, scratch, set, doc.get, doc.set, log and crew. A "changed"
+notification is sent for every change made, and "dbChanged" when the logbook is
+changed by something else.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+		server := newRPCServer(svc, cmd.OutOrStdout())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		if err := server.watchChanges(ctx, time.Second); err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Could not watch for changes: %v\n", err)
+		}
+
+		if err := server.serve(cmd.InOrStdin()); err != nil {
+			return fmt.Errorf("could not read requests: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(rpcCmd)
+}
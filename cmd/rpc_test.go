@@ -0,0 +1,302 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rpcMessage is a response or a notification read back from the server
+type rpcMessage struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+func setupTestRPC(t *testing.T) (*rpcServer, *bytes.Buffer) {
+	conn, cleanup := setupTestDB(t)
+	t.Cleanup(cleanup)
+
+	out := &bytes.Buffer{}
+	return newRPCServer(testService(t, conn), out), out
+}
+
+// runRPC sends each line to the server and returns everything it wrote
+func runRPC(t *testing.T, server *rpcServer, out *bytes.Buffer, lines ...string) []rpcMessage {
+	t.Helper()
+	out.Reset()
+	if err := server.serve(strings.NewReader(strings.Join(lines, "\n"))); err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+
+	var messages []rpcMessage
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		var m rpcMessage
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			t.Fatalf("bad output %q: %v", scanner.Text(), err)
+		}
+		messages = append(messages, m)
+	}
+	return messages
+}
+
+// response picks the response to a request out of the messages
+func response(t *testing.T, messages []rpcMessage, id string) rpcMessage {
+	t.Helper()
+	for _, m := range messages {
+		if string(m.ID) == id && m.Method == "" {
+			return m
+		}
+	}
+	t.Fatalf("no response to %s in %+v", id, messages)
+	return rpcMessage{}
+}
+
+func TestRPCCreateAndComplete(t *testing.T) {
+	server, out := setupTestRPC(t)
+
+	messages := runRPC(t, server, out,
+		`{"jsonrpc":"2.0","id":1,"method":"do","params":{"description":"Ship it","type":"ask","for":"alice"}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"did","params":{"id":1}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"log","params":{"completed":true}}`,
+	)
+
+	var created Do
+	json.Unmarshal(response(t, messages, "1").Result, &created)
+	if created.ID != 1 || created.Type != Ask || len(created.Tags) != 1 || created.Tags[0].Name != "alice" {
+		t.Errorf("unexpected do created: %+v", created)
+	}
+
+	var done Do
+	json.Unmarshal(response(t, messages, "2").Result, &done)
+	if !done.Completed || done.CompletedAt == nil {
+		t.Errorf("expected do to be completed: %+v", done)
+	}
+
+	var dos []Do
+	json.Unmarshal(response(t, messages, "3").Result, &dos)
+	if len(dos) != 1 || dos[0].ID != 1 {
+		t.Errorf("expected the completed do in the log, got %+v", dos)
+	}
+
+	var events []string
+	for _, m := range messages {
+		if m.Method == "changed" {
+			var params struct {
+				Event string `json:"event"`
+			}
+			json.Unmarshal(m.Params, &params)
+			events = append(events, params.Event)
+		}
+	}
+	if strings.Join(events, ",") != "create,complete" {
+		t.Errorf("expected create and complete notifications, got %v", events)
+	}
+}
+
+func TestRPCSetDocAndCrew(t *testing.T) {
+	server, out := setupTestRPC(t)
+
+	messages := runRPC(t, server, out,
+		`{"jsonrpc":"2.0","id":1,"method":"do","params":{"description":"Write docs"}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"set","params":{"id":1,"priority":"high","for":"bob"}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"doc.set","params":{"id":1,"text":"# Notes"}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"doc.get","params":{"id":1}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"crew"}`,
+		`{"jsonrpc":"2.0","id":6,"method":"log","params":{"for":"bob"}}`,
+	)
+
+	var set Do
+	json.Unmarshal(response(t, messages, "2").Result, &set)
+	if set.Priority != High || len(set.Tags) != 1 || set.Tags[0].Name != "bob" {
+		t.Errorf("unexpected do after set: %+v", set)
+	}
+
+	var doc DoDoc
+	json.Unmarshal(response(t, messages, "4").Result, &doc)
+	if doc.Text != "# Notes" {
+		t.Errorf("expected the doc, got %+v", doc)
+	}
+
+	var crew []Mate
+	json.Unmarshal(response(t, messages, "5").Result, &crew)
+	if len(crew) != 1 || crew[0].Name != "bob" || crew[0].Count != 1 {
+		t.Errorf("unexpected crew: %+v", crew)
+	}
+
+	var dos []Do
+	json.Unmarshal(response(t, messages, "6").Result, &dos)
+	if len(dos) != 1 {
+		t.Errorf("expected bob's do, got %+v", dos)
+	}
+}
+
+func TestRPCBatch(t *testing.T) {
+	server, out := setupTestRPC(t)
+
+	input := strings.Join([]string{
+		`[{"jsonrpc":"2.0","id":1,"method":"do","params":{"description":"Batched"}},` +
+			`{"jsonrpc":"2.0","method":"log"},1,` +
+			`{"jsonrpc":"2.0","id":2,"method":"log"}]`,
+		`[{"jsonrpc":"2.0","method":"log"}]`,
+		`[]`,
+	}, "\n")
+	if err := server.serve(strings.NewReader(input)); err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+
+	var batch []rpcMessage
+	var empty rpcMessage
+	batches := 0
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		switch {
+		case strings.HasPrefix(line, "["):
+			batches++
+			if err := json.Unmarshal([]byte(line), &batch); err != nil {
+				t.Fatalf("bad batch %q: %v", line, err)
+			}
+		case strings.Contains(line, `"error"`):
+			json.Unmarshal([]byte(line), &empty)
+		}
+	}
+
+	if len(batch) != 3 {
+		t.Fatalf("expected responses to the 2 requests and the bad one, got %s", out)
+	}
+	if string(batch[0].ID) != "1" || batch[0].Error != nil {
+		t.Errorf("expected the do to be created, got %+v", batch[0])
+	}
+	if batch[1].Error == nil || batch[1].Error.Code != rpcInvalidRequest {
+		t.Errorf("expected a request that isn't an object to be invalid, got %+v", batch[1])
+	}
+	if string(batch[2].ID) != "2" || !strings.Contains(string(batch[2].Result), "Batched") {
+		t.Errorf("expected the log after the do, got %+v", batch[2])
+	}
+	if empty.Error == nil || empty.Error.Code != rpcInvalidRequest {
+		t.Errorf("expected an empty batch to be invalid, got %s", out)
+	}
+	if batches != 1 {
+		t.Errorf("expected no reply to a batch of notifications, got %s", out)
+	}
+}
+
+func TestRPCErrors(t *testing.T) {
+	server, out := setupTestRPC(t)
+
+	stale := time.Now().Add(-time.Hour).Format(time.RFC3339Nano)
+	messages := runRPC(t, server, out,
+		`not json`,
+		`{"jsonrpc":"2.0","id":1,"method":"nope"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"did","params":{"id":42}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"do","params":{"description":"x","type":"bogus"}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"do","params":{"description":"Conflict"}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"did","params":{"id":1,"updated_at":"`+stale+`"}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"did","params":"1"}`,
+		`{"id":7,"method":"log"}`,
+	)
+
+	if messages[0].Error == nil || messages[0].Error.Code != rpcParseError {
+		t.Errorf("expected a parse error, got %+v", messages[0])
+	}
+
+	codes := map[string]int{
+		"1": rpcMethodNotFound,
+		"2": rpcNotFound,
+		"3": rpcInvalidParams,
+		"5": rpcConflict,
+		"6": rpcInvalidParams,
+		"7": rpcInvalidRequest,
+	}
+	for id, code := range codes {
+		m := response(t, messages, id)
+		if m.Error == nil || m.Error.Code != code {
+			t.Errorf("request %s: expected error %d, got %+v", id, code, m.Error)
+		}
+	}
+}
+
+func TestRPCNotificationsGetNoResponse(t *testing.T) {
+	server, out := setupTestRPC(t)
+
+	messages := runRPC(t, server, out,
+		`{"jsonrpc":"2.0","method":"do","params":{"description":"Quietly"}}`,
+		`{"jsonrpc":"2.0","method":"nope"}`,
+	)
+
+	for _, m := range messages {
+		if m.Method == "" {
+			t.Errorf("expected no responses, got %+v", m)
+		}
+	}
+
+	var count int64
+	server.conn.Model(&Do{}).Count(&count)
+	if count != 1 {
+		t.Errorf("expected the do to be created, got %d dos", count)
+	}
+}
+
+func TestRPCHookCancels(t *testing.T) {
+	server, out := setupTestRPC(t)
+	cfg.HookFailure = hookAbort
+	hookOutput = &bytes.Buffer{}
+	t.Cleanup(func() { hookOutput = os.Stderr })
+
+	dir := hooksDir(&cfg)
+	os.MkdirAll(dir, 0o755)
+	os.WriteFile(filepath.Join(dir, "on-create"), []byte("#!/bin/sh\nexit 1\n"), 0o755)
+
+	messages := runRPC(t, server, out,
+		`{"jsonrpc":"2.0","id":1,"method":"do","params":{"description":"Blocked"}}`,
+	)
+
+	m := response(t, messages, "1")
+	if m.Error == nil || m.Error.Code != rpcCancelled {
+		t.Errorf("expected the hook to cancel, got %+v", m.Error)
+	}
+}
+
+func TestRPCWatchesOtherChanges(t *testing.T) {
+	server, out := setupTestRPC(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := server.watchChanges(ctx, 10*time.Millisecond); err != nil {
+		t.Fatalf("watchChanges: %v", err)
+	}
+
+	// Our own changes are notified as "changed" only
+	runRPC(t, server, out, `{"jsonrpc":"2.0","id":1,"method":"do","params":{"description":"Ours"}}`)
+	time.Sleep(50 * time.Millisecond)
+	server.mu.Lock()
+	ours := out.String()
+	out.Reset()
+	server.mu.Unlock()
+	if strings.Contains(ours, "dbChanged") {
+		t.Errorf("expected no dbChanged for our own change: %s", ours)
+	}
+
+	// The gorm pool writes through another connection than the watcher
+	server.conn.Create(&Do{Description: "Theirs", Type: Task, Priority: Medium})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		server.mu.Lock()
+		theirs := out.String()
+		server.mu.Unlock()
+		if strings.Contains(theirs, `"method":"dbChanged"`) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("expected a dbChanged notification")
+}
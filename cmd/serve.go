@@ -0,0 +1,547 @@
+package cmd
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"captain/logbook"
+
+	"github.com/spf13/cobra"
+)
+
+// apiServer serves the logbook as JSON. Changes are made one at a time so
+// that checking a do's updated_at and saving it can't interleave.
+type apiServer struct {
+	svc   *logbook.Service
+	cfg   *Config
+	token string
+	mu    sync.Mutex
+}
+
+// apiError is the body of every error response
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// doInput creates or changes a do. Dates and estimates take the same values
+// as the command line, and a nil field is left as it is.
+type doInput struct {
+	Description *string    `json:"description"`
+	Type        *string    `json:"type"`
+	Priority    *string    `json:"priority"`
+	For         *string    `json:"for"`
+	Due         *string    `json:"due"`
+	Scheduled   *string    `json:"scheduled"`
+	Estimate    *string    `json:"estimate"`
+	Sensitive   *bool      `json:"sensitive"`
+	Pinned      *bool      `json:"pinned"`
+	UpdatedAt   *time.Time `json:"updated_at"`
+}
+
+// actionInput is the body of the do actions, all fields are optional
+type actionInput struct {
+	UpdatedAt *time.Time `json:"updated_at"`
+	Reason    string     `json:"reason"`
+	Text      string     `json:"text"`
+	Name      string     `json:"name"`
+	Content   string     `json:"content"`
+	Filename  string     `json:"filename"`
+}
+
+var errConflict = errors.New("do has changed since it was read")
+
+func newAPIServer(svc *logbook.Service, cfg *Config, token string) *apiServer {
+	return &apiServer{svc: svc, cfg: cfg, token: token}
+}
+
+func (s *apiServer) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/dos", s.listDos)
+	mux.HandleFunc("POST /api/dos", s.createDo)
+	mux.HandleFunc("GET /api/dos/{id}", s.getDo)
+	mux.HandleFunc("PATCH /api/dos/{id}", s.updateDo)
+	mux.HandleFunc("POST /api/dos/{id}/complete", s.completeDo)
+	mux.HandleFunc("POST /api/dos/{id}/scratch", s.scratchDo)
+	mux.HandleFunc("POST /api/dos/{id}/promote", s.promoteDo)
+	mux.HandleFunc("GET /api/dos/{id}/doc", s.getDoc)
+	mux.HandleFunc("PUT /api/dos/{id}/doc", s.putDoc)
+	mux.HandleFunc("PUT /api/dos/{id}/crew", s.assignDo)
+	mux.HandleFunc("DELETE /api/dos/{id}/crew", s.unassignDo)
+	mux.HandleFunc("GET /api/crew", s.listCrew)
+	mux.HandleFunc("POST /api/crew", s.recruit)
+	mux.HandleFunc("GET /api/templates", s.listTemplates)
+	mux.HandleFunc("POST /api/templates", s.createTemplate)
+	mux.HandleFunc("GET /api/templates/{name}", s.getTemplate)
+	mux.HandleFunc("DELETE /api/templates/{name}", s.deleteTemplate)
+
+	// The UI itself is public, it asks the API for everything else
+	root := http.NewServeMux()
+	root.Handle("/api/", s.authorize(mux))
+	root.Handle("/", webHandler())
+	return root
+}
+
+// authorize requires the token as a bearer token on every request
+func (s *apiServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "missing or bad token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, apiError{Error: fmt.Sprintf(format, args...)})
+}
+
+// writeChangeError maps the errors from a change to a status
+func writeChangeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errConflict), errors.Is(err, logbook.ErrExists):
+		writeError(w, http.StatusConflict, "%v", err)
+	case errors.Is(err, errHook), errors.Is(err, logbook.ErrCancelled):
+		writeError(w, http.StatusUnprocessableEntity, "%v", err)
+	case errors.Is(err, logbook.ErrNotFound):
+		writeError(w, http.StatusNotFound, "%v", err)
+	case errors.Is(err, logbook.ErrInvalid):
+		writeError(w, http.StatusBadRequest, "%v", err)
+	default:
+		writeError(w, http.StatusInternalServerError, "%v", err)
+	}
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if r.ContentLength == 0 {
+		return true
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "bad request body: %v", err)
+		return false
+	}
+	return true
+}
+
+// findDo loads the do in the path, writing a 404 when there isn't one
+func (s *apiServer) findDo(w http.ResponseWriter, r *http.Request) (Do, bool) {
+	id, err := parseID(r.PathValue("id"))
+	if err != nil {
+		writeChangeError(w, err)
+		return Do{}, false
+	}
+	do, err := s.svc.Get(id)
+	if err != nil {
+		writeChangeError(w, err)
+		return do, false
+	}
+	return do, true
+}
+
+// checkVersion rejects a change made against an older version of the do
+func checkVersion(do Do, updatedAt *time.Time) error {
+	if updatedAt != nil && !do.UpdatedAt.Equal(*updatedAt) {
+		return errConflict
+	}
+	return nil
+}
+
+func (s *apiServer) listDos(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	query := logbook.Query{
+		For:     q.Get("for"),
+		Search:  q.Get("q"),
+		Deleted: q.Get("deleted") == "true",
+		Limit:   100,
+	}
+	if completed, err := strconv.ParseBool(q.Get("completed")); err == nil {
+		query.Completed = &completed
+	}
+	if doType := q.Get("type"); doType != "" {
+		query.Type = mapType(doType)
+	}
+	if n, err := strconv.Atoi(q.Get("limit")); err == nil && n > 0 {
+		query.Limit = n
+	}
+
+	dos, err := s.svc.Query(query)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "could not fetch dos: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, dos)
+}
+
+func (s *apiServer) getDo(w http.ResponseWriter, r *http.Request) {
+	if do, ok := s.findDo(w, r); ok {
+		writeJSON(w, http.StatusOK, do)
+	}
+}
+
+// applyInput sets the fields given in the input on a do
+func applyInput(do *Do, input doInput) error {
+	if input.Description != nil {
+		if strings.TrimSpace(*input.Description) == "" {
+			return errors.New("description can't be empty")
+		}
+		do.Description = *input.Description
+	}
+	if input.Type != nil {
+		if !isDoType(*input.Type) {
+			return fmt.Errorf("unknown type '%s'", *input.Type)
+		}
+		do.Type = mapType(*input.Type)
+	}
+	if input.Priority != nil {
+		do.Priority = mapPriority(*input.Priority)
+	}
+	if input.Due != nil {
+		date, err := mapDate(*input.Due)
+		if err != nil {
+			return err
+		}
+		do.DueAt = date
+	}
+	if input.Scheduled != nil {
+		date, err := mapDate(*input.Scheduled)
+		if err != nil {
+			return err
+		}
+		do.ScheduledAt = date
+	}
+	if input.Estimate != nil {
+		estimate, err := mapEstimate(*input.Estimate)
+		if err != nil {
+			return err
+		}
+		do.Estimate = estimate
+	}
+	if input.Sensitive != nil {
+		do.Sensitive = *input.Sensitive
+	}
+	if input.Pinned != nil {
+		do.Pinned = *input.Pinned
+	}
+	return nil
+}
+
+func (s *apiServer) createDo(w http.ResponseWriter, r *http.Request) {
+	var input doInput
+	if !readJSON(w, r, &input) {
+		return
+	}
+	if input.Description == nil {
+		writeError(w, http.StatusBadRequest, "description is required")
+		return
+	}
+
+	add := logbook.NewDo{Do: Do{Type: Task, Priority: Medium}, Recruit: true}
+	if err := applyInput(&add.Do, input); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if input.For != nil {
+		add.For = *input.For
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	do, err := s.svc.AddDo(add)
+	if err != nil {
+		writeChangeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, do)
+}
+
+// change runs a change to the do in the path after checking its version,
+// and responds with the do as it is afterwards.
+func (s *apiServer) change(w http.ResponseWriter, r *http.Request, updatedAt *time.Time, apply func(do *Do) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	do, ok := s.findDo(w, r)
+	if !ok {
+		return
+	}
+	if err := checkVersion(do, updatedAt); err != nil {
+		writeChangeError(w, err)
+		return
+	}
+
+	if err := apply(&do); err != nil {
+		writeChangeError(w, err)
+		return
+	}
+
+	do, err := s.svc.Find(do.ID)
+	if err != nil {
+		writeChangeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, do)
+}
+
+func (s *apiServer) updateDo(w http.ResponseWriter, r *http.Request) {
+	var input doInput
+	if !readJSON(w, r, &input) {
+		return
+	}
+	if err := applyInput(&Do{}, input); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	s.change(w, r, input.UpdatedAt, func(do *Do) error {
+		_, err := s.svc.Update(do.ID, func(do *Do) error {
+			return applyInput(do, input)
+		})
+		return err
+	})
+}
+
+func (s *apiServer) completeDo(w http.ResponseWriter, r *http.Request) {
+	var input actionInput
+	if !readJSON(w, r, &input) {
+		return
+	}
+
+	s.change(w, r, input.UpdatedAt, func(do *Do) error {
+		_, err := s.svc.Complete(do.ID)
+		return err
+	})
+}
+
+func (s *apiServer) scratchDo(w http.ResponseWriter, r *http.Request) {
+	var input actionInput
+	if !readJSON(w, r, &input) {
+		return
+	}
+
+	s.change(w, r, input.UpdatedAt, func(do *Do) error {
+		_, err := s.svc.Scratch(do.ID, input.Reason)
+		return err
+	})
+}
+
+func (s *apiServer) promoteDo(w http.ResponseWriter, r *http.Request) {
+	var input actionInput
+	if !readJSON(w, r, &input) {
+		return
+	}
+	if strings.TrimSpace(input.Filename) == "" {
+		writeError(w, http.StatusBadRequest, "filename is required")
+		return
+	}
+
+	s.change(w, r, input.UpdatedAt, func(do *Do) error {
+		if do.Promoted {
+			return nil
+		}
+		_, err := s.svc.Promote(do.ID, input.Filename)
+		return err
+	})
+}
+
+// docResponse is a doc along with it rendered as HTML
+type docResponse struct {
+	DoDoc
+	HTML string `json:"html"`
+}
+
+func (s *apiServer) getDoc(w http.ResponseWriter, r *http.Request) {
+	do, ok := s.findDo(w, r)
+	if !ok {
+		return
+	}
+
+	html, err := renderMarkdown(do.Doc.Text)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "could not render doc: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, docResponse{DoDoc: do.Doc, HTML: html})
+}
+
+func (s *apiServer) putDoc(w http.ResponseWriter, r *http.Request) {
+	var input actionInput
+	if !readJSON(w, r, &input) {
+		return
+	}
+
+	s.change(w, r, input.UpdatedAt, func(do *Do) error {
+		_, err := s.svc.SetDoc(do.ID, input.Text)
+		return err
+	})
+}
+
+func (s *apiServer) assignDo(w http.ResponseWriter, r *http.Request) {
+	var input actionInput
+	if !readJSON(w, r, &input) {
+		return
+	}
+	if strings.TrimSpace(input.Name) == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	s.change(w, r, input.UpdatedAt, func(do *Do) error {
+		_, err := assignRecruiting(s.svc, do.ID, input.Name)
+		return err
+	})
+}
+
+func (s *apiServer) unassignDo(w http.ResponseWriter, r *http.Request) {
+	var input actionInput
+	if !readJSON(w, r, &input) {
+		return
+	}
+
+	s.change(w, r, input.UpdatedAt, func(do *Do) error {
+		_, err := s.svc.Unassign(do.ID)
+		return err
+	})
+}
+
+func (s *apiServer) listCrew(w http.ResponseWriter, r *http.Request) {
+	crew, err := s.svc.Crew()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, crew)
+}
+
+func (s *apiServer) recruit(w http.ResponseWriter, r *http.Request) {
+	var input actionInput
+	if !readJSON(w, r, &input) {
+		return
+	}
+	if strings.TrimSpace(input.Name) == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tag, err := s.svc.Recruit(input.Name)
+	if err != nil {
+		writeChangeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, tag)
+}
+
+func (s *apiServer) listTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := s.svc.Templates()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "could not fetch templates: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, templates)
+}
+
+func (s *apiServer) getTemplate(w http.ResponseWriter, r *http.Request) {
+	template, err := s.svc.Template(r.PathValue("name"))
+	if err != nil {
+		writeChangeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, template)
+}
+
+func (s *apiServer) createTemplate(w http.ResponseWriter, r *http.Request) {
+	var input actionInput
+	if !readJSON(w, r, &input) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	template, err := s.svc.CreateTemplate(input.Name, input.Content)
+	if err != nil {
+		writeChangeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, template)
+}
+
+func (s *apiServer) deleteTemplate(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.svc.DeleteTemplate(r.PathValue("name")); err != nil {
+		writeChangeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve --addr=127.0.0.1:7070",
+	Short: "Serve the logbook as a JSON API and web UI",
+	Long: `Serve the logbook as a JSON API and web UI. API requests need the
+serve_token from the config as a bearer token, one is created the first time
+the server starts. Open the printed address to use the web UI.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		addr, _ := cmd.Flags().GetString("addr")
+		out := cmd.OutOrStdout()
+
+		token := cfg.ServeToken
+		if token == "" {
+			uid, err := newUID()
+			if err != nil {
+				return err
+			}
+			token = strings.TrimSuffix(uid, "@captain")
+			if err := cfg.SetProfile("serve_token", token); err != nil {
+				return fmt.Errorf("could not save token: %w", err)
+			}
+			fmt.Fprintf(out, "Created a token, it's saved as serve_token in the config: %s\n", token)
+		}
+
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+		server := newAPIServer(svc, &cfg, token)
+
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return invalidf("could not serve on %s: %v", addr, err)
+		}
+
+		fmt.Fprintf(out, "Serving on http://%s/#token=%s\n", addr, token)
+		if err := http.Serve(listener, server.routes()); err != nil {
+			return fmt.Errorf("server stopped: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	serveCmd.Flags().String("addr", "127.0.0.1:7070", "Address to listen on")
+
+	RootCmd.AddCommand(serveCmd)
+}
@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type apiClient struct {
+	t      *testing.T
+	server *httptest.Server
+	token  string
+}
+
+func setupTestServer(t *testing.T) *apiClient {
+	conn, cleanup := setupTestDB(t)
+	t.Cleanup(cleanup)
+
+	server := httptest.NewServer(newAPIServer(testService(t, conn), &cfg, "secret").routes())
+	t.Cleanup(server.Close)
+	return &apiClient{t: t, server: server, token: "secret"}
+}
+
+func (c *apiClient) do(method, path string, body any, out any) int {
+	c.t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		b, _ := json.Marshal(body)
+		reader = bytes.NewReader(b)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, _ := http.NewRequest(method, c.server.URL+path, reader)
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+func TestServeRequiresToken(t *testing.T) {
+	c := setupTestServer(t)
+
+	c.token = "wrong"
+	if status := c.do("GET", "/api/dos", nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with a bad token, got %d", status)
+	}
+
+	c.token = "secret"
+	if status := c.do("GET", "/api/dos", nil, nil); status != http.StatusOK {
+		t.Errorf("Expected 200 with the token, got %d", status)
+	}
+}
+
+func TestServeDoLifecycle(t *testing.T) {
+	c := setupTestServer(t)
+
+	var created Do
+	status := c.do("POST", "/api/dos", map[string]any{
+		"description": "Write the API",
+		"priority":    "high",
+		"for":         "alice",
+		"due":         "2026-01-02",
+		"estimate":    "2h",
+	}, &created)
+	if status != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	if created.ID == 0 || created.Priority != High || created.Estimate != 120 || created.DueAt == nil {
+		t.Errorf("Unexpected do %+v", created)
+	}
+	if len(created.Tags) != 1 || created.Tags[0].Name != "alice" {
+		t.Errorf("Expected the do to be for alice, got %v", created.Tags)
+	}
+
+	var bad apiError
+	if status := c.do("POST", "/api/dos", map[string]any{"description": "x", "due": "someday"}, &bad); status != http.StatusBadRequest || bad.Error == "" {
+		t.Errorf("Expected 400 with an error for a bad date, got %d %q", status, bad.Error)
+	}
+
+	c.do("POST", "/api/dos", map[string]any{"description": "Something else", "type": "ask"}, nil)
+
+	var listed []Do
+	c.do("GET", "/api/dos?for=alice", nil, &listed)
+	if len(listed) != 1 || listed[0].ID != created.ID {
+		t.Errorf("Expected only alice's do, got %v", listed)
+	}
+	c.do("GET", "/api/dos?type=ask", nil, &listed)
+	if len(listed) != 1 || listed[0].Type != Ask {
+		t.Errorf("Expected only the ask, got %v", listed)
+	}
+
+	path := fmt.Sprintf("/api/dos/%d", created.ID)
+
+	var doc DoDoc
+	if status := c.do("PUT", path+"/doc", map[string]any{"text": "# Notes"}, nil); status != http.StatusOK {
+		t.Errorf("Expected 200 saving the doc, got %d", status)
+	}
+	c.do("GET", path+"/doc", nil, &doc)
+	if doc.Text != "# Notes" {
+		t.Errorf("Expected the doc to be saved, got %q", doc.Text)
+	}
+
+	var completed Do
+	if status := c.do("POST", path+"/complete", nil, &completed); status != http.StatusOK || !completed.Completed {
+		t.Errorf("Expected the do to be completed, got %d %+v", status, completed)
+	}
+
+	if status := c.do("POST", path+"/scratch", map[string]any{"reason": "dupe"}, nil); status != http.StatusOK {
+		t.Errorf("Expected 200 scratching, got %d", status)
+	}
+	if status := c.do("GET", path, nil, nil); status != http.StatusNotFound {
+		t.Errorf("Expected a scratched do to be gone, got %d", status)
+	}
+}
+
+func TestServeOptimisticConcurrency(t *testing.T) {
+	c := setupTestServer(t)
+
+	var created Do
+	c.do("POST", "/api/dos", map[string]any{"description": "Edit me"}, &created)
+	path := fmt.Sprintf("/api/dos/%d", created.ID)
+
+	// Make sure the next save gets a different updated_at
+	time.Sleep(2 * time.Millisecond)
+
+	var first Do
+	status := c.do("PATCH", path, map[string]any{"priority": "low", "updated_at": created.UpdatedAt}, &first)
+	if status != http.StatusOK || first.Priority != Low {
+		t.Fatalf("Expected the first change to apply, got %d %+v", status, first)
+	}
+
+	var conflict apiError
+	status = c.do("PATCH", path, map[string]any{"priority": "high", "updated_at": created.UpdatedAt}, &conflict)
+	if status != http.StatusConflict {
+		t.Errorf("Expected a stale change to conflict, got %d", status)
+	}
+
+	status = c.do("PATCH", path, map[string]any{"priority": "high", "updated_at": first.UpdatedAt}, nil)
+	if status != http.StatusOK {
+		t.Errorf("Expected a change to the latest version to apply, got %d", status)
+	}
+}
+
+func TestServeCrewAndTemplates(t *testing.T) {
+	c := setupTestServer(t)
+
+	if status := c.do("POST", "/api/crew", map[string]any{"name": "bob"}, nil); status != http.StatusCreated {
+		t.Errorf("Expected 201 recruiting, got %d", status)
+	}
+	if status := c.do("POST", "/api/crew", map[string]any{"name": "bob"}, nil); status != http.StatusConflict {
+		t.Errorf("Expected 409 recruiting twice, got %d", status)
+	}
+
+	var created Do
+	c.do("POST", "/api/dos", map[string]any{"description": "Pair with bob"}, &created)
+
+	var assigned Do
+	c.do("PUT", fmt.Sprintf("/api/dos/%d/crew", created.ID), map[string]any{"name": "bob"}, &assigned)
+	if len(assigned.Tags) != 1 || assigned.Tags[0].Name != "bob" {
+		t.Errorf("Expected the do to be for bob, got %v", assigned.Tags)
+	}
+
+	var crew []Mate
+	c.do("GET", "/api/crew", nil, &crew)
+	if len(crew) != 1 || crew[0].Name != "bob" || crew[0].Count != 1 {
+		t.Errorf("Unexpected crew %v", crew)
+	}
+
+	if status := c.do("POST", "/api/templates", map[string]any{"name": "standup", "content": "Yesterday"}, nil); status != http.StatusCreated {
+		t.Errorf("Expected 201 creating a template, got %d", status)
+	}
+	var templates []Template
+	c.do("GET", "/api/templates", nil, &templates)
+	if len(templates) != 1 || templates[0].Name != "standup" {
+		t.Errorf("Unexpected templates %v", templates)
+	}
+	if status := c.do("DELETE", "/api/templates/standup", nil, nil); status != http.StatusNoContent {
+		t.Errorf("Expected 204 deleting a template, got %d", status)
+	}
+	if status := c.do("GET", "/api/templates/standup", nil, nil); status != http.StatusNotFound {
+		t.Errorf("Expected a deleted template to be gone, got %d", status)
+	}
+}
+
+func TestServeWebUI(t *testing.T) {
+	c := setupTestServer(t)
+
+	// The page loads without the token, the API it calls doesn't
+	resp, err := http.Get(c.server.URL + "/")
+	if err != nil {
+		t.Fatalf("Failed to fetch the UI: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Errorf("Expected the UI page, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	for _, asset := range []string{"/app.js", "/style.css"} {
+		resp, err := http.Get(c.server.URL + asset)
+		if err != nil {
+			t.Fatalf("Failed to fetch %s: %v", asset, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected %s to be served, got %d", asset, resp.StatusCode)
+		}
+	}
+
+	var created Do
+	c.do("POST", "/api/dos", map[string]any{"description": "Render me"}, &created)
+	c.do("PUT", fmt.Sprintf("/api/dos/%d/doc", created.ID), map[string]any{"text": "# Plan\n\n- **one**\n\n<script>alert(1)</script>"}, nil)
+
+	var doc docResponse
+	c.do("GET", fmt.Sprintf("/api/dos/%d/doc", created.ID), nil, &doc)
+	if !strings.Contains(doc.HTML, "<h1>Plan</h1>") || !strings.Contains(doc.HTML, "<strong>one</strong>") {
+		t.Errorf("Expected the doc rendered as HTML, got %q", doc.HTML)
+	}
+	if strings.Contains(doc.HTML, "<script>") {
+		t.Errorf("Expected raw HTML to be left out, got %q", doc.HTML)
+	}
+}
@@ -0,0 +1,523 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"captain/logbook"
+
+	"github.com/fatih/color"
+	sebtable "github.com/s3bw/table"
+	"github.com/spf13/cobra"
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats --days=<n> --output=<table/json>",
+	Short: "Statistics about the logbook",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		days, _ := cmd.Flags().GetInt("days")
+		output, _ := cmd.Flags().GetString("output")
+
+		if output != "table" && output != "json" {
+			return invalidf("no such output: '%s'", output)
+		}
+
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+
+		// Scratched and promoted dos are counted too, as in heatmap
+		dos, err := svc.Query(logbook.Query{Deleted: true, Promoted: true})
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		stats := computeStats(dos, now.AddDate(0, 0, -days), now)
+
+		if output == "json" {
+			out, err := json.MarshalIndent(stats, "", "  ")
+			if err != nil {
+				return fmt.Errorf("could not encode stats: %w", err)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), string(out))
+			return nil
+		}
+
+		StatsLog(cmd.OutOrStdout(), stats)
+		return nil
+	},
+}
+
+// Stats is an aggregate view of the logbook over a date range
+type Stats struct {
+	From       time.Time     `json:"from"`
+	To         time.Time     `json:"to"`
+	Created    int           `json:"created"`
+	Completed  int           `json:"completed"`
+	Scratched  int           `json:"scratched"`
+	Weeks      []WeekCount   `json:"throughput"`
+	CycleTimes []CycleTime   `json:"cycle_times"`
+	OpenByAge  []AgeBucket   `json:"open_by_age"`
+	Reasons    []ReasonCount `json:"scratch_reasons"`
+	Crew       []CrewCount   `json:"crew"`
+}
+
+// ScratchRate is the share of dos created in the range that were scratched
+func (s Stats) ScratchRate() float64 {
+	if s.Created == 0 {
+		return 0
+	}
+	return float64(s.Scratched) / float64(s.Created)
+}
+
+type WeekCount struct {
+	Week  time.Time `json:"week"`
+	Count int       `json:"count"`
+}
+
+// CycleTime is the median time from creation to completion for a group
+type CycleTime struct {
+	Type     DoType  `json:"type"`
+	Priority DoPrio  `json:"priority"`
+	Count    int     `json:"count"`
+	Median   float64 `json:"median_minutes"`
+}
+
+type AgeBucket struct {
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+type ReasonCount struct {
+	Reason string `json:"reason"`
+	Count  int    `json:"count"`
+}
+
+type CrewCount struct {
+	Name  string `json:"name"`
+	Total int    `json:"total"`
+	Open  int    `json:"open"`
+}
+
+// ageBuckets are the upper bounds, in days, used to group open dos by age
+var ageBuckets = []struct {
+	Label string
+	Days  int
+}{
+	{"< 1d", 1},
+	{"1-7d", 7},
+	{"7-30d", 30},
+	{"30-90d", 90},
+	{"> 90d", -1},
+}
+
+// startOfWeek returns midnight on the Monday of the week containing t
+func startOfWeek(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	y, m, d := t.AddDate(0, 0, -offset).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+func inRange(t time.Time, from, to time.Time) bool {
+	return !t.Before(from) && !t.After(to)
+}
+
+// computeStats aggregates dos created or completed between from and to.
+// Open counts reflect the state of the logbook at to.
+func computeStats(dos []Do, from, to time.Time) Stats {
+	stats := Stats{From: from, To: to}
+
+	weeks := map[time.Time]int{}
+	for week := startOfWeek(from); !week.After(to); week = week.AddDate(0, 0, 7) {
+		weeks[week] = 0
+	}
+
+	type cycleKey struct {
+		Type     DoType
+		Priority DoPrio
+	}
+	cycles := map[cycleKey][]float64{}
+	open := make([]int, len(ageBuckets))
+	reasons := map[string]int{}
+	crew := map[string]*CrewCount{}
+
+	for _, do := range dos {
+		created := inRange(do.CreatedAt, from, to)
+		isOpen := !do.Completed && !do.Deleted
+
+		if created {
+			stats.Created++
+			if do.Deleted {
+				stats.Scratched++
+				reason := do.Reason
+				if reason == "" {
+					reason = "(no reason)"
+				}
+				reasons[reason]++
+			}
+		}
+
+		if do.Completed && do.CompletedAt != nil && !do.Deleted && inRange(*do.CompletedAt, from, to) {
+			stats.Completed++
+			// Weeks start at midnight where the range is, not in whatever zone
+			// the database gave back
+			weeks[startOfWeek(do.CompletedAt.In(from.Location()))]++
+
+			key := cycleKey{do.Type, do.Priority}
+			cycles[key] = append(cycles[key], float64(elapsedMinutes(do)))
+		}
+
+		if isOpen {
+			age := to.Sub(do.CreatedAt).Hours() / 24
+			for i, bucket := range ageBuckets {
+				if bucket.Days < 0 || age < float64(bucket.Days) {
+					open[i]++
+					break
+				}
+			}
+		}
+
+		if created || isOpen {
+			for _, tag := range do.Tags {
+				mate, ok := crew[tag.Name]
+				if !ok {
+					mate = &CrewCount{Name: tag.Name}
+					crew[tag.Name] = mate
+				}
+				if created {
+					mate.Total++
+				}
+				if isOpen {
+					mate.Open++
+				}
+			}
+		}
+	}
+
+	for week, count := range weeks {
+		stats.Weeks = append(stats.Weeks, WeekCount{Week: week, Count: count})
+	}
+	sort.Slice(stats.Weeks, func(i, j int) bool {
+		return stats.Weeks[i].Week.Before(stats.Weeks[j].Week)
+	})
+
+	for key, minutes := range cycles {
+		stats.CycleTimes = append(stats.CycleTimes, CycleTime{
+			Type:     key.Type,
+			Priority: key.Priority,
+			Count:    len(minutes),
+			Median:   median(minutes),
+		})
+	}
+	sort.Slice(stats.CycleTimes, func(i, j int) bool {
+		a, b := stats.CycleTimes[i], stats.CycleTimes[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return logbook.PriorityRank(a.Priority) < logbook.PriorityRank(b.Priority)
+	})
+
+	for i, bucket := range ageBuckets {
+		stats.OpenByAge = append(stats.OpenByAge, AgeBucket{Label: bucket.Label, Count: open[i]})
+	}
+
+	for reason, count := range reasons {
+		stats.Reasons = append(stats.Reasons, ReasonCount{Reason: reason, Count: count})
+	}
+	sort.Slice(stats.Reasons, func(i, j int) bool {
+		if stats.Reasons[i].Count != stats.Reasons[j].Count {
+			return stats.Reasons[i].Count > stats.Reasons[j].Count
+		}
+		return stats.Reasons[i].Reason < stats.Reasons[j].Reason
+	})
+	if len(stats.Reasons) > 5 {
+		stats.Reasons = stats.Reasons[:5]
+	}
+
+	for _, mate := range crew {
+		stats.Crew = append(stats.Crew, *mate)
+	}
+	sort.Slice(stats.Crew, func(i, j int) bool {
+		if stats.Crew[i].Total != stats.Crew[j].Total {
+			return stats.Crew[i].Total > stats.Crew[j].Total
+		}
+		return stats.Crew[i].Name < stats.Crew[j].Name
+	})
+
+	return stats
+}
+
+var sparkTicks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders counts as a single line of block characters
+func sparkline(counts []int) string {
+	max := 0
+	for _, c := range counts {
+		if c > max {
+			max = c
+		}
+	}
+
+	spark := make([]rune, len(counts))
+	for i, c := range counts {
+		if max == 0 {
+			spark[i] = sparkTicks[0]
+			continue
+		}
+		spark[i] = sparkTicks[c*(len(sparkTicks)-1)/max]
+	}
+	return string(spark)
+}
+
+func StatsLog(w io.Writer, stats Stats) {
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+
+	fmt.Fprintf(w, "%s %s -> %s\n\n",
+		highlightStyle.Render("stats"),
+		stats.From.Format("02-Jan-06"),
+		stats.To.Format("02-Jan-06"),
+	)
+	fmt.Fprintf(w, "created: %d  completed: %d  scratched: %d (%.0f%%)\n\n",
+		stats.Created, stats.Completed, stats.Scratched, stats.ScratchRate()*100)
+
+	var counts []int
+	for _, week := range stats.Weeks {
+		counts = append(counts, week.Count)
+	}
+	fmt.Fprintln(w, highlightStyle.Render("throughput per week"))
+	fmt.Fprintf(w, "%s  (%d weeks)\n\n", sparkline(counts), len(counts))
+
+	fmt.Fprintln(w, highlightStyle.Render("median cycle time"))
+	if len(stats.CycleTimes) == 0 {
+		fmt.Fprintln(w, "Nothing completed in range.")
+	} else {
+		tbl := sebtable.New("type", "prio", "dos", "median").WithWriter(w)
+		tbl.WithHeaderFormatter(headerFmt)
+		for _, ct := range stats.CycleTimes {
+			tbl.AddRow(ct.Type, ct.Priority, ct.Count, fmtMinutes(int(ct.Median)))
+		}
+		tbl.Print()
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, highlightStyle.Render("open by age"))
+	counts = nil
+	tbl := sebtable.New("age", "open").WithWriter(w)
+	tbl.WithHeaderFormatter(headerFmt)
+	for _, bucket := range stats.OpenByAge {
+		tbl.AddRow(bucket.Label, bucket.Count)
+		counts = append(counts, bucket.Count)
+	}
+	tbl.Print()
+	fmt.Fprintln(w, sparkline(counts))
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, highlightStyle.Render("top scratch reasons"))
+	if len(stats.Reasons) == 0 {
+		fmt.Fprintln(w, "Nothing scratched in range.")
+	} else {
+		tbl := sebtable.New("reason", "count").WithWriter(w)
+		tbl.WithHeaderFormatter(headerFmt)
+		for _, reason := range stats.Reasons {
+			tbl.AddRow(reason.Reason, reason.Count)
+		}
+		tbl.Print()
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, highlightStyle.Render("busiest crew"))
+	if len(stats.Crew) == 0 {
+		fmt.Fprintln(w, "We've got no crew!")
+	} else {
+		tbl := sebtable.New("name", "dos", "open").WithWriter(w)
+		tbl.WithHeaderFormatter(headerFmt)
+		for _, mate := range stats.Crew {
+			tbl.AddRow(mate.Name, mate.Total, mate.Open)
+		}
+		tbl.Print()
+	}
+}
+
+// EstimateRow summarises how estimates compared to actuals for a group
+type EstimateRow struct {
+	Group     string
+	Count     int
+	Estimated int // minutes
+	Actual    int // minutes
+	Median    float64
+}
+
+// Ratio is the total actual time over the total estimated time
+func (r EstimateRow) Ratio() float64 {
+	if r.Estimated == 0 {
+		return 0
+	}
+	return float64(r.Actual) / float64(r.Estimated)
+}
+
+// elapsedMinutes is the time between a do being created and completed. It's
+// calendar time, nights and weekends included, not time spent working on it.
+func elapsedMinutes(do Do) int {
+	if do.CompletedAt == nil {
+		return 0
+	}
+	return int(do.CompletedAt.Sub(do.CreatedAt).Minutes())
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// estimateAccuracy groups completed, estimated dos by the keys returned from
+// groupBy and compares their estimates to the elapsed time.
+func estimateAccuracy(dos []Do, groupBy func(Do) []string) []EstimateRow {
+	rows := map[string]*EstimateRow{}
+	ratios := map[string][]float64{}
+
+	for _, do := range dos {
+		if do.Estimate <= 0 || do.CompletedAt == nil {
+			continue
+		}
+		actual := elapsedMinutes(do)
+
+		for _, key := range groupBy(do) {
+			row, ok := rows[key]
+			if !ok {
+				row = &EstimateRow{Group: key}
+				rows[key] = row
+			}
+			row.Count++
+			row.Estimated += do.Estimate
+			row.Actual += actual
+			ratios[key] = append(ratios[key], float64(actual)/float64(do.Estimate))
+		}
+	}
+
+	var result []EstimateRow
+	for key, row := range rows {
+		row.Median = median(ratios[key])
+		result = append(result, *row)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Group < result[j].Group
+	})
+	return result
+}
+
+func byType(do Do) []string {
+	return []string{string(do.Type)}
+}
+
+func byCrew(do Do) []string {
+	if len(do.Tags) == 0 {
+		return []string{"-"}
+	}
+	var names []string
+	for _, tag := range do.Tags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
+
+func EstimateLog(w io.Writer, title string, rows []EstimateRow) {
+	fmt.Fprintln(w, highlightStyle.Render(title))
+
+	if len(rows) == 0 {
+		fmt.Fprintln(w, "Nothing estimated and completed yet.")
+		return
+	}
+
+	tbl := sebtable.New(title, "dos", "estimated", "actual", "ratio", "median").WithWriter(w)
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	tbl.WithHeaderFormatter(headerFmt)
+
+	for _, row := range rows {
+		tbl.AddRow(
+			row.Group,
+			row.Count,
+			fmtMinutes(row.Estimated),
+			fmtMinutes(row.Actual),
+			fmt.Sprintf("x%.2f", row.Ratio()),
+			fmt.Sprintf("x%.2f", row.Median),
+		)
+	}
+
+	tbl.Print()
+}
+
+var statsEstimatesCmd = &cobra.Command{
+	Use:   "estimates --days=<n> --type=<type> --for=<tag.name>",
+	Short: "Compare estimates to elapsed time per type and crew",
+	Long: `Compare estimates to elapsed time per type and crew. The actual time of a do
+is the calendar time from creating it to completing it, nights and weekends
+included, so a day is 24 hours in both.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		days, _ := cmd.Flags().GetInt("days")
+		doType, _ := cmd.Flags().GetString("type")
+		forTag, _ := cmd.Flags().GetString("for")
+
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+
+		completed := true
+		query := logbook.Query{Completed: &completed, For: forTag, Promoted: true}
+		if days > 0 {
+			since := time.Now().AddDate(0, 0, -days)
+			query.CompletedSince = &since
+		}
+		if doType != "" {
+			query.Type = mapType(doType)
+		}
+
+		found, err := svc.Query(query)
+		if err != nil {
+			return err
+		}
+
+		var dos []Do
+		for _, do := range found {
+			if do.Estimate > 0 && do.CompletedAt != nil {
+				dos = append(dos, do)
+			}
+		}
+
+		out := cmd.OutOrStdout()
+		EstimateLog(out, "type", estimateAccuracy(dos, byType))
+		fmt.Fprintln(out)
+		EstimateLog(out, "crew", estimateAccuracy(dos, byCrew))
+		return nil
+	},
+}
+
+func init() {
+	statsCmd.Flags().Int("days", 84, "Number of days to aggregate over")
+	statsCmd.Flags().String("output", "table", "Set the output (table/json)")
+
+	statsEstimatesCmd.Flags().Int("days", 90, "Only include dos completed in the last n days (0 for all)")
+	statsEstimatesCmd.Flags().String("type", "", "Filter by type (task/ask/tell/brag/learn/pr/meta)")
+	statsEstimatesCmd.Flags().String("for", "", "Filter by tag/person")
+
+	statsCmd.AddCommand(statsEstimatesCmd)
+	RootCmd.AddCommand(statsCmd)
+}
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"captain/logbook"
+)
+
+func TestMapEstimate(t *testing.T) {
+	tests := []struct {
+		input     string
+		expected  int
+		expectErr bool
+	}{
+		{"", 0, false},
+		{"90", 90, false},
+		{"1h30m", 90, false},
+		{"2h", 120, false},
+		{"xs", 30, false},
+		{"M", 240, false},
+		{"xl", 4320, false},
+		{"huge", 0, true},
+		{"-5", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := mapEstimate(tt.input)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("mapEstimate(%s) error = %v, expected error: %v", tt.input, err, tt.expectErr)
+			}
+			if result != tt.expected {
+				t.Errorf("mapEstimate(%s) = %d, expected %d", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFmtMinutes(t *testing.T) {
+	tests := []struct {
+		input    int
+		expected string
+	}{
+		{0, "-"},
+		{45, "45m"},
+		{60, "1h"},
+		{90, "1h30m"},
+		{1500, "1d1h"},
+		{tShirtSizes["xl"], "3d"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			if result := fmtMinutes(tt.input); result != tt.expected {
+				t.Errorf("fmtMinutes(%d) = %s, expected %s", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEstimateAccuracy(t *testing.T) {
+	created := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	completedAfter := func(minutes int) *time.Time {
+		at := created.Add(time.Duration(minutes) * time.Minute)
+		return &at
+	}
+
+	dos := []Do{
+		{Type: PR, Estimate: 60, CreatedAt: created, CompletedAt: completedAfter(120), Tags: []Tag{{Name: "alice"}}},
+		{Type: PR, Estimate: 60, CreatedAt: created, CompletedAt: completedAfter(60), Tags: []Tag{{Name: "alice"}}},
+		{Type: Task, Estimate: 30, CreatedAt: created, CompletedAt: completedAfter(15)},
+		// Ignored: no estimate, or not completed
+		{Type: PR, CreatedAt: created, CompletedAt: completedAfter(60)},
+		{Type: PR, Estimate: 30, CreatedAt: created},
+	}
+
+	rows := estimateAccuracy(dos, byType)
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(rows))
+	}
+
+	pr := rows[0]
+	if pr.Group != "PR" || pr.Count != 2 {
+		t.Errorf("Expected 2 PR dos first, got %s with %d", pr.Group, pr.Count)
+	}
+	if pr.Estimated != 120 || pr.Actual != 180 {
+		t.Errorf("Expected 120 estimated and 180 actual, got %d and %d", pr.Estimated, pr.Actual)
+	}
+	if pr.Ratio() != 1.5 {
+		t.Errorf("Expected ratio 1.5, got %v", pr.Ratio())
+	}
+	if pr.Median != 1.5 {
+		t.Errorf("Expected median 1.5, got %v", pr.Median)
+	}
+
+	crew := estimateAccuracy(dos, byCrew)
+	if len(crew) != 2 || crew[0].Group != "alice" || crew[1].Group != "-" {
+		t.Errorf("Expected alice then untagged, got %+v", crew)
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		name     string
+		counts   []int
+		expected string
+	}{
+		{"empty", nil, ""},
+		{"all zero", []int{0, 0}, "▁▁"},
+		{"ramp", []int{0, 1, 7}, "▁▂█"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := sparkline(tt.counts); result != tt.expected {
+				t.Errorf("sparkline(%v) = %s, expected %s", tt.counts, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestComputeStats(t *testing.T) {
+	to := time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC) // Friday
+	from := to.AddDate(0, 0, -14)
+	at := func(daysAgo int, hours int) *time.Time {
+		t := to.AddDate(0, 0, -daysAgo).Add(time.Duration(hours) * time.Hour)
+		return &t
+	}
+
+	alice := Tag{Name: "alice"}
+	dos := []Do{
+		// Completed in range
+		{Type: Task, Priority: High, CreatedAt: *at(3, 0), Completed: true, CompletedAt: at(3, 2)},
+		{Type: Task, Priority: High, CreatedAt: *at(2, 0), Completed: true, CompletedAt: at(2, 4), Tags: []Tag{alice}},
+		// Open, one fresh and one old
+		{Type: Ask, Priority: Medium, CreatedAt: *at(0, -2), Tags: []Tag{alice}},
+		{Type: Task, Priority: Low, CreatedAt: *at(100, 0)},
+		// Scratched in range
+		{Type: Task, CreatedAt: *at(5, 0), Deleted: true, Reason: "duplicate"},
+		{Type: Task, CreatedAt: *at(4, 0), Deleted: true, Reason: "duplicate"},
+		{Type: Task, CreatedAt: *at(4, 0), Deleted: true},
+	}
+
+	stats := computeStats(dos, from, to)
+
+	if stats.Created != 6 {
+		t.Errorf("Expected 6 created, got %d", stats.Created)
+	}
+	if stats.Completed != 2 {
+		t.Errorf("Expected 2 completed, got %d", stats.Completed)
+	}
+	if stats.Scratched != 3 || stats.ScratchRate() != 0.5 {
+		t.Errorf("Expected 3 scratched at 50%%, got %d at %v", stats.Scratched, stats.ScratchRate())
+	}
+
+	total := 0
+	for _, week := range stats.Weeks {
+		if week.Week.Weekday() != time.Monday {
+			t.Errorf("Expected weeks to start on Monday, got %s", week.Week.Weekday())
+		}
+		total += week.Count
+	}
+	if total != 2 || len(stats.Weeks) != 3 {
+		t.Errorf("Expected 2 completions over 3 weeks, got %d over %d", total, len(stats.Weeks))
+	}
+
+	if len(stats.CycleTimes) != 1 || stats.CycleTimes[0].Median != 180 {
+		t.Errorf("Expected a single task/high median of 180 minutes, got %+v", stats.CycleTimes)
+	}
+
+	if stats.OpenByAge[0].Count != 1 || stats.OpenByAge[len(stats.OpenByAge)-1].Count != 1 {
+		t.Errorf("Expected one fresh and one stale open do, got %+v", stats.OpenByAge)
+	}
+
+	if len(stats.Reasons) != 2 || stats.Reasons[0].Reason != "duplicate" || stats.Reasons[0].Count != 2 {
+		t.Errorf("Expected 'duplicate' as the top reason, got %+v", stats.Reasons)
+	}
+
+	if len(stats.Crew) != 1 || stats.Crew[0].Total != 2 || stats.Crew[0].Open != 1 {
+		t.Errorf("Expected alice with 2 dos and 1 open, got %+v", stats.Crew)
+	}
+}
+
+func TestComputeStatsFromTheDB(t *testing.T) {
+	conn, err := logbook.Open(filepath.Join(t.TempDir(), "captain.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	// SQLite hands times back in a zone of its own, not time.Local
+	to := time.Now()
+	from := to.AddDate(0, 0, -91)
+	for _, daysAgo := range []int{1, 30, 60} {
+		completed := to.AddDate(0, 0, -daysAgo)
+		conn.Create(&Do{Description: "Done", Type: Task, CreatedAt: completed.Add(-time.Hour), Completed: true, CompletedAt: &completed})
+	}
+	var dos []Do
+	conn.Find(&dos)
+
+	stats := computeStats(dos, from, to)
+	total := 0
+	for _, week := range stats.Weeks {
+		total += week.Count
+	}
+	if want := len(computeStats(nil, from, to).Weeks); len(stats.Weeks) != want || total != 3 {
+		t.Errorf("Expected 3 completions over %d weeks, got %d over %d", want, total, len(stats.Weeks))
+	}
+}
+
+func TestStatsCommandCountsPromotedDos(t *testing.T) {
+	store := logbook.NewMemStore()
+	runCaptain(t, store, "do", "Ship it")
+	runCaptain(t, store, "did", "1")
+	if _, err := logbook.New(store).Promote(1, "ship"); err != nil {
+		t.Fatalf("Failed to promote: %v", err)
+	}
+
+	out, err := runCaptain(t, store, "stats")
+	if err != nil || !strings.Contains(out, "created: 1  completed: 1") {
+		t.Errorf("Expected the promoted do counted, as in heatmap, got %v:\n%s", err, out)
+	}
+}
@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const taskwarriorTime = "20060102T150405Z"
+
+// taskwarriorTask is a task as written by `task export`
+type taskwarriorTask struct {
+	UUID        string                  `json:"uuid"`
+	Description string                  `json:"description"`
+	Status      string                  `json:"status"`
+	Entry       string                  `json:"entry,omitempty"`
+	End         string                  `json:"end,omitempty"`
+	Due         string                  `json:"due,omitempty"`
+	Scheduled   string                  `json:"scheduled,omitempty"`
+	Wait        string                  `json:"wait,omitempty"`
+	Priority    string                  `json:"priority,omitempty"`
+	Project     string                  `json:"project,omitempty"`
+	Tags        []string                `json:"tags,omitempty"`
+	Annotations []taskwarriorAnnotation `json:"annotations,omitempty"`
+}
+
+type taskwarriorAnnotation struct {
+	Entry       string `json:"entry"`
+	Description string `json:"description"`
+}
+
+var (
+	taskwarriorUUID = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	captainUID      = regexp.MustCompile(`^[0-9a-f]{32}@captain$`)
+)
+
+// taskwarriorUUIDFor converts a do's UID to the uuid Taskwarrior requires.
+// Captain's own UIDs convert back with uidForTaskwarrior, any other UID gets
+// a uuid derived from it.
+func taskwarriorUUIDFor(uid string) string {
+	hexed := strings.TrimSuffix(uid, "@captain")
+	switch {
+	case captainUID.MatchString(uid):
+	case taskwarriorUUID.MatchString(uid):
+		return uid
+	default:
+		sum := sha1.Sum([]byte(uid))
+		hexed = hex.EncodeToString(sum[:16])
+	}
+	return fmt.Sprintf("%s-%s-%s-%s-%s", hexed[:8], hexed[8:12], hexed[12:16], hexed[16:20], hexed[20:32])
+}
+
+func uidForTaskwarrior(uuid string) string {
+	uuid = strings.ToLower(uuid)
+	if !taskwarriorUUID.MatchString(uuid) {
+		return uuid
+	}
+	return strings.ReplaceAll(uuid, "-", "") + "@captain"
+}
+
+func taskwarriorPrio(p DoPrio) string {
+	switch p {
+	case High:
+		return "H"
+	case Low:
+		return "L"
+	default:
+		return "M"
+	}
+}
+
+func mapTaskwarriorPrio(p string) DoPrio {
+	switch strings.ToUpper(p) {
+	case "H":
+		return High
+	case "L":
+		return Low
+	default:
+		return Medium
+	}
+}
+
+func formatTaskwarriorTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(taskwarriorTime)
+}
+
+func parseTaskwarriorTime(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(taskwarriorTime, s)
+	if err != nil {
+		return nil, fmt.Errorf("bad timestamp '%s'", s)
+	}
+	t = t.Local()
+	return &t, nil
+}
+
+// exportTaskwarrior writes a JSON array that `task import` accepts. The
+// type becomes a tag and the doc becomes a single annotation.
+func exportTaskwarrior(w io.Writer, dos []Do) error {
+	tasks := []taskwarriorTask{}
+
+	for _, do := range dos {
+		created := do.CreatedAt
+		task := taskwarriorTask{
+			UUID:        taskwarriorUUIDFor(do.UID),
+			Description: do.Description,
+			Status:      "pending",
+			Entry:       formatTaskwarriorTime(&created),
+			Due:         formatTaskwarriorTime(do.DueAt),
+			Scheduled:   formatTaskwarriorTime(do.ScheduledAt),
+			Priority:    taskwarriorPrio(do.Priority),
+			Tags:        []string{string(do.Type)},
+		}
+		if do.Completed {
+			task.Status = "completed"
+			task.End = formatTaskwarriorTime(do.CompletedAt)
+		}
+		for _, tag := range do.Tags {
+			task.Tags = append(task.Tags, tag.Name)
+		}
+		if do.Doc.ID != 0 && strings.TrimSpace(do.Doc.Text) != "" {
+			task.Annotations = append(task.Annotations, taskwarriorAnnotation{
+				Entry:       task.Entry,
+				Description: do.Doc.Text,
+			})
+		}
+		tasks = append(tasks, task)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(tasks)
+}
+
+// importTaskwarrior reads the output of `task export`. Tags naming a do type
+// set the type, other tags are crew if they're in the crew already, and the
+// project and annotations are written to the doc. Deleted and recurring template tasks are skipped.
+func importTaskwarrior(r io.Reader) ([]importedDo, error) {
+	var tasks []taskwarriorTask
+	if err := json.NewDecoder(r).Decode(&tasks); err != nil {
+		return nil, err
+	}
+
+	var items []importedDo
+	for _, task := range tasks {
+		if task.Status == "deleted" || task.Status == "recurring" || task.Description == "" {
+			continue
+		}
+
+		item := importedDo{Do: Do{
+			UID:         uidForTaskwarrior(task.UUID),
+			Description: task.Description,
+			Type:        Task,
+			Priority:    mapTaskwarriorPrio(task.Priority),
+			CreatedAt:   time.Now(),
+			Completed:   task.Status == "completed",
+		}}
+
+		var err error
+		var entry *time.Time
+		if entry, err = parseTaskwarriorTime(task.Entry); err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			item.Do.CreatedAt = *entry
+		}
+		if item.Do.DueAt, err = parseTaskwarriorTime(task.Due); err != nil {
+			return nil, err
+		}
+		if item.Do.ScheduledAt, err = parseTaskwarriorTime(task.Scheduled); err != nil {
+			return nil, err
+		}
+		if item.Do.ScheduledAt == nil {
+			if item.Do.ScheduledAt, err = parseTaskwarriorTime(task.Wait); err != nil {
+				return nil, err
+			}
+		}
+		if item.Do.Completed {
+			if item.Do.CompletedAt, err = parseTaskwarriorTime(task.End); err != nil {
+				return nil, err
+			}
+			if item.Do.CompletedAt == nil {
+				now := time.Now()
+				item.Do.CompletedAt = &now
+			}
+		}
+
+		for _, tag := range task.Tags {
+			if isDoType(tag) {
+				item.Do.Type = mapType(tag)
+			} else {
+				item.Categories = append(item.Categories, tag)
+			}
+		}
+
+		var notes []string
+		for _, annotation := range task.Annotations {
+			// A single annotation is our own exported doc, keep it as is
+			if len(task.Annotations) == 1 {
+				notes = append(notes, annotation.Description)
+				continue
+			}
+			when := annotation.Entry
+			if at, err := parseTaskwarriorTime(annotation.Entry); err == nil && at != nil {
+				when = at.Format("2006-01-02 15:04")
+			}
+			notes = append(notes, fmt.Sprintf("- %s: %s", when, annotation.Description))
+		}
+
+		var doc []string
+		if task.Project != "" {
+			doc = append(doc, fmt.Sprintf("Project: %s", task.Project))
+		}
+		if len(notes) > 0 {
+			doc = append(doc, strings.Join(notes, "\n"))
+		}
+		item.Doc = strings.Join(doc, "\n\n")
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
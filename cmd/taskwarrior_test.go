@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportTaskwarrior(t *testing.T) {
+	input := `[
+  {"uuid":"5f1b6a6e-2c1d-4c7e-9d5e-1a2b3c4d5e6f","description":"Fix the build","status":"pending",
+   "entry":"20250301T090000Z","due":"20250314T170000Z","priority":"H","project":"infra","tags":["pr","alice"],
+   "annotations":[{"entry":"20250302T100000Z","description":"Flaky on CI"},{"entry":"20250303T100000Z","description":"Needs a retry"}]},
+  {"uuid":"6f1b6a6e-2c1d-4c7e-9d5e-1a2b3c4d5e6f","description":"Done already","status":"completed",
+   "entry":"20250301T090000Z","end":"20250305T090000Z"},
+  {"uuid":"7f1b6a6e-2c1d-4c7e-9d5e-1a2b3c4d5e6f","description":"Gone","status":"deleted"}
+]`
+
+	items, err := importTaskwarrior(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("Expected deleted tasks to be skipped, got %d items", len(items))
+	}
+
+	build := items[0]
+	if build.Do.Type != PR || build.Do.Priority != High {
+		t.Errorf("Expected PR/high, got %s/%s", build.Do.Type, build.Do.Priority)
+	}
+	if len(build.Categories) != 1 || build.Categories[0] != "alice" {
+		t.Errorf("Expected crew [alice], got %v", build.Categories)
+	}
+	if build.Do.DueAt == nil || build.Do.DueAt.UTC().Hour() != 17 {
+		t.Errorf("Expected due at 17:00 UTC, got %v", build.Do.DueAt)
+	}
+	if !strings.Contains(build.Doc, "Project: infra") || !strings.Contains(build.Doc, "Flaky on CI") || !strings.Contains(build.Doc, "Needs a retry") {
+		t.Errorf("Expected project and annotations in the doc, got %q", build.Doc)
+	}
+
+	done := items[1]
+	if !done.Do.Completed || done.Do.CompletedAt == nil || done.Do.CompletedAt.UTC().Day() != 5 {
+		t.Errorf("Expected completion on the 5th, got %v", done.Do.CompletedAt)
+	}
+}
+
+func TestTaskwarriorRoundTrip(t *testing.T) {
+	created := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	uid, err := newUID()
+	if err != nil {
+		t.Fatalf("newUID: %v", err)
+	}
+
+	dos := []Do{
+		{UID: uid, Description: "Write notes", Type: Learn, Priority: Low, CreatedAt: created, Doc: DoDoc{ID: 1, Text: "Some notes"}, Tags: []Tag{{Name: "carol"}}},
+		{UID: "event-1", Description: "From a calendar", Type: Task, Priority: Medium, CreatedAt: created},
+	}
+
+	var buf bytes.Buffer
+	if err := exportTaskwarrior(&buf, dos); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	items, err := importTaskwarrior(&buf)
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(items))
+	}
+
+	notes := items[0]
+	if notes.Do.UID != uid {
+		t.Errorf("Expected uid %s to round trip, got %s", uid, notes.Do.UID)
+	}
+	if notes.Do.Type != Learn || notes.Do.Priority != Low {
+		t.Errorf("Expected learn/low, got %s/%s", notes.Do.Type, notes.Do.Priority)
+	}
+	if notes.Doc != "Some notes" {
+		t.Errorf("Expected the doc to round trip, got %q", notes.Doc)
+	}
+	if !notes.Do.CreatedAt.Equal(created) {
+		t.Errorf("Expected created %v, got %v", created, notes.Do.CreatedAt)
+	}
+
+	if !taskwarriorUUID.MatchString(taskwarriorUUIDFor("event-1")) {
+		t.Error("Expected a valid uuid to be derived for other uids")
+	}
+	if taskwarriorUUIDFor("event-1") != taskwarriorUUIDFor("event-1") {
+		t.Error("Expected derived uuids to be stable")
+	}
+}
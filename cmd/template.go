@@ -2,13 +2,12 @@ package cmd
 
 import (
 	"fmt"
-	"log"
 	"os"
 	"os/exec"
+	"sort"
 	"strings"
 
 	"github.com/fatih/color"
-	"github.com/s3bw/mostxt/src"
 	sebtable "github.com/s3bw/table"
 	"github.com/spf13/cobra"
 )
@@ -23,24 +22,24 @@ var templateCreateCmd = &cobra.Command{
 	Use:   "create <name>",
 	Short: "Create a new template",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		name := args[0]
+		out := cmd.OutOrStdout()
 
-		conn := OpenConn(&cfg)
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
 
 		// Check if template already exists
-		var existing Template
-		result := conn.Where("name = ? AND deleted = ?", name, false).First(&existing)
-		if result.Error == nil {
-			fmt.Printf("Template '%s' already exists. Use 'captain template edit %s' to modify it.\n", name, name)
-			return
+		if _, err := svc.Template(name); err == nil {
+			return existsf("template '%s' already exists, use 'captain template edit %s' to modify it", name, name)
 		}
 
 		// Create temporary file for editing
 		tmpfile, err := os.CreateTemp("", fmt.Sprintf("template-create-%s-*.md", name))
 		if err != nil {
-			fmt.Printf("Error creating temporary file: %v\n", err)
-			return
+			return fmt.Errorf("could not create temporary file: %w", err)
 		}
 		defer os.Remove(tmpfile.Name())
 
@@ -55,56 +54,48 @@ var templateCreateCmd = &cobra.Command{
 		editorCmd.Stderr = os.Stderr
 		err = editorCmd.Run()
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
 		// Read the content
 		content, err := os.ReadFile(tmpfile.Name())
 		if err != nil {
-			fmt.Printf("Error reading template content: %v\n", err)
-			return
-		}
-
-		contentStr := strings.TrimSpace(string(content))
-		if contentStr == "" {
-			fmt.Println("Template content is empty. Not saving.")
-			return
+			return fmt.Errorf("could not read template content: %w", err)
 		}
 
-		// Validate template syntax
-		_, err = src.ParseTemplate(contentStr)
-		if err != nil {
-			fmt.Printf("Error parsing template syntax: %v\n", err)
-			fmt.Println("Template not saved. Please fix the syntax and try again.")
-			return
+		if _, err := svc.CreateTemplate(name, string(content)); err != nil {
+			return fmt.Errorf("template not saved: %w", err)
 		}
-
-		// Save to database
-		template := Template{
-			Name:    name,
-			Content: contentStr,
-			Deleted: false,
-		}
-		conn.Create(&template)
-		fmt.Printf("Created template '%s'\n", name)
+		fmt.Fprintf(out, "Created template '%s'\n", name)
+		return nil
 	},
 }
 
 var templateListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all templates",
-	Run: func(cmd *cobra.Command, args []string) {
-		conn := OpenConn(&cfg)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
 
-		var templates []Template
-		conn.Where("deleted = ?", false).Order("updated_at DESC").Find(&templates)
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+		templates, err := svc.Templates()
+		if err != nil {
+			return err
+		}
+		// Most recently changed first
+		sort.SliceStable(templates, func(i, j int) bool {
+			return templates[i].UpdatedAt.After(templates[j].UpdatedAt)
+		})
 
 		if len(templates) == 0 {
-			fmt.Println("No templates found.")
-			return
+			fmt.Fprintln(out, "No templates found.")
+			return nil
 		}
 
-		tbl := sebtable.New("name", "preview", "updated")
+		tbl := sebtable.New("name", "preview", "updated").WithWriter(out)
 		headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
 		tbl.WithHeaderFormatter(headerFmt)
 
@@ -122,6 +113,7 @@ var templateListCmd = &cobra.Command{
 		}
 
 		tbl.Print()
+		return nil
 	},
 }
 
@@ -129,31 +121,30 @@ var templateEditCmd = &cobra.Command{
 	Use:   "edit <name>",
 	Short: "Edit an existing template",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		name := args[0]
+		out := cmd.OutOrStdout()
 
-		conn := OpenConn(&cfg)
-
-		var template Template
-		result := conn.Where("name = ? AND deleted = ?", name, false).First(&template)
-		if result.Error != nil {
-			fmt.Printf("No template named '%s'\n", name)
-			return
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+		template, err := svc.Template(name)
+		if err != nil {
+			return err
 		}
 
 		// Create temporary file with current content
 		tmpfile, err := os.CreateTemp("", fmt.Sprintf("template-edit-%s-*.md", name))
 		if err != nil {
-			fmt.Printf("Error creating temporary file: %v\n", err)
-			return
+			return fmt.Errorf("could not create temporary file: %w", err)
 		}
 		defer os.Remove(tmpfile.Name())
 
 		// Write current content
 		_, err = tmpfile.WriteString(template.Content)
 		if err != nil {
-			fmt.Printf("Error writing to temporary file: %v\n", err)
-			return
+			return fmt.Errorf("could not write to temporary file: %w", err)
 		}
 
 		// Open editor
@@ -167,30 +158,20 @@ var templateEditCmd = &cobra.Command{
 		editorCmd.Stderr = os.Stderr
 		err = editorCmd.Run()
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
 		// Read the edited content
 		content, err := os.ReadFile(tmpfile.Name())
 		if err != nil {
-			fmt.Printf("Error reading edited content: %v\n", err)
-			return
+			return fmt.Errorf("could not read edited content: %w", err)
 		}
 
-		contentStr := strings.TrimSpace(string(content))
-
-		// Validate template syntax
-		_, err = src.ParseTemplate(contentStr)
-		if err != nil {
-			fmt.Printf("Error parsing template syntax: %v\n", err)
-			fmt.Println("Template not saved. Please fix the syntax and try again.")
-			return
+		if _, err := svc.UpdateTemplate(name, string(content)); err != nil {
+			return fmt.Errorf("template not saved: %w", err)
 		}
-
-		// Update the template
-		template.Content = contentStr
-		conn.Save(&template)
-		fmt.Printf("Updated template '%s'\n", name)
+		fmt.Fprintf(out, "Updated template '%s'\n", name)
+		return nil
 	},
 }
 
@@ -198,32 +179,32 @@ var templateDeleteCmd = &cobra.Command{
 	Use:   "delete <name>",
 	Short: "Delete a template",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		name := args[0]
+		out := cmd.OutOrStdout()
 
-		conn := OpenConn(&cfg)
-
-		var template Template
-		result := conn.Where("name = ? AND deleted = ?", name, false).First(&template)
-		if result.Error != nil {
-			fmt.Printf("No template named '%s'\n", name)
-			return
+		svc, err := newService(&cfg)
+		if err != nil {
+			return err
+		}
+		if _, err := svc.Template(name); err != nil {
+			return err
 		}
 
 		// Simple confirmation prompt
-		fmt.Printf("Delete template '%s'? (y/n): ", name)
+		fmt.Fprintf(out, "Delete template '%s'? (y/n): ", name)
 		var response string
-		fmt.Scanln(&response)
+		fmt.Fscanln(cmd.InOrStdin(), &response)
 		response = strings.ToLower(strings.TrimSpace(response))
 
 		if response == "y" || response == "yes" {
-			// Soft delete
-			template.Deleted = true
-			conn.Save(&template)
-			fmt.Printf("Deleted template '%s'\n", name)
-		} else {
-			fmt.Println("Template deletion cancelled")
+			if _, err := svc.DeleteTemplate(name); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Deleted template '%s'\n", name)
+			return nil
 		}
+		return declined("template deletion")
 	},
 }
 
@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const todoTxtDate = "2006-01-02"
+
+var todoTxtPriority = regexp.MustCompile(`^\(([A-Z])\) `)
+
+func todoTxtPrio(p DoPrio) string {
+	switch p {
+	case High:
+		return "A"
+	case Low:
+		return "C"
+	default:
+		return "B"
+	}
+}
+
+// mapTodoTxtPrio maps A to high, B to medium and anything lower to low
+func mapTodoTxtPrio(p string) DoPrio {
+	switch p {
+	case "A":
+		return High
+	case "B", "":
+		return Medium
+	default:
+		return Low
+	}
+}
+
+// exportTodoTxt writes a line per do. The type is written as a +project,
+// crew as @contexts, and the uid as a key so a re-import updates the do.
+func exportTodoTxt(w io.Writer, dos []Do) error {
+	for _, do := range dos {
+		var parts []string
+
+		if do.Completed {
+			parts = append(parts, "x")
+			if do.CompletedAt != nil {
+				parts = append(parts, do.CompletedAt.Format(todoTxtDate))
+			}
+		} else {
+			parts = append(parts, fmt.Sprintf("(%s)", todoTxtPrio(do.Priority)))
+		}
+
+		parts = append(parts, do.CreatedAt.Format(todoTxtDate))
+		parts = append(parts, strings.ReplaceAll(do.Description, "\n", " "))
+		parts = append(parts, "+"+string(do.Type))
+		for _, tag := range do.Tags {
+			parts = append(parts, "@"+tag.Name)
+		}
+		if do.Completed {
+			parts = append(parts, "pri:"+todoTxtPrio(do.Priority))
+		}
+		if do.DueAt != nil {
+			parts = append(parts, "due:"+do.DueAt.Format(todoTxtDate))
+		}
+		if do.ScheduledAt != nil {
+			parts = append(parts, "t:"+do.ScheduledAt.Format(todoTxtDate))
+		}
+		if do.UID != "" {
+			parts = append(parts, "uid:"+do.UID)
+		}
+
+		if _, err := fmt.Fprintln(w, strings.Join(parts, " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseTodoTxtDate(s string) (*time.Time, bool) {
+	t, err := time.ParseInLocation(todoTxtDate, s, time.Local)
+	if err != nil {
+		return nil, false
+	}
+	return &t, true
+}
+
+// parseTodoTxt reads a single todo.txt line
+func parseTodoTxt(line string) (importedDo, error) {
+	item := importedDo{Do: Do{Type: Task, Priority: Medium, CreatedAt: time.Now()}}
+
+	rest := strings.TrimSpace(line)
+
+	if strings.HasPrefix(rest, "x ") {
+		item.Do.Completed = true
+		rest = strings.TrimSpace(rest[2:])
+	}
+
+	if m := todoTxtPriority.FindStringSubmatch(rest); m != nil {
+		item.Do.Priority = mapTodoTxtPrio(m[1])
+		rest = rest[len(m[0]):]
+	}
+
+	// Completed tasks have a completion date followed by a creation date
+	fields := strings.Fields(rest)
+	if item.Do.Completed && len(fields) > 0 {
+		if date, ok := parseTodoTxtDate(fields[0]); ok {
+			item.Do.CompletedAt = date
+			fields = fields[1:]
+		}
+	}
+	if len(fields) > 0 {
+		if date, ok := parseTodoTxtDate(fields[0]); ok {
+			item.Do.CreatedAt = *date
+			fields = fields[1:]
+		}
+	}
+
+	var words []string
+	for _, field := range fields {
+		switch {
+		case len(field) > 1 && field[0] == '+' && isDoType(field[1:]):
+			item.Do.Type = mapType(field[1:])
+		case len(field) > 1 && field[0] == '@':
+			item.Categories = append(item.Categories, field[1:])
+		case strings.Contains(field, ":") && !strings.Contains(field, "://"):
+			key, value, _ := strings.Cut(field, ":")
+			switch key {
+			case "due":
+				date, ok := parseTodoTxtDate(value)
+				if !ok {
+					return item, fmt.Errorf("bad due date '%s'", value)
+				}
+				item.Do.DueAt = date
+			case "t":
+				date, ok := parseTodoTxtDate(value)
+				if !ok {
+					return item, fmt.Errorf("bad threshold date '%s'", value)
+				}
+				item.Do.ScheduledAt = date
+			case "pri":
+				item.Do.Priority = mapTodoTxtPrio(value)
+			case "uid":
+				item.Do.UID = value
+			default:
+				words = append(words, field)
+			}
+		default:
+			words = append(words, field)
+		}
+	}
+
+	item.Do.Description = strings.Join(words, " ")
+	if item.Do.Completed && item.Do.CompletedAt == nil {
+		now := time.Now()
+		item.Do.CompletedAt = &now
+	}
+	return item, nil
+}
+
+// importTodoTxt reads a todo.txt file. A +project naming a do type sets the
+// type, other projects are kept in the description, and @contexts are crew if
+// they're in the crew already.
+func importTodoTxt(r io.Reader) ([]importedDo, error) {
+	var items []importedDo
+
+	scanner := bufio.NewScanner(r)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		item, err := parseTodoTxt(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if item.Do.Description == "" {
+			continue
+		}
+		items = append(items, item)
+	}
+
+	return items, scanner.Err()
+}
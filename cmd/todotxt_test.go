@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTodoTxt(t *testing.T) {
+	tests := []struct {
+		name        string
+		line        string
+		description string
+		prio        DoPrio
+		doType      DoType
+		crew        []string
+		completed   bool
+		due         string
+	}{
+		{
+			name:        "plain",
+			line:        "Call the plumber",
+			description: "Call the plumber",
+			prio:        Medium,
+			doType:      Task,
+		},
+		{
+			name:        "priority, project and context",
+			line:        "(A) 2025-03-01 Review the release +pr @alice due:2025-03-14",
+			description: "Review the release",
+			prio:        High,
+			doType:      PR,
+			crew:        []string{"alice"},
+			due:         "2025-03-14",
+		},
+		{
+			name:        "other projects stay in the description",
+			line:        "(C) Paint the shed +garden",
+			description: "Paint the shed +garden",
+			prio:        Low,
+			doType:      Task,
+		},
+		{
+			name:        "completed",
+			line:        "x 2025-03-10 2025-03-01 Ship it +brag pri:A",
+			description: "Ship it",
+			prio:        High,
+			doType:      Brag,
+			completed:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item, err := parseTodoTxt(tt.line)
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			if item.Do.Description != tt.description {
+				t.Errorf("Expected description %q, got %q", tt.description, item.Do.Description)
+			}
+			if item.Do.Priority != tt.prio {
+				t.Errorf("Expected priority %s, got %s", tt.prio, item.Do.Priority)
+			}
+			if item.Do.Type != tt.doType {
+				t.Errorf("Expected type %s, got %s", tt.doType, item.Do.Type)
+			}
+			if strings.Join(item.Categories, ",") != strings.Join(tt.crew, ",") {
+				t.Errorf("Expected crew %v, got %v", tt.crew, item.Categories)
+			}
+			if item.Do.Completed != tt.completed {
+				t.Errorf("Expected completed %v, got %v", tt.completed, item.Do.Completed)
+			}
+			if tt.due != "" && (item.Do.DueAt == nil || item.Do.DueAt.Format("2006-01-02") != tt.due) {
+				t.Errorf("Expected due %s, got %v", tt.due, item.Do.DueAt)
+			}
+		})
+	}
+}
+
+func TestParseTodoTxtCompletionDate(t *testing.T) {
+	item, err := parseTodoTxt("x 2025-03-10 2025-03-01 Ship it")
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if item.Do.CompletedAt == nil || item.Do.CompletedAt.Format("2006-01-02") != "2025-03-10" {
+		t.Errorf("Expected completion on 2025-03-10, got %v", item.Do.CompletedAt)
+	}
+	if item.Do.CreatedAt.Format("2006-01-02") != "2025-03-01" {
+		t.Errorf("Expected creation on 2025-03-01, got %v", item.Do.CreatedAt)
+	}
+
+	if _, err := parseTodoTxt("Bad date due:tomorrow"); err == nil {
+		t.Error("Expected an error for a bad due date")
+	}
+}
+
+func TestTodoTxtRoundTrip(t *testing.T) {
+	created := time.Date(2025, 3, 1, 9, 0, 0, 0, time.Local)
+	due := time.Date(2025, 3, 14, 0, 0, 0, 0, time.Local)
+
+	dos := []Do{
+		{UID: "a@captain", Description: "Ask about leave", Type: Ask, Priority: High, CreatedAt: created, DueAt: &due, Tags: []Tag{{Name: "bob"}}},
+		{UID: "b@captain", Description: "Merged", Type: PR, Priority: Low, CreatedAt: created, Completed: true, CompletedAt: &due},
+	}
+
+	var buf bytes.Buffer
+	if err := exportTodoTxt(&buf, dos); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	items, err := importTodoTxt(&buf)
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(items))
+	}
+
+	for i, item := range items {
+		if item.Do.UID != dos[i].UID || item.Do.Description != dos[i].Description {
+			t.Errorf("Expected %s %q, got %s %q", dos[i].UID, dos[i].Description, item.Do.UID, item.Do.Description)
+		}
+		if item.Do.Type != dos[i].Type || item.Do.Priority != dos[i].Priority {
+			t.Errorf("Expected %s/%s, got %s/%s", dos[i].Type, dos[i].Priority, item.Do.Type, item.Do.Priority)
+		}
+	}
+	if len(items[0].Categories) != 1 || items[0].Categories[0] != "bob" {
+		t.Errorf("Expected crew [bob], got %v", items[0].Categories)
+	}
+	if !items[1].Do.Completed {
+		t.Error("Expected the second do to be completed")
+	}
+}
+
+func TestImportTodoTxtOnlyAssignsKnownContexts(t *testing.T) {
+	conn, cleanup := setupTestDB(t)
+	defer cleanup()
+	svc := testService(t, conn)
+	svc.Recruit("alice")
+
+	items, err := importTodoTxt(strings.NewReader("Call the plumber @phone @alice\n"))
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if _, _, err := applyImport(svc, items); err != nil {
+		t.Fatalf("Failed to apply: %v", err)
+	}
+
+	var do Do
+	conn.Preload("Tags").First(&do)
+	if len(do.Tags) != 1 || do.Tags[0].Name != "alice" {
+		t.Errorf("Expected the do to be for alice only, got %v", do.Tags)
+	}
+	var tags int64
+	conn.Model(&Tag{}).Count(&tags)
+	if tags != 1 {
+		t.Errorf("Expected @phone not to be recruited, got %d tags", tags)
+	}
+}
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"log"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -92,12 +91,12 @@ func (m confirmModel) View() string {
 	return b.String()
 }
 
-func Confirmation(do Do, title string, style lipgloss.Style) bool {
+func Confirmation(do Do, title string, style lipgloss.Style) (bool, error) {
 	m := newConfirmationModel(do, title, []string{"Yes", "No"}, style)
 	p := tea.NewProgram(m)
 	finalModel, err := p.Run()
 	if err != nil {
-		log.Fatalf("could not run program: %v", err)
+		return false, fmt.Errorf("could not run program: %w", err)
 	}
-	return finalModel.(confirmModel).confirmed
+	return finalModel.(confirmModel).confirmed, nil
 }
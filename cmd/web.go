@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"bytes"
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/yuin/goldmark"
+)
+
+//go:embed web
+var webFiles embed.FS
+
+// webHandler serves the single page UI that talks to the API
+func webHandler() http.Handler {
+	files, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		panic(err)
+	}
+	return http.FileServerFS(files)
+}
+
+// renderMarkdown renders a doc for the web UI. Raw HTML in the doc is left
+// out rather than passed through.
+func renderMarkdown(text string) (string, error) {
+	var out bytes.Buffer
+	if err := goldmark.Convert([]byte(text), &out); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
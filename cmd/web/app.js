@@ -0,0 +1,223 @@
+// The token comes in the URL fragment printed by `captain serve` and is kept
+// for the session, so it never reaches the server in a URL.
+const params = new URLSearchParams(location.hash.slice(1));
+if (params.get("token")) {
+  sessionStorage.setItem("token", params.get("token"));
+  history.replaceState(null, "", location.pathname);
+}
+
+const state = {
+  dos: [],
+  crew: [],
+  forName: "",
+  revealed: new Set(),
+};
+
+const $ = (id) => document.getElementById(id);
+
+async function api(method, path, body) {
+  const res = await fetch(path, {
+    method,
+    headers: {
+      "Authorization": "Bearer " + (sessionStorage.getItem("token") || ""),
+      "Content-Type": "application/json",
+    },
+    body: body === undefined ? undefined : JSON.stringify(body),
+  });
+
+  if (res.status === 401) {
+    $("token-form").hidden = false;
+    throw new Error("Enter the serve_token from your captain config");
+  }
+  if (res.status === 204) {
+    return null;
+  }
+  const data = await res.json();
+  if (!res.ok) {
+    throw new Error(data.error || res.statusText);
+  }
+  return data;
+}
+
+function showMessage(err) {
+  $("message").textContent = err ? err.message || String(err) : "";
+  $("message").hidden = !err;
+}
+
+const months = ["Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"];
+const pad = (n) => String(n).padStart(2, "0");
+
+// fmtDate matches the At column of `captain log`
+function fmtDate(value) {
+  const d = new Date(value);
+  return `${pad(d.getDate())}-${months[d.getMonth()]}-${pad(d.getFullYear() % 100)} ${pad(d.getHours())}:${pad(d.getMinutes())}`;
+}
+
+function cell(text, className) {
+  const td = document.createElement("td");
+  td.textContent = text;
+  if (className) {
+    td.className = className;
+  }
+  return td;
+}
+
+function isMasked(d) {
+  return d.sensitive && !$("unhide").checked && !state.revealed.has(d.id);
+}
+
+function renderLog() {
+  const tbody = document.querySelector("#log tbody");
+  tbody.replaceChildren();
+
+  for (const d of state.dos) {
+    const tr = document.createElement("tr");
+
+    const box = cell(d.completed ? "▣" : "☐", "box" + (d.completed ? " done" : ""));
+    box.title = d.completed ? "Done" : "Complete this do";
+    if (!d.completed) {
+      box.onclick = () => change(d, "POST", `/api/dos/${d.id}/complete`, {});
+    }
+
+    const masked = isMasked(d);
+    const description = cell(
+      masked ? "⠿".repeat(d.description.length) : d.description,
+      "text description" + (masked ? " masked" : ""),
+    );
+    description.title = masked ? "Click to reveal" : "Show the doc";
+    description.onclick = () => {
+      if (isMasked(d)) {
+        state.revealed.add(d.id);
+        renderLog();
+      } else {
+        showDoc(d);
+      }
+    };
+
+    const prio = document.createElement("td");
+    const select = document.createElement("select");
+    for (const p of ["low", "medium", "high"]) {
+      select.add(new Option(p, p, false, p === d.priority));
+    }
+    select.className = "prio-" + d.priority;
+    select.onchange = () => change(d, "PATCH", `/api/dos/${d.id}`, { priority: select.value });
+    prio.append(select);
+
+    let type = d.type;
+    if (d.git && d.git.state) {
+      type += " " + (d.git.state === "open" ? "+" + d.git.ahead : d.git.state);
+    }
+
+    tr.append(
+      box,
+      cell(String(d.id)),
+      description,
+      cell(fmtDate(d.completed && d.completed_at ? d.completed_at : d.created_at)),
+      cell(d.doc && d.doc.id ? "✻" : "", "text"),
+      cell(type, "type-" + d.type),
+      prio,
+      cell(d.tags && d.tags.length ? d.tags[0].name : "", "text"),
+    );
+    tbody.append(tr);
+  }
+}
+
+function renderCrew() {
+  const list = $("crew-list");
+  list.replaceChildren();
+
+  const everyone = [{ name: "", label: "everyone" }, ...state.crew.map((m) => ({ ...m, label: m.name }))];
+  for (const mate of everyone) {
+    const li = document.createElement("li");
+    li.className = mate.name === state.forName ? "active" : "";
+
+    const name = document.createElement("span");
+    name.textContent = mate.label;
+    li.append(name);
+
+    if (mate.name) {
+      const count = document.createElement("span");
+      count.className = "count";
+      count.textContent = mate.count;
+      li.append(count);
+    }
+
+    li.onclick = () => {
+      state.forName = mate.name;
+      renderCrew();
+      load();
+    };
+    list.append(li);
+  }
+}
+
+// change sends the do's updated_at along, so that a change made elsewhere
+// since it was loaded is refused rather than overwritten
+async function change(d, method, path, body) {
+  try {
+    await api(method, path, { ...body, updated_at: d.updated_at });
+    showMessage(null);
+  } catch (err) {
+    showMessage(err);
+  }
+  await load();
+}
+
+async function showDoc(d) {
+  try {
+    const doc = await api("GET", `/api/dos/${d.id}/doc`);
+    $("doc-title").textContent = d.description;
+    if (doc.html) {
+      $("doc-body").innerHTML = doc.html;
+    } else {
+      $("doc-body").textContent = "No documentation";
+    }
+    $("doc").hidden = false;
+  } catch (err) {
+    showMessage(err);
+  }
+}
+
+async function load() {
+  const query = new URLSearchParams();
+  if (!$("show-completed").checked) {
+    query.set("completed", "false");
+  }
+  if ($("type-filter").value) {
+    query.set("type", $("type-filter").value);
+  }
+  if (state.forName) {
+    query.set("for", state.forName);
+  }
+
+  try {
+    [state.dos, state.crew] = await Promise.all([
+      api("GET", "/api/dos?" + query),
+      api("GET", "/api/crew"),
+    ]);
+    $("token-form").hidden = true;
+  } catch (err) {
+    showMessage(err);
+    return;
+  }
+  renderLog();
+  renderCrew();
+}
+
+$("type-filter").onchange = load;
+$("show-completed").onchange = load;
+$("unhide").onchange = () => {
+  state.revealed.clear();
+  renderLog();
+};
+$("doc-close").onclick = () => {
+  $("doc").hidden = true;
+};
+$("token-form").onsubmit = (e) => {
+  e.preventDefault();
+  sessionStorage.setItem("token", $("token-input").value);
+  showMessage(null);
+  load();
+};
+
+load();
@@ -0,0 +1,216 @@
+package logbook
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Backup copies the database conn has open to path with VACUUM INTO, which is
+// safe while it's in use.
+func Backup(conn *gorm.DB, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return StorageError("create the backup directory", err)
+	}
+	if err := conn.Exec("VACUUM INTO ?", path).Error; err != nil {
+		return StorageError("back up the database", err)
+	}
+	return nil
+}
+
+// RoutineBackup is the reason given for the backups taken every
+// backup_interval. Only these are pruned or count towards the next being due,
+// the others are taken before a change and kept until removed by hand.
+const RoutineBackup = "daily"
+
+const (
+	backupStamp    = "20060102-150405.000000"
+	oldBackupStamp = "20060102-150405"
+)
+
+// BackupPath is where a backup of the database at path is kept, in a
+// backups directory next to it and named for when and why it was taken.
+func BackupPath(path, reason string, at time.Time) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	file := fmt.Sprintf("%s-%s-%s%s", name, at.Format(backupStamp), reason, filepath.Ext(path))
+	return filepath.Join(filepath.Dir(path), "backups", file)
+}
+
+// BackupFile is a backup of the database kept in its backups directory
+type BackupFile struct {
+	Path    string
+	TakenAt time.Time
+	Reason  string
+}
+
+// parseBackup reads when and why a backup was taken from the rest of its
+// name after the database's, e.g. 20240305-140709.000000-daily.db. Backups
+// from before the stamp had microseconds are read too.
+func parseBackup(stamp, ext string) (time.Time, string, bool) {
+	rest, ok := strings.CutSuffix(stamp, ext)
+	if !ok {
+		return time.Time{}, "", false
+	}
+	for _, layout := range []string{backupStamp, oldBackupStamp} {
+		if len(rest) <= len(layout) || rest[len(layout)] != '-' {
+			continue
+		}
+		if at, err := time.ParseInLocation(layout, rest[:len(layout)], time.Local); err == nil {
+			return at, rest[len(layout)+1:], true
+		}
+	}
+	return time.Time{}, "", false
+}
+
+// Backups are the backups of the database at path, newest first
+func Backups(path string) ([]BackupFile, error) {
+	dir := filepath.Join(filepath.Dir(path), "backups")
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, StorageError("list backups", err)
+	}
+
+	var backups []BackupFile
+	for _, entry := range entries {
+		stamp, ok := strings.CutPrefix(entry.Name(), name+"-")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		at, reason, ok := parseBackup(stamp, filepath.Ext(path))
+		if !ok {
+			continue
+		}
+		backups = append(backups, BackupFile{Path: filepath.Join(dir, entry.Name()), TakenAt: at, Reason: reason})
+	}
+	sort.SliceStable(backups, func(i, j int) bool { return backups[i].TakenAt.After(backups[j].TakenAt) })
+	return backups, nil
+}
+
+// routineBackups are the routine backups of the database at path, newest
+// first
+func routineBackups(path string) ([]BackupFile, error) {
+	backups, err := Backups(path)
+	if err != nil {
+		return nil, err
+	}
+	var routine []BackupFile
+	for _, backup := range backups {
+		if backup.Reason == RoutineBackup {
+			routine = append(routine, backup)
+		}
+	}
+	return routine, nil
+}
+
+// BackupDue says whether the newest routine backup of the database at path
+// is older than interval. An interval of a day means the first command of
+// each day backs up, however late the last one was taken. It never is when
+// interval is 0.
+func BackupDue(path string, interval time.Duration, now time.Time) (bool, error) {
+	if interval <= 0 {
+		return false, nil
+	}
+	backups, err := routineBackups(path)
+	if err != nil || len(backups) == 0 {
+		return err == nil, err
+	}
+
+	last := backups[0].TakenAt.In(now.Location())
+	if interval == 24*time.Hour {
+		return last.YearDay() != now.YearDay() || last.Year() != now.Year(), nil
+	}
+	return now.Sub(last) >= interval, nil
+}
+
+// Prune removes all but the newest keep routine backups of the database at
+// path, returning those removed. A keep of 0 keeps them all.
+func Prune(path string, keep int) ([]BackupFile, error) {
+	backups, err := routineBackups(path)
+	if err != nil || keep <= 0 || len(backups) <= keep {
+		return nil, err
+	}
+	for _, backup := range backups[keep:] {
+		if err := os.Remove(backup.Path); err != nil {
+			return nil, StorageError("remove an old backup", err)
+		}
+	}
+	return backups[keep:], nil
+}
+
+// Check makes sure the database at path is a logbook that passes SQLite's
+// integrity check.
+func Check(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return Errorf(ErrNotFound, "no database at %s", path)
+	}
+	// Read only, so checking a backup doesn't change it
+	conn, err := connect(fmt.Sprintf("file:%s?mode=ro", path))
+	if err != nil {
+		return Errorf(ErrInvalid, "%s is not a database: %v", path, err)
+	}
+	if db, err := conn.DB(); err == nil {
+		defer db.Close()
+	}
+
+	var result string
+	if err := conn.Raw("PRAGMA integrity_check").Scan(&result).Error; err != nil {
+		return Errorf(ErrInvalid, "%s is not a database: %v", path, err)
+	}
+	if result != "ok" {
+		return Errorf(ErrInvalid, "%s failed the integrity check: %s", path, result)
+	}
+	if !conn.Migrator().HasTable(&Do{}) {
+		return Errorf(ErrInvalid, "%s is not a logbook", path)
+	}
+	return nil
+}
+
+// Restore replaces the database at path with a copy of the backup at from,
+// once it has passed Check. Nothing should have the database open.
+func Restore(path, from string) error {
+	if err := Check(from); err != nil {
+		return err
+	}
+
+	src, err := os.Open(from)
+	if err != nil {
+		return StorageError("open the backup", err)
+	}
+	defer src.Close()
+
+	// Copy next to the database first, so it's replaced whole or not at all
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".restore-*")
+	if err != nil {
+		return StorageError("restore the database", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return StorageError("restore the database", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return StorageError("restore the database", err)
+	}
+
+	// A journal left from the old database would be replayed over the new one
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		if err := os.Remove(path + suffix); err != nil && !os.IsNotExist(err) {
+			return StorageError("restore the database", err)
+		}
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return StorageError("restore the database", err)
+	}
+	return nil
+}
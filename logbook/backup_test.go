@@ -0,0 +1,142 @@
+package logbook
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackupPath(t *testing.T) {
+	at := time.Date(2024, 3, 5, 14, 7, 9, 250000000, time.UTC)
+	got := BackupPath("/home/me/.captain/captain.db", "pre-migrate-v2", at)
+	want := "/home/me/.captain/backups/captain-20240305-140709.250000-pre-migrate-v2.db"
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	// Backups in the same second don't overwrite each other
+	if BackupPath("captain.db", "daily", at) == BackupPath("captain.db", "daily", at.Add(time.Millisecond)) {
+		t.Error("Expected backups a millisecond apart to have their own paths")
+	}
+}
+
+func TestBackupsReadsOldNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "captain.db")
+	dir := filepath.Join(filepath.Dir(path), "backups")
+	os.MkdirAll(dir, 0o755)
+	os.WriteFile(filepath.Join(dir, "captain-20240305-090000-daily.db"), nil, 0o644)
+
+	backups, err := Backups(path)
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("Expected the backup, got %v, %v", backups, err)
+	}
+	want := time.Date(2024, 3, 5, 9, 0, 0, 0, time.Local)
+	if !backups[0].TakenAt.Equal(want) || backups[0].Reason != "daily" {
+		t.Errorf("Unexpected backup %+v", backups[0])
+	}
+}
+
+func TestPruneKeepsNewest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "captain.db")
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.Local)
+	for day := range 5 {
+		backup := BackupPath(path, "daily", start.AddDate(0, 0, day))
+		os.MkdirAll(filepath.Dir(backup), 0o755)
+		os.WriteFile(backup, nil, 0o644)
+	}
+	// Taken before a change, these are neither pruned nor routine
+	for _, reason := range []string{"pre-migrate-v3", "pre-restore", "pre-doctor", "manual"} {
+		os.WriteFile(BackupPath(path, reason, start.AddDate(0, 0, 4).Add(30*time.Minute)), nil, 0o644)
+	}
+	// Not backups of this database
+	os.WriteFile(filepath.Join(filepath.Dir(path), "backups", "other-20240301-090000-daily.db"), nil, 0o644)
+	os.WriteFile(filepath.Join(filepath.Dir(path), "backups", "captain-notes.txt"), nil, 0o644)
+
+	due, err := BackupDue(path, 24*time.Hour, start.AddDate(0, 0, 4).Add(time.Hour))
+	if err != nil || due {
+		t.Errorf("Expected no backup due an hour after the last, got %v, %v", due, err)
+	}
+	if due, _ := BackupDue(path, 24*time.Hour, start.AddDate(0, 0, 5)); !due {
+		t.Errorf("Expected a backup due a day after the last routine one")
+	}
+	if due, _ := BackupDue(path, 24*time.Hour, start.AddDate(0, 0, 5).Add(-8*time.Hour)); !due {
+		t.Errorf("Expected a backup due the next morning, before a full day has gone by")
+	}
+	if due, _ := BackupDue(path, 48*time.Hour, start.AddDate(0, 0, 5)); due {
+		t.Errorf("Expected other intervals to need that long since the last backup")
+	}
+	if due, _ := BackupDue(path, 0, start.AddDate(1, 0, 0)); due {
+		t.Errorf("Expected no backups when the interval is 0")
+	}
+
+	pruned, err := Prune(path, 2)
+	if err != nil || len(pruned) != 3 {
+		t.Fatalf("Expected 3 backups pruned, got %v, %v", pruned, err)
+	}
+	backups, _ := Backups(path)
+	if len(backups) != 6 {
+		t.Errorf("Expected the newest 2 routine backups and the rest kept, got %v", backups)
+	}
+	routine, _ := routineBackups(path)
+	if len(routine) != 2 || !routine[0].TakenAt.Equal(start.AddDate(0, 0, 4)) {
+		t.Errorf("Expected the newest 2 routine backups kept, got %v", routine)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(path), "backups", "other-20240301-090000-daily.db")); err != nil {
+		t.Errorf("Expected another database's backup to be left alone, got %v", err)
+	}
+}
+
+func TestCheckAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "captain.db")
+	conn, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	conn.Create(&Do{Description: "Before"})
+
+	backup := filepath.Join(dir, "backup.db")
+	if err := Backup(conn, backup); err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	conn.Create(&Do{Description: "After"})
+	if db, err := conn.DB(); err == nil {
+		db.Close()
+	}
+
+	garbage := filepath.Join(dir, "garbage.db")
+	os.WriteFile(garbage, []byte("not a database at all, not even close"), 0o644)
+	other := filepath.Join(dir, "other.db")
+	if conn, err := Connect(other); err == nil {
+		conn.Exec("CREATE TABLE notes (id integer)")
+	}
+
+	for file, want := range map[string]error{
+		backup:                        nil,
+		garbage:                       ErrInvalid,
+		other:                         ErrInvalid,
+		filepath.Join(dir, "gone.db"): ErrNotFound,
+	} {
+		if err := Check(file); !errors.Is(err, want) {
+			t.Errorf("Check(%s): expected %v, got %v", filepath.Base(file), want, err)
+		}
+	}
+	if err := Restore(path, garbage); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected a bad backup to be refused, got %v", err)
+	}
+
+	if err := Restore(path, backup); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	conn, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	var descriptions []string
+	conn.Model(&Do{}).Pluck("description", &descriptions)
+	if len(descriptions) != 1 || descriptions[0] != "Before" {
+		t.Errorf("Expected the logbook as it was backed up, got %v", descriptions)
+	}
+}
@@ -0,0 +1,192 @@
+package logbook
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Checkup is one of the checks the doctor runs over the logbook
+type Checkup struct {
+	Name string
+	// Find describes each problem the check finds
+	Find func(conn *gorm.DB) ([]string, error)
+	// Fix repairs what Find finds, it's nil when that can't be done
+	Fix func(tx *gorm.DB) error
+	// Warning checkups find what can't be checked rather than problems,
+	// they're reported but don't count against the logbook
+	Warning bool
+}
+
+// Finding is what a checkup found, no problems when all is well
+type Finding struct {
+	Checkup
+	Problems []string
+}
+
+// Checkups are the checks the doctor runs, in order. Later fixes rely on
+// earlier ones, e.g. duplicate docs are only looked for once the docs of
+// missing dos are gone.
+var Checkups = []Checkup{
+	{
+		Name: "integrity",
+		Find: func(conn *gorm.DB) ([]string, error) {
+			var results []string
+			if err := conn.Raw("PRAGMA integrity_check").Scan(&results).Error; err != nil {
+				return nil, StorageError("check integrity", err)
+			}
+			if len(results) == 1 && results[0] == "ok" {
+				return nil, nil
+			}
+			return results, nil
+		},
+	},
+	{
+		Name: "crew assignments of missing dos or tags",
+		Find: func(conn *gorm.DB) ([]string, error) {
+			var rows []DoTag
+			if err := conn.Where(orphanedDoTags).Find(&rows).Error; err != nil {
+				return nil, StorageError("fetch do_tags", err)
+			}
+			var problems []string
+			for _, row := range rows {
+				problems = append(problems, fmt.Sprintf("do %d is tagged with tag %d", row.DoID, row.TagID))
+			}
+			return problems, nil
+		},
+		Fix: func(tx *gorm.DB) error {
+			return tx.Where(orphanedDoTags).Delete(&DoTag{}).Error
+		},
+	},
+	{
+		Name: "docs of missing dos",
+		Find: func(conn *gorm.DB) ([]string, error) {
+			var docs []DoDoc
+			if err := conn.Where(orphanedDocs).Find(&docs).Error; err != nil {
+				return nil, StorageError("fetch docs", err)
+			}
+			var problems []string
+			for _, doc := range docs {
+				problems = append(problems, fmt.Sprintf("doc %d belongs to do %d", doc.ID, doc.DoID))
+			}
+			return problems, nil
+		},
+		Fix: func(tx *gorm.DB) error {
+			return tx.Where(orphanedDocs).Delete(&DoDoc{}).Error
+		},
+	},
+	{
+		// The first doc of a do is the one that's edited, the rest are dropped
+		Name: "dos with more than one doc",
+		Find: func(conn *gorm.DB) ([]string, error) {
+			var docs []DoDoc
+			if err := conn.Where(duplicateDocs).Find(&docs).Error; err != nil {
+				return nil, StorageError("fetch docs", err)
+			}
+			var problems []string
+			for _, doc := range docs {
+				problems = append(problems, fmt.Sprintf("doc %d is another doc of do %d", doc.ID, doc.DoID))
+			}
+			return problems, nil
+		},
+		Fix: func(tx *gorm.DB) error {
+			return tx.Where(duplicateDocs).Delete(&DoDoc{}).Error
+		},
+	},
+	{
+		Name: "tags without a name",
+		Find: func(conn *gorm.DB) ([]string, error) {
+			var tags []Tag
+			if err := conn.Where(unnamedTags).Find(&tags).Error; err != nil {
+				return nil, StorageError("fetch tags", err)
+			}
+			var problems []string
+			for _, tag := range tags {
+				problems = append(problems, fmt.Sprintf("tag %d has no name", tag.ID))
+			}
+			return problems, nil
+		},
+		Fix: func(tx *gorm.DB) error {
+			if err := tx.Where("tag_id IN (SELECT id FROM tags WHERE " + unnamedTags + ")").Delete(&DoTag{}).Error; err != nil {
+				return err
+			}
+			return tx.Where(unnamedTags).Delete(&Tag{}).Error
+		},
+	},
+	{
+		Name: "promoted dos without their file",
+		Find: func(conn *gorm.DB) ([]string, error) {
+			var dos []Do
+			if err := conn.Where(lostPromotions).Find(&dos).Error; err != nil {
+				return nil, StorageError("fetch dos", err)
+			}
+			var problems []string
+			for _, do := range dos {
+				problems = append(problems, fmt.Sprintf("do %d was promoted to %s", do.ID, do.File))
+			}
+			return problems, nil
+		},
+		// Back on the log, it can be promoted again
+		Fix: func(tx *gorm.DB) error {
+			return tx.Model(&Do{}).Where(lostPromotions).Updates(map[string]any{"promoted": false, "file": ""}).Error
+		},
+	},
+	{
+		Name:    "promoted dos that can't be checked",
+		Warning: true,
+		Find: func(conn *gorm.DB) ([]string, error) {
+			var dos []Do
+			if err := conn.Where(unrecordedPromotions).Find(&dos).Error; err != nil {
+				return nil, StorageError("fetch dos", err)
+			}
+			var problems []string
+			for _, do := range dos {
+				problems = append(problems, fmt.Sprintf("do %d was promoted before its file was recorded", do.ID))
+			}
+			return problems, nil
+		},
+	},
+}
+
+const (
+	orphanedDoTags = "do_id NOT IN (SELECT id FROM dos) OR tag_id NOT IN (SELECT id FROM tags)"
+	orphanedDocs   = "do_id NOT IN (SELECT id FROM dos)"
+	duplicateDocs  = "id NOT IN (SELECT MIN(id) FROM do_docs GROUP BY do_id)"
+	unnamedTags    = "name IS NULL OR TRIM(name) = ''"
+	lostPromotions = "promoted AND file <> '' AND file NOT IN (SELECT name FROM file_records WHERE NOT deleted AND NOT is_dir)"
+	// Promoted before version 3 of the schema, the file isn't known
+	unrecordedPromotions = "promoted AND (file IS NULL OR file = '')"
+)
+
+// Examine runs the checkups over the logbook conn has open
+func Examine(conn *gorm.DB, checkups []Checkup) ([]Finding, error) {
+	findings := make([]Finding, len(checkups))
+	for i, checkup := range checkups {
+		problems, err := checkup.Find(conn)
+		if err != nil {
+			return nil, err
+		}
+		findings[i] = Finding{Checkup: checkup, Problems: problems}
+	}
+	return findings, nil
+}
+
+// Repair fixes the problems in findings that can be fixed, all or none of
+// them.
+func Repair(conn *gorm.DB, findings []Finding) error {
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		for _, finding := range findings {
+			if len(finding.Problems) == 0 || finding.Fix == nil {
+				continue
+			}
+			if err := finding.Fix(tx); err != nil {
+				return fmt.Errorf("%s: %w", finding.Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return StorageError("repair the logbook", err)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package logbook
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// healthyLogbook has one of everything the checkups look at, all in order
+func healthyLogbook(t *testing.T) (*gorm.DB, string) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	conn, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	do := Do{Description: "Healthy", Type: Task, Tags: []Tag{{Name: "dave"}}}
+	conn.Create(&do)
+	conn.Create(&DoDoc{DoID: do.ID, Text: "# Fine"})
+	conn.Create(&Do{Description: "Promoted", Type: Task, Promoted: true, File: "plan.do"})
+	conn.Create(&Do{Description: "Promoted before files were recorded", Type: Task, Promoted: true})
+	conn.Create(&FileRecord{ID: "f1", Name: "plan.do"})
+	return conn, path
+}
+
+// problems counts what each checkup finds, leaving out warnings
+func problems(t *testing.T, conn *gorm.DB) map[string]int {
+	t.Helper()
+	findings, err := Examine(conn, Checkups)
+	if err != nil {
+		t.Fatalf("Examine: %v", err)
+	}
+	found := map[string]int{}
+	for _, finding := range findings {
+		if len(finding.Problems) > 0 && !finding.Warning {
+			found[finding.Name] = len(finding.Problems)
+		}
+	}
+	return found
+}
+
+func TestCheckupsFindAndFix(t *testing.T) {
+	fixtures := []struct {
+		checkup string
+		found   int
+		fixed   bool
+		// breaks the logbook, returning the connection to examine it with
+		breaks func(t *testing.T, conn *gorm.DB, path string) *gorm.DB
+	}{
+		{
+			checkup: "integrity",
+			found:   2,
+			breaks: func(t *testing.T, conn *gorm.DB, path string) *gorm.DB {
+				// An index whose definition no longer matches its entries
+				conn.Exec("CREATE TABLE scratch (a integer, b integer)")
+				conn.Exec("CREATE INDEX scratch_a ON scratch(a)")
+				conn.Exec("INSERT INTO scratch VALUES (1, 2), (3, 4)")
+				conn.Exec("PRAGMA writable_schema = ON")
+				conn.Exec("UPDATE sqlite_master SET sql = 'CREATE INDEX scratch_a ON scratch(b)' WHERE name = 'scratch_a'")
+				if db, err := conn.DB(); err == nil {
+					db.Close()
+				}
+				conn, err := Connect(path)
+				if err != nil {
+					t.Fatalf("Connect: %v", err)
+				}
+				return conn
+			},
+		},
+		{
+			checkup: "crew assignments of missing dos or tags",
+			found:   2,
+			fixed:   true,
+			breaks: func(t *testing.T, conn *gorm.DB, path string) *gorm.DB {
+				conn.Create(&DoTag{DoID: 1, TagID: 99})
+				conn.Create(&DoTag{DoID: 99, TagID: 1})
+				return conn
+			},
+		},
+		{
+			checkup: "docs of missing dos",
+			found:   1,
+			fixed:   true,
+			breaks: func(t *testing.T, conn *gorm.DB, path string) *gorm.DB {
+				conn.Create(&DoDoc{DoID: 99, Text: "Left behind"})
+				return conn
+			},
+		},
+		{
+			checkup: "dos with more than one doc",
+			found:   2,
+			fixed:   true,
+			breaks: func(t *testing.T, conn *gorm.DB, path string) *gorm.DB {
+				conn.Create(&DoDoc{DoID: 1, Text: "# Again"})
+				conn.Create(&DoDoc{DoID: 1, Text: "# And again"})
+				return conn
+			},
+		},
+		{
+			checkup: "tags without a name",
+			found:   2,
+			fixed:   true,
+			breaks: func(t *testing.T, conn *gorm.DB, path string) *gorm.DB {
+				blank := Tag{Name: "  "}
+				conn.Create(&blank)
+				conn.Exec("INSERT INTO tags (name) VALUES (NULL)")
+				conn.Create(&DoTag{DoID: 1, TagID: blank.ID})
+				return conn
+			},
+		},
+		{
+			checkup: "promoted dos without their file",
+			found:   3,
+			fixed:   true,
+			breaks: func(t *testing.T, conn *gorm.DB, path string) *gorm.DB {
+				conn.Create(&Do{Description: "Lost", Type: Task, Promoted: true, File: "lost.do"})
+				conn.Create(&FileRecord{ID: "f2", Name: "gone.do", Deleted: true})
+				conn.Create(&Do{Description: "Deleted file", Type: Task, Promoted: true, File: "gone.do"})
+				conn.Create(&FileRecord{ID: "d1", Name: "dir.do", IsDir: true})
+				conn.Create(&Do{Description: "A directory", Type: Task, Promoted: true, File: "dir.do"})
+				return conn
+			},
+		},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.checkup, func(t *testing.T) {
+			conn, path := healthyLogbook(t)
+			if found := problems(t, conn); len(found) != 0 {
+				t.Fatalf("Expected a healthy logbook to have no problems, got %v", found)
+			}
+
+			conn = fixture.breaks(t, conn, path)
+			found := problems(t, conn)
+			if len(found) != 1 || found[fixture.checkup] != fixture.found {
+				t.Fatalf("Expected %d problems with %s only, got %v", fixture.found, fixture.checkup, found)
+			}
+
+			findings, _ := Examine(conn, Checkups)
+			if err := Repair(conn, findings); err != nil {
+				t.Fatalf("Repair: %v", err)
+			}
+			found = problems(t, conn)
+			if fixture.fixed && len(found) != 0 {
+				t.Errorf("Expected the problems fixed, got %v", found)
+			}
+			if !fixture.fixed && found[fixture.checkup] != fixture.found {
+				t.Errorf("Expected the problems left as they were, got %v", found)
+			}
+
+			// What was healthy is left alone
+			var do Do
+			conn.Preload("Doc").Preload("Tags").First(&do, 1)
+			if do.Doc.Text != "# Fine" || len(do.Tags) != 1 {
+				t.Errorf("Expected the healthy do untouched, got %+v", do)
+			}
+			var promoted int64
+			conn.Model(&Do{}).Where("promoted").Count(&promoted)
+			if promoted != 2 {
+				t.Errorf("Expected the 2 healthy promoted dos, got %d", promoted)
+			}
+		})
+	}
+}
+
+func TestUncheckablePromotionsAreWarnings(t *testing.T) {
+	conn, _ := healthyLogbook(t)
+	findings, err := Examine(conn, Checkups)
+	if err != nil {
+		t.Fatalf("Examine: %v", err)
+	}
+	for _, finding := range findings {
+		if finding.Name != "promoted dos that can't be checked" {
+			continue
+		}
+		if !finding.Warning || len(finding.Problems) != 1 || finding.Problems[0] != "do 3 was promoted before its file was recorded" {
+			t.Errorf("Expected the do promoted before files were recorded as a warning, got %+v", finding)
+		}
+		return
+	}
+	t.Errorf("Expected promotions that can't be checked to be reported")
+}
@@ -0,0 +1,146 @@
+// Package logbook is captain's logbook of dos, usable without the command
+// line. Open the database with Open and make changes through a Service over
+// a Store:
+//
+//	conn, err := logbook.Open(filepath.Join(dir, "captain.db"))
+//	if err != nil {
+//		return err
+//	}
+//	svc := logbook.New(logbook.NewSQLStore(conn, dir))
+//	do, err := svc.AddDo(logbook.NewDo{Do: logbook.Do{Description: "Ship it"}})
+//
+// Errors returned by the Service are of the kinds ErrNotFound, ErrExists,
+// ErrInvalid, ErrCancelled and ErrStorage, which can be matched with
+// errors.Is. Tests can use a MemStore in place of the database.
+package logbook
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Kinds of error returned by the Service. ErrStorage is a failure of the
+// Store.
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrExists    = errors.New("already exists")
+	ErrInvalid   = errors.New("invalid argument")
+	ErrCancelled = errors.New("cancelled")
+	ErrStorage   = errors.New("storage failure")
+)
+
+// Error is an error of one of the kinds above, along with the error that
+// caused it if there is one.
+type Error struct {
+	Kind error
+	Msg  string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+// Errorf makes an Error of a kind
+func Errorf(kind error, format string, args ...any) error {
+	return &Error{Kind: kind, Msg: fmt.Sprintf(format, args...)}
+}
+
+// StorageError is an ErrStorage for something the store could not do
+func StorageError(action string, err error) error {
+	return &Error{Kind: ErrStorage, Msg: fmt.Sprintf("could not %s: %v", action, err), Err: err}
+}
+
+// Event is a change to a do that the Before func of a Service is told about
+type Event string
+
+const (
+	OnCreate   Event = "create"
+	OnComplete Event = "complete"
+	OnScratch  Event = "scratch"
+	OnReassign Event = "reassign"
+	OnDoc      Event = "doc"
+	OnPromote  Event = "promote"
+)
+
+// Models are the tables of the logbook
+var Models = []any{
+	&Do{}, &Tag{}, &DoTag{}, &DoDoc{}, &Template{}, &Harvest{}, &GitLink{},
+	&FileRecord{}, &DirectoryState{}, &UserPreference{},
+}
+
+// Open opens the logbook database at path, creating it or running any
+// migrations it's missing. A database with migrations to run is backed up
+// first, see Migrate.
+func Open(path string) (*gorm.DB, error) {
+	conn, err := Connect(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, err := Migrate(conn, path, Migrations, Latest(Migrations)); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// BusyTimeout is how long a connection waits for another to let go of the
+// database before giving up with SQLITE_BUSY
+const BusyTimeout = 5 * time.Second
+
+// Connect opens the logbook database at path as it is, without migrating it.
+// The database is put in WAL mode so commands can read while another writes,
+// and transactions take the write lock as they begin so that they queue up
+// behind each other rather than fail part way through. The directory it's
+// in is made if it isn't there yet.
+func Connect(path string) (*gorm.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, StorageError("create the logbook directory", err)
+	}
+	return connect(fmt.Sprintf("%s?_journal_mode=WAL&_busy_timeout=%d&_txlock=immediate", path, BusyTimeout.Milliseconds()))
+}
+
+func connect(dsn string) (*gorm.DB, error) {
+	conn, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, StorageError("open database", err)
+	}
+	return conn, nil
+}
+
+// retry runs fn until it succeeds or fails for a reason other than the
+// database being busy, waiting longer after each try.
+func retry(fn func() error) error {
+	wait := 50 * time.Millisecond
+	for try := 1; ; try++ {
+		err := fn()
+		if try == 5 || !isBusy(err) {
+			return err
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// isBusy says whether err is SQLite refusing a lock another connection holds
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
@@ -0,0 +1,55 @@
+package logbook
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestConnectWaitsInWALMode(t *testing.T) {
+	conn, err := Connect(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	var mode string
+	var timeout int64
+	conn.Raw("PRAGMA journal_mode").Scan(&mode)
+	conn.Raw("PRAGMA busy_timeout").Scan(&timeout)
+	if mode != "wal" || timeout != BusyTimeout.Milliseconds() {
+		t.Errorf("Expected WAL with a %v busy timeout, got %s and %dms", BusyTimeout, mode, timeout)
+	}
+}
+
+func TestRetryWhileBusy(t *testing.T) {
+	tries := 0
+	err := retry(func() error {
+		tries++
+		if tries < 3 {
+			return StorageError("save do", sqlite3.Error{Code: sqlite3.ErrBusy})
+		}
+		return nil
+	})
+	if err != nil || tries != 3 {
+		t.Errorf("Expected success on the third try, got %v after %d", err, tries)
+	}
+
+	tries = 0
+	err = retry(func() error {
+		tries++
+		return sqlite3.Error{Code: sqlite3.ErrLocked}
+	})
+	if !isBusy(err) || tries != 5 {
+		t.Errorf("Expected to give up after 5 tries, got %v after %d", err, tries)
+	}
+
+	tries = 0
+	err = retry(func() error {
+		tries++
+		return Errorf(ErrExists, "do already exists: 1")
+	})
+	if !errors.Is(err, ErrExists) || tries != 1 {
+		t.Errorf("Expected other errors returned at once, got %v after %d", err, tries)
+	}
+}
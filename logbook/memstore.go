@@ -0,0 +1,417 @@
+package logbook
+
+import (
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemStore keeps the logbook in memory, for tests of code using a Service
+type MemStore struct {
+	mu    sync.Mutex
+	state memState
+}
+
+// memState is everything in a MemStore, copied to undo a transaction
+type memState struct {
+	dos       map[uint]Do // without their doc and crew
+	docs      map[uint]DoDoc
+	tags      map[uint]Tag
+	crew      map[uint][]uint // do id to tag ids
+	templates map[uint]Template
+	prefs     map[string]string
+	files     map[string]string
+	lastID    uint
+}
+
+// NewMemStore creates an empty MemStore
+func NewMemStore() *MemStore {
+	return &MemStore{state: memState{
+		dos:       map[uint]Do{},
+		docs:      map[uint]DoDoc{},
+		tags:      map[uint]Tag{},
+		crew:      map[uint][]uint{},
+		templates: map[uint]Template{},
+		prefs:     map[string]string{},
+		files:     map[string]string{},
+	}}
+}
+
+func (st memState) clone() memState {
+	crew := make(map[uint][]uint, len(st.crew))
+	for id, tags := range st.crew {
+		crew[id] = slices.Clone(tags)
+	}
+	return memState{
+		dos:       maps.Clone(st.dos),
+		docs:      maps.Clone(st.docs),
+		tags:      maps.Clone(st.tags),
+		crew:      crew,
+		templates: maps.Clone(st.templates),
+		prefs:     maps.Clone(st.prefs),
+		files:     maps.Clone(st.files),
+		lastID:    st.lastID,
+	}
+}
+
+// nextID hands out ids, unique across everything in the store
+func (m *MemStore) nextID() uint {
+	m.state.lastID++
+	return m.state.lastID
+}
+
+// do puts a do back together with its doc and crew
+func (m *MemStore) do(do Do) Do {
+	do.Doc = m.state.docs[do.ID]
+	do.Tags = []Tag{}
+	for _, tagID := range m.state.crew[do.ID] {
+		do.Tags = append(do.Tags, m.state.tags[tagID])
+	}
+	return do
+}
+
+func (m *MemStore) Do(id uint) (Do, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	do, ok := m.state.dos[id]
+	if !ok {
+		return Do{}, ErrNotFound
+	}
+	return m.do(do), nil
+}
+
+func (m *MemStore) DoByDescription(description string) (Do, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range slices.Sorted(maps.Keys(m.state.dos)) {
+		if strings.EqualFold(m.state.dos[id].Description, description) {
+			return m.do(m.state.dos[id]), nil
+		}
+	}
+	return Do{}, ErrNotFound
+}
+
+func (m *MemStore) matches(do Do, q Query) bool {
+	switch {
+	case do.Deleted && !q.Deleted,
+		do.Promoted && !q.Promoted,
+		q.Completed != nil && do.Completed != *q.Completed,
+		q.Pinned && !do.Pinned,
+		q.Type != "" && do.Type != q.Type,
+		q.Search != "" && !strings.Contains(strings.ToLower(do.Description), strings.ToLower(q.Search)),
+		q.UID != "" && do.UID != q.UID,
+		q.CompletedSince != nil && do.CompletedAt != nil && do.CompletedAt.Before(*q.CompletedSince):
+		return false
+	}
+	if q.For != "" {
+		return slices.ContainsFunc(do.Tags, func(tag Tag) bool { return tag.Name == q.For })
+	}
+	return true
+}
+
+// less orders dos as OrderBy does in SQL
+func less(a, b Do, sortBy string, asc bool) bool {
+	var cmp int
+	switch sortBy {
+	case SortCreated:
+		cmp = a.CreatedAt.Compare(b.CreatedAt)
+	case SortCompleted:
+		cmp = compareTimes(a.CompletedAt, b.CompletedAt)
+	case SortDescription:
+		cmp = strings.Compare(a.Description, b.Description)
+	case SortType:
+		cmp = strings.Compare(string(a.Type), string(b.Type))
+	case SortPriority:
+		cmp = PriorityRank(a.Priority) - PriorityRank(b.Priority)
+	default:
+		if a.Completed != b.Completed {
+			return !a.Completed
+		}
+		if c := compareTimes(a.CompletedAt, b.CompletedAt); c != 0 {
+			return c > 0
+		}
+		if a.Priority != b.Priority {
+			return PriorityRank(a.Priority) < PriorityRank(b.Priority)
+		}
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	if asc {
+		return cmp < 0
+	}
+	return cmp > 0
+}
+
+// compareTimes orders missing times first, as SQLite orders NULL
+func compareTimes(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	return a.Compare(*b)
+}
+
+func (m *MemStore) Dos(q Query) ([]Do, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dos := []Do{}
+	for _, id := range slices.Sorted(maps.Keys(m.state.dos)) {
+		if do := m.do(m.state.dos[id]); m.matches(do, q) {
+			dos = append(dos, do)
+		}
+	}
+	sort.SliceStable(dos, func(i, j int) bool {
+		return less(dos[i], dos[j], q.Sort, q.Asc)
+	})
+	if q.Limit > 0 && len(dos) > q.Limit {
+		dos = dos[:q.Limit]
+	}
+	return dos, nil
+}
+
+// bare is a do without what hangs off it, as it's kept in the store
+func bare(do Do) Do {
+	do.Doc = DoDoc{}
+	do.Tags = nil
+	return do
+}
+
+func (m *MemStore) CreateDo(do *Do) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	do.ID = m.nextID()
+	if do.CreatedAt.IsZero() {
+		do.CreatedAt = now
+	}
+	do.UpdatedAt = now
+	m.state.dos[do.ID] = bare(*do)
+	return nil
+}
+
+func (m *MemStore) SaveDo(do *Do) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if do.ID == 0 {
+		do.ID = m.nextID()
+	}
+	do.UpdatedAt = time.Now()
+	m.state.dos[do.ID] = bare(*do)
+	return nil
+}
+
+func (m *MemStore) SetDoc(doID uint, text string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if strings.TrimSpace(text) == "" {
+		delete(m.state.docs, doID)
+		return nil
+	}
+	doc, ok := m.state.docs[doID]
+	if !ok {
+		doc = DoDoc{ID: m.nextID(), DoID: doID}
+	}
+	doc.Text = text
+	m.state.docs[doID] = doc
+	return nil
+}
+
+func (m *MemStore) tag(name string) (Tag, bool) {
+	for _, id := range slices.Sorted(maps.Keys(m.state.tags)) {
+		if m.state.tags[id].Name == name {
+			return m.state.tags[id], true
+		}
+	}
+	return Tag{}, false
+}
+
+func (m *MemStore) Tag(name string) (Tag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if tag, ok := m.tag(name); ok {
+		return tag, nil
+	}
+	return Tag{}, ErrNotFound
+}
+
+func (m *MemStore) CreateTag(tag *Tag) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.tag(tag.Name); ok {
+		return ErrExists
+	}
+	tag.ID = m.nextID()
+	m.state.tags[tag.ID] = *tag
+	return nil
+}
+
+func (m *MemStore) SaveTag(tag *Tag) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if tag.ID == 0 {
+		tag.ID = m.nextID()
+	}
+	m.state.tags[tag.ID] = *tag
+	return nil
+}
+
+func (m *MemStore) SetCrew(doID uint, names ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tagIDs []uint
+	for _, name := range names {
+		tag, ok := m.tag(name)
+		if !ok {
+			tag = Tag{ID: m.nextID(), Name: name}
+			m.state.tags[tag.ID] = tag
+		}
+		tagIDs = append(tagIDs, tag.ID)
+	}
+	m.state.crew[doID] = tagIDs
+	return nil
+}
+
+func (m *MemStore) Crew() ([]Mate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := map[uint]int64{}
+	for _, tagIDs := range m.state.crew {
+		for _, id := range tagIDs {
+			counts[id]++
+		}
+	}
+
+	crew := []Mate{}
+	for _, id := range slices.Sorted(maps.Keys(m.state.tags)) {
+		crew = append(crew, Mate{Name: m.state.tags[id].Name, Count: counts[id]})
+	}
+	sort.SliceStable(crew, func(i, j int) bool { return crew[i].Count > crew[j].Count })
+	return crew, nil
+}
+
+func (m *MemStore) Template(name string) (Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, template := range m.state.templates {
+		if template.Name == name && !template.Deleted {
+			return template, nil
+		}
+	}
+	return Template{}, ErrNotFound
+}
+
+func (m *MemStore) Templates() ([]Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	templates := []Template{}
+	for _, template := range m.state.templates {
+		if !template.Deleted {
+			templates = append(templates, template)
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+func (m *MemStore) CreateTemplate(template *Template) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Names are unique even among deleted templates, as in the database
+	for _, existing := range m.state.templates {
+		if existing.Name == template.Name {
+			return ErrExists
+		}
+	}
+
+	now := time.Now()
+	template.ID = m.nextID()
+	template.CreatedAt = now
+	template.UpdatedAt = now
+	m.state.templates[template.ID] = *template
+	return nil
+}
+
+func (m *MemStore) SaveTemplate(template *Template) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if template.ID == 0 {
+		template.ID = m.nextID()
+	}
+	template.UpdatedAt = time.Now()
+	m.state.templates[template.ID] = *template
+	return nil
+}
+
+func (m *MemStore) Preference(key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok := m.state.prefs[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func (m *MemStore) SetPreference(key, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state.prefs[key] = value
+	return nil
+}
+
+func (m *MemStore) WriteFile(name, content string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.state.files[name]; ok {
+		return ErrExists
+	}
+	m.state.files[name] = content
+	return nil
+}
+
+// File is the content of a file written to the store
+func (m *MemStore) File(name string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	content, ok := m.state.files[name]
+	return content, ok
+}
+
+func (m *MemStore) Transaction(fn func(tx Store) error) error {
+	m.mu.Lock()
+	saved := m.state.clone()
+	m.mu.Unlock()
+
+	if err := fn(m); err != nil {
+		m.mu.Lock()
+		m.state = saved
+		m.mu.Unlock()
+		return err
+	}
+	return nil
+}
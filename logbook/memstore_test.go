@@ -0,0 +1,157 @@
+package logbook
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// stores are the stores a Service can use, for tests that both behave alike
+func stores(t *testing.T) map[string]Store {
+	conn, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	return map[string]Store{
+		"sql":    NewSQLStore(conn, t.TempDir()),
+		"memory": NewMemStore(),
+	}
+}
+
+func descriptions(dos []Do) []string {
+	var names []string
+	for _, do := range dos {
+		names = append(names, do.Description)
+	}
+	return names
+}
+
+func TestStoresOrderAlike(t *testing.T) {
+	queries := []Query{
+		{},
+		{Sort: SortPriority},
+		{Sort: SortDescription, Asc: true},
+		{For: "dave"},
+	}
+
+	got := map[string][][]string{}
+	for name, store := range stores(t) {
+		svc := New(store)
+		svc.AddDo(NewDo{Do: Do{Description: "b low", Priority: Low}})
+		svc.AddDo(NewDo{Do: Do{Description: "a high", Priority: High}, For: "dave", Recruit: true})
+		done, _ := svc.AddDo(NewDo{Do: Do{Description: "c done"}})
+		svc.Complete(done.ID)
+
+		for _, q := range queries {
+			dos, err := svc.Query(q)
+			if err != nil {
+				t.Fatalf("%s: Query: %v", name, err)
+			}
+			got[name] = append(got[name], descriptions(dos))
+		}
+	}
+
+	for i, q := range queries {
+		if !slices.Equal(got["sql"][i], got["memory"][i]) {
+			t.Errorf("Query %+v: database gave %v, memory gave %v", q, got["sql"][i], got["memory"][i])
+		}
+	}
+}
+
+func TestTransactionUndone(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			failed := errors.New("failed")
+			err := store.Transaction(func(tx Store) error {
+				if err := tx.CreateDo(&Do{Description: "Undone", Type: Task, Priority: Medium}); err != nil {
+					return err
+				}
+				return failed
+			})
+			if !errors.Is(err, failed) {
+				t.Errorf("Expected the transaction's error, got %v", err)
+			}
+
+			dos, _ := store.Dos(Query{})
+			if len(dos) != 0 {
+				t.Errorf("Expected the do to be undone, got %v", descriptions(dos))
+			}
+		})
+	}
+}
+
+func TestMemStorePromote(t *testing.T) {
+	store := NewMemStore()
+	svc := New(store)
+	do, _ := svc.AddDo(NewDo{Do: Do{Description: "Plan"}, Doc: "steps"})
+
+	if _, err := svc.Promote(do.ID, "plan"); err != nil {
+		t.Fatalf("Promote: %v", err)
+	}
+	if content, ok := store.File("plan.do"); !ok || content != "# Plan\n\nsteps" {
+		t.Errorf("Expected plan.do to be written, got %q", content)
+	}
+	if _, err := svc.Promote(do.ID, "plan"); !errors.Is(err, ErrExists) {
+		t.Errorf("Expected ErrExists promoting twice, got %v", err)
+	}
+}
+
+// failingStore fails to save dos, inside transactions too
+type failingStore struct {
+	Store
+}
+
+func (f failingStore) SaveDo(do *Do) error {
+	return Errorf(ErrStorage, "could not save do")
+}
+
+func (f failingStore) Transaction(fn func(tx Store) error) error {
+	return f.Store.Transaction(func(tx Store) error {
+		return fn(failingStore{tx})
+	})
+}
+
+func TestPromoteIsUndoneOnFailure(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			do, _ := New(store).AddDo(NewDo{Do: Do{Description: "Plan"}, Doc: "steps"})
+
+			promoted, err := New(failingStore{store}).Promote(do.ID, "plan")
+			if !errors.Is(err, ErrStorage) || promoted.Promoted {
+				t.Fatalf("Expected the promotion to fail, got %+v, %v", promoted, err)
+			}
+			if do, _ := New(store).Get(do.ID); do.Promoted || do.File != "" {
+				t.Errorf("Expected the do left unpromoted, got %+v", do)
+			}
+			if mem, ok := store.(*MemStore); ok {
+				if _, written := mem.File("plan.do"); written {
+					t.Errorf("Expected plan.do not to be kept")
+				}
+			}
+		})
+	}
+}
+
+func TestServiceTransaction(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			svc := New(store)
+			do, _ := svc.AddDo(NewDo{Do: Do{Description: "Plan"}})
+
+			err := svc.Transaction(func(tx *Service) error {
+				if _, err := tx.Recruit("newbie"); err != nil {
+					return err
+				}
+				_, err := tx.Assign(do.ID+100, "newbie")
+				return err
+			})
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Expected ErrNotFound assigning a missing do, got %v", err)
+			}
+			if crew, _ := svc.Crew(); len(crew) != 0 {
+				t.Errorf("Expected the recruit undone, got %v", crew)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package logbook
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration changes the schema of the logbook from the version before it to
+// its own. Down undoes Up, it's nil when the change can't be undone.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration records a migration that has been applied
+type SchemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrations are the changes to the schema, oldest first. New ones go on the
+// end and never change once released; a field added to a model gets a
+// migration adding its column, as the live models aren't migrated.
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		// The tables as AutoMigrate made them before there were migrations,
+		// from the models as they were then
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(v1Models...)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "index docs by do",
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec("CREATE INDEX IF NOT EXISTS idx_do_docs_do_id ON do_docs(do_id)").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("DROP INDEX IF EXISTS idx_do_docs_do_id").Error
+		},
+	},
+	{
+		Version: 3,
+		Name:    "record promoted files",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&Do{}, "File") {
+				return nil
+			}
+			return tx.Exec("ALTER TABLE `dos` ADD `file` TEXT").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE `dos` DROP COLUMN `file`").Error
+		},
+	},
+}
+
+// Latest is the version of the newest migration
+func Latest(migrations []Migration) int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// MigrationStatus is a migration and when it was applied, nil if it hasn't
+// been.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// applied are the migrations recorded in conn, none when the table isn't
+// there yet
+func applied(conn *gorm.DB) (map[int]SchemaMigration, error) {
+	done := map[int]SchemaMigration{}
+	if !conn.Migrator().HasTable(&SchemaMigration{}) {
+		return done, nil
+	}
+	var rows []SchemaMigration
+	if err := conn.Find(&rows).Error; err != nil {
+		return nil, StorageError("fetch schema_migrations", err)
+	}
+	for _, row := range rows {
+		done[row.Version] = row
+	}
+	return done, nil
+}
+
+// Statuses says which of the migrations have been applied to conn
+func Statuses(conn *gorm.DB, migrations []Migration) ([]MigrationStatus, error) {
+	done, err := applied(conn)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		statuses[i].Migration = m
+		if row, ok := done[m.Version]; ok {
+			statuses[i].AppliedAt = &row.AppliedAt
+		}
+	}
+	return statuses, nil
+}
+
+// Version is the newest migration applied to conn, 0 for none
+func Version(conn *gorm.DB) (int, error) {
+	done, err := applied(conn)
+	if err != nil {
+		return 0, err
+	}
+	version := 0
+	for v := range done {
+		version = max(version, v)
+	}
+	return version, nil
+}
+
+// Step is a migration to run, or to undo
+type Step struct {
+	Migration
+	Undo bool
+}
+
+func (s Step) String() string {
+	if s.Undo {
+		return fmt.Sprintf("%d %s (down)", s.Version, s.Name)
+	}
+	return fmt.Sprintf("%d %s", s.Version, s.Name)
+}
+
+// Plan is the steps that take conn to version: the migrations up to it that
+// haven't been applied, oldest first, or those after it that have, newest
+// first.
+func Plan(conn *gorm.DB, migrations []Migration, version int) ([]Step, error) {
+	if version < 0 || version > Latest(migrations) {
+		return nil, Errorf(ErrInvalid, "no schema version %d, the latest is %d", version, Latest(migrations))
+	}
+	done, err := applied(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var undo, up []Step
+	for _, m := range migrations {
+		_, ok := done[m.Version]
+		switch {
+		case !ok && m.Version <= version:
+			up = append(up, Step{Migration: m})
+		case ok && m.Version > version:
+			if m.Down == nil {
+				return nil, Errorf(ErrInvalid, "migration %d (%s) can't be undone", m.Version, m.Name)
+			}
+			undo = append(undo, Step{Migration: m, Undo: true})
+		}
+	}
+	// Undo the newest first
+	slices.Reverse(undo)
+	return append(undo, up...), nil
+}
+
+// Run applies steps to conn, each in a transaction with its record in
+// schema_migrations. It stops at the first that fails, returning the steps
+// that ran.
+func Run(conn *gorm.DB, steps []Step) ([]Step, error) {
+	if err := conn.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, StorageError("create schema_migrations", err)
+	}
+	var ran []Step
+	for _, step := range steps {
+		err := conn.Transaction(func(tx *gorm.DB) error {
+			if step.Undo {
+				if err := step.Down(tx); err != nil {
+					return err
+				}
+				return tx.Delete(&SchemaMigration{}, step.Version).Error
+			}
+			if err := step.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: step.Version, Name: step.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return ran, StorageError(fmt.Sprintf("migrate %s", step), err)
+		}
+		ran = append(ran, step)
+	}
+	return ran, nil
+}
+
+// Migrate takes the database at path, opened as conn, to version. Unless it's
+// new the database is backed up first, the backup's path is returned along
+// with the steps that ran.
+func Migrate(conn *gorm.DB, path string, migrations []Migration, version int) (string, []Step, error) {
+	steps, err := Plan(conn, migrations, version)
+	if err != nil || len(steps) == 0 {
+		return "", nil, err
+	}
+
+	var backup string
+	if conn.Migrator().HasTable(&Do{}) {
+		backup = BackupPath(path, fmt.Sprintf("pre-migrate-v%d", version), time.Now())
+		if err := Backup(conn, backup); err != nil {
+			return "", nil, err
+		}
+	}
+
+	ran, err := Run(conn, steps)
+	return backup, ran, err
+}
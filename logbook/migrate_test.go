@@ -0,0 +1,218 @@
+package logbook
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// testMigrations make and drop a table each, the last can't be undone
+func testMigrations() []Migration {
+	table := func(name string) (func(*gorm.DB) error, func(*gorm.DB) error) {
+		return func(tx *gorm.DB) error {
+				return tx.Exec("CREATE TABLE " + name + " (id integer)").Error
+			}, func(tx *gorm.DB) error {
+				return tx.Exec("DROP TABLE " + name).Error
+			}
+	}
+	upA, downA := table("a")
+	upB, downB := table("b")
+	upC, _ := table("c")
+	return []Migration{
+		{Version: 1, Name: "a", Up: upA, Down: downA},
+		{Version: 2, Name: "b", Up: upB, Down: downB},
+		{Version: 3, Name: "c", Up: upC},
+	}
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	conn, err := Connect(path)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	migrations := testMigrations()
+
+	if _, ran, err := Migrate(conn, path, migrations, 2); err != nil || len(ran) != 2 {
+		t.Fatalf("Expected 2 migrations to run, got %v, %v", ran, err)
+	}
+	if version, _ := Version(conn); version != 2 {
+		t.Errorf("Expected version 2, got %d", version)
+	}
+	if !conn.Migrator().HasTable("b") || conn.Migrator().HasTable("c") {
+		t.Errorf("Expected tables up to b")
+	}
+
+	_, ran, err := Migrate(conn, path, migrations, 0)
+	if err != nil || len(ran) != 2 || !ran[0].Undo || ran[0].Version != 2 {
+		t.Fatalf("Expected b then a undone, got %v, %v", ran, err)
+	}
+	if conn.Migrator().HasTable("a") {
+		t.Errorf("Expected a to be dropped")
+	}
+
+	if _, _, err := Migrate(conn, path, migrations, 3); err != nil {
+		t.Fatalf("Migrate to 3: %v", err)
+	}
+	if _, _, err := Migrate(conn, path, migrations, 2); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected ErrInvalid undoing an irreversible migration, got %v", err)
+	}
+	if _, _, err := Migrate(conn, path, migrations, 4); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected ErrInvalid for an unknown version, got %v", err)
+	}
+
+	statuses, err := Statuses(conn, migrations)
+	if err != nil {
+		t.Fatalf("Statuses: %v", err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			t.Errorf("Expected migration %d to be applied", status.Version)
+		}
+	}
+}
+
+func TestMigrateFailureRollsBack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	conn, err := Connect(path)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	migrations := append(testMigrations()[:1], Migration{
+		Version: 2,
+		Name:    "broken",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Exec("CREATE TABLE half (id integer)").Error; err != nil {
+				return err
+			}
+			return tx.Exec("NOT SQL").Error
+		},
+	})
+
+	_, ran, err := Migrate(conn, path, migrations, 2)
+	if !errors.Is(err, ErrStorage) || len(ran) != 1 {
+		t.Fatalf("Expected the first migration only, got %v, %v", ran, err)
+	}
+	if conn.Migrator().HasTable("half") {
+		t.Errorf("Expected the broken migration to be rolled back")
+	}
+	if version, _ := Version(conn); version != 1 {
+		t.Errorf("Expected version 1, got %d", version)
+	}
+}
+
+func TestOpenBacksUpBeforeMigrating(t *testing.T) {
+	dir := t.TempDir()
+
+	// A new logbook has nothing to back up
+	path := filepath.Join(dir, "new.db")
+	if _, err := Open(path); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "backups")); !os.IsNotExist(err) {
+		t.Errorf("Expected no backups for a new database, got %v", err)
+	}
+
+	// A logbook from before migrations, made by AutoMigrate
+	path = filepath.Join(dir, "old.db")
+	conn, err := Connect(path)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if err := conn.AutoMigrate(v1Models...); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+	conn.Create(&v1Do{Description: "Keep me"})
+
+	backup, ran, err := Migrate(conn, path, Migrations, Latest(Migrations))
+	if err != nil || len(ran) != len(Migrations) {
+		t.Fatalf("Expected every migration to run, got %v, %v", ran, err)
+	}
+	if filepath.Dir(backup) != filepath.Join(dir, "backups") {
+		t.Fatalf("Expected a backup in the backups directory, got %q", backup)
+	}
+
+	saved, err := Connect(backup)
+	if err != nil {
+		t.Fatalf("Connect to backup: %v", err)
+	}
+	var do Do
+	if err := saved.First(&do).Error; err != nil || do.Description != "Keep me" {
+		t.Errorf("Expected the backup to hold the do, got %+v, %v", do, err)
+	}
+	if saved.Migrator().HasTable(&SchemaMigration{}) {
+		t.Errorf("Expected the backup to be taken before migrating")
+	}
+
+	if backup, ran, err := Migrate(conn, path, Migrations, Latest(Migrations)); backup != "" || len(ran) != 0 || err != nil {
+		t.Errorf("Expected nothing to do the second time, got %q, %v, %v", backup, ran, err)
+	}
+}
+
+// columns are the columns of each of the models' tables in conn
+func columns(t *testing.T, conn *gorm.DB) map[string][]string {
+	t.Helper()
+	tables := map[string][]string{}
+	for _, model := range Models {
+		stmt := &gorm.Statement{DB: conn}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+		types, err := conn.Migrator().ColumnTypes(model)
+		if err != nil {
+			t.Fatalf("ColumnTypes: %v", err)
+		}
+		for _, column := range types {
+			tables[stmt.Table] = append(tables[stmt.Table], column.Name())
+		}
+		slices.Sort(tables[stmt.Table])
+	}
+	return tables
+}
+
+func TestMigrationsMatchModels(t *testing.T) {
+	migrated, err := Open(filepath.Join(t.TempDir(), "migrated.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	automigrated, err := Connect(filepath.Join(t.TempDir(), "automigrated.db"))
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if err := automigrated.AutoMigrate(Models...); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+
+	// A field added to a model without a migration for its column fails here
+	want, got := columns(t, automigrated), columns(t, migrated)
+	for table, names := range want {
+		if !slices.Equal(got[table], names) {
+			t.Errorf("Expected %s to have columns %v once migrated, got %v", table, names, got[table])
+		}
+	}
+}
+
+func TestRecordPromotedFilesMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	conn, err := Connect(path)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	if _, _, err := Migrate(conn, path, Migrations, 2); err != nil {
+		t.Fatalf("Migrate to 2: %v", err)
+	}
+	if conn.Migrator().HasColumn(&Do{}, "File") {
+		t.Fatalf("Expected no file column at version 2")
+	}
+	if _, _, err := Migrate(conn, path, Migrations, 3); err != nil || !conn.Migrator().HasColumn(&Do{}, "File") {
+		t.Fatalf("Expected the file column at version 3, got %v", err)
+	}
+	if _, _, err := Migrate(conn, path, Migrations, 2); err != nil || conn.Migrator().HasColumn(&Do{}, "File") {
+		t.Errorf("Expected the file column dropped going back to 2, got %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package logbook
+
+import "time"
+
+type DoType string
+
+const (
+	Task  DoType = "task"
+	Ask   DoType = "ask"
+	Tell  DoType = "tell"
+	Brag  DoType = "brag"
+	Learn DoType = "learn"
+	PR    DoType = "PR"
+	Meta  DoType = "meta"
+)
+
+type DoPrio string
+
+const (
+	Low    DoPrio = "low"
+	Medium DoPrio = "medium"
+	High   DoPrio = "high"
+)
+
+type Do struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UID         string     `gorm:"index" json:"uid"` // stable id used when exporting and importing
+	CreatedAt   time.Time  `gorm:"default:current_timestamp" json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty"`
+	Completed   bool       `gorm:"default:false" json:"completed"`
+	Pinned      bool       `gorm:"default:false" json:"pinned"`
+	Sensitive   bool       `gorm:"default:false" json:"sensitive"`
+	Promoted    bool       `gorm:"default:false" json:"promoted"`
+	File        string     `gorm:"type:TEXT" json:"file,omitempty"` // the .do file it was promoted to
+	Description string     `gorm:"not null" json:"description"`
+	Type        DoType     `gorm:"type:TEXT;not null" json:"type"`
+	Priority    DoPrio     `gorm:"type:TEXT;not null;default:medium" json:"priority"`
+	Estimate    int        `gorm:"default:0" json:"estimate"` // minutes, 0 when not estimated
+	Deleted     bool       `gorm:"default:false" json:"deleted"`
+	Reason      string     `gorm:"type:TEXT" json:"reason"`
+	ParentID    *uint      `gorm:"index" json:"parent_id,omitempty"`
+	Doc         DoDoc      `gorm:"foreignKey:DoID" json:"doc"`
+	Git         *GitLink   `gorm:"foreignKey:DoID" json:"git,omitempty"`
+	Tags        []Tag      `gorm:"many2many:do_tags;" json:"tags"`
+}
+
+func (DoType) GormDataType() string {
+	return "string"
+}
+
+type DoDoc struct {
+	ID   uint   `gorm:"primaryKey" json:"id"`
+	DoID uint   `gorm:"not null" json:"do_id"`
+	Text string `gorm:"type:TEXT;not null" json:"text"`
+}
+
+type Tag struct {
+	ID   uint   `gorm:"primaryKey" json:"id"`
+	Name string `gorm:"unique:not null" json:"name"`
+}
+
+type DoTag struct {
+	DoID  uint `gorm:"primaryKey;not null"`
+	TagID uint `gorm:"primaryKey;not null"`
+	Do    Do   `gorm:"foreignKey:DoID"`
+	Tag   Tag  `gorm:"foreignKey:TagID"`
+}
+
+type Template struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"unique;not null" json:"name"`
+	Content   string    `gorm:"type:TEXT;not null" json:"content"`
+	Deleted   bool      `gorm:"default:false" json:"deleted"`
+	CreatedAt time.Time `gorm:"default:current_timestamp" json:"created_at"`
+	UpdatedAt time.Time `gorm:"default:current_timestamp" json:"updated_at"`
+}
+
+// Harvest links a do to the marker in a notes file it was harvested from
+type Harvest struct {
+	ID     uint   `gorm:"primaryKey"`
+	DoID   uint   `gorm:"uniqueIndex;not null"`
+	Path   string `gorm:"index;not null"`
+	Line   int    `gorm:"not null"`
+	Marker string `gorm:"type:TEXT;not null"`
+	Do     Do     `gorm:"foreignKey:DoID"`
+}
+
+// GitLink ties a PR do to a branch in a local repository
+type GitLink struct {
+	ID       uint       `gorm:"primaryKey" json:"id"`
+	DoID     uint       `gorm:"uniqueIndex;not null" json:"do_id"`
+	Repo     string     `gorm:"not null" json:"repo"`
+	Branch   string     `gorm:"not null" json:"branch"`
+	Base     string     `json:"base"` // the branch it merges into, main or master when empty
+	Head     string     `json:"head"` // the last commit seen on the branch
+	State    string     `gorm:"type:TEXT" json:"state"`
+	Ahead    int        `gorm:"default:0" json:"ahead"`
+	SyncedAt *time.Time `json:"synced_at,omitempty"`
+}
+
+// VFS models, stored for the files browser
+
+type FileRecord struct {
+	ID        string    `gorm:"primaryKey"`
+	Name      string    `gorm:"not null"`
+	ParentID  *string   `gorm:"index"`
+	IsDir     bool      `gorm:"not null"`
+	Color     string    `gorm:"default:''"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+	Size      int64     `gorm:"default:0"`
+	Deleted   bool      `gorm:"default:false"`
+}
+
+type DirectoryState struct {
+	ID        uint   `gorm:"primaryKey"`
+	Path      string `gorm:"uniqueIndex;not null"`
+	SortBy    int    `gorm:"default:0"`
+	SortAsc   bool   `gorm:"default:true"`
+	CursorPos int    `gorm:"default:0"`
+}
+
+type UserPreference struct {
+	ID    uint   `gorm:"primaryKey"`
+	Key   string `gorm:"uniqueIndex;not null"`
+	Value string
+}
+
+// Mate is someone in the crew and how many dos are for them
+type Mate struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
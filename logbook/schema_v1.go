@@ -0,0 +1,132 @@
+package logbook
+
+import "time"
+
+// The models as they were at schema version 1, before there were
+// migrations. The first migration makes its tables from these so that it
+// means the same however the models change later: a new field gets a
+// migration of its own, these are never edited.
+
+type v1Do struct {
+	ID          uint      `gorm:"primaryKey"`
+	UID         string    `gorm:"index"`
+	CreatedAt   time.Time `gorm:"default:current_timestamp"`
+	UpdatedAt   time.Time
+	CompletedAt *time.Time
+	DueAt       *time.Time
+	ScheduledAt *time.Time
+	Completed   bool       `gorm:"default:false"`
+	Pinned      bool       `gorm:"default:false"`
+	Sensitive   bool       `gorm:"default:false"`
+	Promoted    bool       `gorm:"default:false"`
+	Description string     `gorm:"not null"`
+	Type        string     `gorm:"type:TEXT;not null"`
+	Priority    string     `gorm:"type:TEXT;not null;default:medium"`
+	Estimate    int        `gorm:"default:0"`
+	Deleted     bool       `gorm:"default:false"`
+	Reason      string     `gorm:"type:TEXT"`
+	ParentID    *uint      `gorm:"index"`
+	Doc         v1DoDoc    `gorm:"foreignKey:DoID"`
+	Git         *v1GitLink `gorm:"foreignKey:DoID"`
+	Tags        []v1Tag    `gorm:"many2many:do_tags;joinForeignKey:DoID;joinReferences:TagID"`
+}
+
+func (v1Do) TableName() string { return "dos" }
+
+type v1DoDoc struct {
+	ID   uint   `gorm:"primaryKey"`
+	DoID uint   `gorm:"not null"`
+	Text string `gorm:"type:TEXT;not null"`
+}
+
+func (v1DoDoc) TableName() string { return "do_docs" }
+
+type v1Tag struct {
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"unique:not null"`
+}
+
+func (v1Tag) TableName() string { return "tags" }
+
+type v1DoTag struct {
+	DoID  uint  `gorm:"primaryKey;not null"`
+	TagID uint  `gorm:"primaryKey;not null"`
+	Do    v1Do  `gorm:"foreignKey:DoID"`
+	Tag   v1Tag `gorm:"foreignKey:TagID"`
+}
+
+func (v1DoTag) TableName() string { return "do_tags" }
+
+type v1Template struct {
+	ID        uint      `gorm:"primaryKey"`
+	Name      string    `gorm:"unique;not null"`
+	Content   string    `gorm:"type:TEXT;not null"`
+	Deleted   bool      `gorm:"default:false"`
+	CreatedAt time.Time `gorm:"default:current_timestamp"`
+	UpdatedAt time.Time `gorm:"default:current_timestamp"`
+}
+
+func (v1Template) TableName() string { return "templates" }
+
+type v1Harvest struct {
+	ID     uint   `gorm:"primaryKey"`
+	DoID   uint   `gorm:"uniqueIndex;not null"`
+	Path   string `gorm:"index;not null"`
+	Line   int    `gorm:"not null"`
+	Marker string `gorm:"type:TEXT;not null"`
+	Do     v1Do   `gorm:"foreignKey:DoID"`
+}
+
+func (v1Harvest) TableName() string { return "harvests" }
+
+type v1GitLink struct {
+	ID       uint   `gorm:"primaryKey"`
+	DoID     uint   `gorm:"uniqueIndex;not null"`
+	Repo     string `gorm:"not null"`
+	Branch   string `gorm:"not null"`
+	Base     string
+	Head     string
+	State    string `gorm:"type:TEXT"`
+	Ahead    int    `gorm:"default:0"`
+	SyncedAt *time.Time
+}
+
+func (v1GitLink) TableName() string { return "git_links" }
+
+type v1FileRecord struct {
+	ID        string    `gorm:"primaryKey"`
+	Name      string    `gorm:"not null"`
+	ParentID  *string   `gorm:"index"`
+	IsDir     bool      `gorm:"not null"`
+	Color     string    `gorm:"default:''"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+	Size      int64     `gorm:"default:0"`
+	Deleted   bool      `gorm:"default:false"`
+}
+
+func (v1FileRecord) TableName() string { return "file_records" }
+
+type v1DirectoryState struct {
+	ID        uint   `gorm:"primaryKey"`
+	Path      string `gorm:"uniqueIndex;not null"`
+	SortBy    int    `gorm:"default:0"`
+	SortAsc   bool   `gorm:"default:true"`
+	CursorPos int    `gorm:"default:0"`
+}
+
+func (v1DirectoryState) TableName() string { return "directory_states" }
+
+type v1UserPreference struct {
+	ID    uint   `gorm:"primaryKey"`
+	Key   string `gorm:"uniqueIndex;not null"`
+	Value string
+}
+
+func (v1UserPreference) TableName() string { return "user_preferences" }
+
+// v1Models are migrated in the order Models were at version 1
+var v1Models = []any{
+	&v1Do{}, &v1Tag{}, &v1DoTag{}, &v1DoDoc{}, &v1Template{}, &v1Harvest{}, &v1GitLink{},
+	&v1FileRecord{}, &v1DirectoryState{}, &v1UserPreference{},
+}
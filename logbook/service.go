@@ -0,0 +1,506 @@
+package logbook
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/s3bw/mostxt/src"
+)
+
+// Service makes changes to the logbook
+type Service struct {
+	store Store
+
+	// Before is called with a do as it will be, just before a change to it
+	// is saved. Returning an error cancels the change.
+	Before func(event Event, do Do) error
+
+	// After is called with the changes made in a Transaction once they're
+	// saved. Before isn't called for them: it would run with the database
+	// locked, and again each time the transaction is retried.
+	After func(event Event, do Do)
+
+	// changes are those made so far in a transaction, nil outside of one
+	changes *[]change
+}
+
+// change is a change made in a transaction, told to After once it's saved
+type change struct {
+	event Event
+	do    Do
+}
+
+// New creates a Service over a store
+func New(store Store) *Service {
+	return &Service{store: store}
+}
+
+// Store is where the Service keeps the logbook
+func (s *Service) Store() Store {
+	return s.store
+}
+
+// Transaction makes the changes fn makes through tx all at once, or none of
+// them when it returns an error. After is told about them once they're saved.
+func (s *Service) Transaction(fn func(tx *Service) error) error {
+	if s.changes != nil {
+		// In a transaction already, whose changes After is told about
+		mark := len(*s.changes)
+		return s.store.Transaction(func(store Store) error {
+			*s.changes = (*s.changes)[:mark]
+			return fn(&Service{store: store, changes: s.changes})
+		})
+	}
+
+	var changes []change
+	err := s.store.Transaction(func(store Store) error {
+		// A retry starts over, forgetting the changes of the last try
+		changes = nil
+		return fn(&Service{store: store, changes: &changes})
+	})
+	if err != nil || s.After == nil {
+		return err
+	}
+	for _, c := range changes {
+		s.After(c.event, c.do)
+	}
+	return nil
+}
+
+func (s *Service) before(event Event, do Do) error {
+	if s.changes != nil {
+		*s.changes = append(*s.changes, change{event: event, do: do})
+		return nil
+	}
+	if s.Before == nil {
+		return nil
+	}
+	if err := s.Before(event, do); err != nil {
+		return &Error{Kind: ErrCancelled, Msg: fmt.Sprintf("%s cancelled: %v", event, err), Err: err}
+	}
+	return nil
+}
+
+// lookup turns ErrNotFound from the store into an error saying what's
+// missing, and passes other errors through.
+func lookup(err error, format string, args ...any) error {
+	if errors.Is(err, ErrNotFound) {
+		return Errorf(ErrNotFound, format, args...)
+	}
+	return err
+}
+
+// Get fetches a do that hasn't been scratched
+func (s *Service) Get(id uint) (Do, error) {
+	do, err := s.store.Do(id)
+	if err == nil && do.Deleted {
+		err = ErrNotFound
+	}
+	return do, lookup(err, "no do under id '%d'", id)
+}
+
+// Find fetches a do, scratched or not
+func (s *Service) Find(id uint) (Do, error) {
+	do, err := s.store.Do(id)
+	return do, lookup(err, "no do under id '%d'", id)
+}
+
+// NewDo is a do to add, who it's for and its documentation
+type NewDo struct {
+	Do  Do
+	For string
+	Doc string
+
+	// Recruit adds For to the crew if they aren't in it, otherwise adding a
+	// do for someone unknown is an error.
+	Recruit bool
+
+	// Unique refuses a do with the same description as another, ignoring
+	// case.
+	Unique bool
+}
+
+// AddDo adds a do, a task of medium priority unless it says otherwise
+func (s *Service) AddDo(add NewDo) (Do, error) {
+	do := add.Do
+	if strings.TrimSpace(do.Description) == "" {
+		return do, Errorf(ErrInvalid, "description can't be empty")
+	}
+	if do.Type == "" {
+		do.Type = Task
+	}
+	if do.Priority == "" {
+		do.Priority = Medium
+	}
+
+	do.Tags = nil
+	if add.For != "" {
+		tag, err := s.store.Tag(add.For)
+		switch {
+		case errors.Is(err, ErrNotFound) && add.Recruit:
+			tag = Tag{Name: add.For}
+		case err != nil:
+			return do, lookup(err, "no tag called '%s'", add.For)
+		}
+		do.Tags = []Tag{tag}
+	}
+
+	if add.Unique {
+		if err := unique(s.store, do.Description); err != nil {
+			return do, err
+		}
+	}
+
+	do.Doc = DoDoc{Text: add.Doc}
+	if err := s.before(OnCreate, do); err != nil {
+		return do, err
+	}
+
+	err := s.store.Transaction(func(tx Store) error {
+		// Again, in case another was added while the hooks ran
+		if add.Unique {
+			if err := unique(tx, do.Description); err != nil {
+				return err
+			}
+		}
+		if err := tx.CreateDo(&do); err != nil {
+			return err
+		}
+		if add.For != "" {
+			if err := tx.SetCrew(do.ID, add.For); err != nil {
+				return err
+			}
+		}
+		if add.Doc != "" {
+			return tx.SetDoc(do.ID, add.Doc)
+		}
+		return nil
+	})
+	if err != nil {
+		return do, err
+	}
+	return s.store.Do(do.ID)
+}
+
+// unique refuses a description another do has, ignoring case
+func unique(store Store, description string) error {
+	existing, err := store.DoByDescription(description)
+	if err == nil {
+		return Errorf(ErrExists, "do already exists: %d", existing.ID)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// Complete marks a do as done, leaving one that's already done as it is
+func (s *Service) Complete(id uint) (Do, error) {
+	do, err := s.Get(id)
+	if err != nil || do.Completed {
+		return do, err
+	}
+
+	now := time.Now()
+	do.Completed = true
+	do.CompletedAt = &now
+	if err := s.before(OnComplete, do); err != nil {
+		return do, err
+	}
+	return do, s.store.SaveDo(&do)
+}
+
+// Scratch soft deletes a do, with a reason if there is one
+func (s *Service) Scratch(id uint, reason string) (Do, error) {
+	do, err := s.Get(id)
+	if err != nil {
+		return do, err
+	}
+
+	do.Deleted = true
+	do.Reason = reason
+	if err := s.before(OnScratch, do); err != nil {
+		return do, err
+	}
+	return do, s.store.SaveDo(&do)
+}
+
+// Unscratch brings back a scratched do
+func (s *Service) Unscratch(id uint) (Do, error) {
+	do, err := s.Find(id)
+	if err != nil {
+		return do, err
+	}
+
+	do.Deleted = false
+	return do, s.store.SaveDo(&do)
+}
+
+// Update changes the fields of a do, e.g. its priority or description. An
+// error from change is returned as it is and nothing is saved.
+func (s *Service) Update(id uint, change func(do *Do) error) (Do, error) {
+	do, err := s.Get(id)
+	if err != nil {
+		return do, err
+	}
+	if err := change(&do); err != nil {
+		return do, err
+	}
+	return do, s.store.SaveDo(&do)
+}
+
+// Assign gives a do to someone in the crew, replacing who it was for
+func (s *Service) Assign(id uint, name string) (Do, error) {
+	return s.AssignAll(id, name)
+}
+
+// AssignAll gives a do to everyone named, all of them in the crew,
+// replacing who it was for
+func (s *Service) AssignAll(id uint, names ...string) (Do, error) {
+	do, err := s.Get(id)
+	if err != nil {
+		return do, err
+	}
+
+	hooked := do
+	hooked.Tags = nil
+	for _, name := range names {
+		tag, err := s.store.Tag(name)
+		if err != nil {
+			return do, lookup(err, "no recruit called '%s'", name)
+		}
+		hooked.Tags = append(hooked.Tags, tag)
+	}
+	if err := s.before(OnReassign, hooked); err != nil {
+		return do, err
+	}
+	return s.setCrew(do, names...)
+}
+
+// Unassign leaves a do for no one
+func (s *Service) Unassign(id uint) (Do, error) {
+	return s.AssignAll(id)
+}
+
+func (s *Service) setCrew(do Do, names ...string) (Do, error) {
+	err := s.store.Transaction(func(tx Store) error {
+		if err := tx.SetCrew(do.ID, names...); err != nil {
+			return err
+		}
+		// Who it's for is a change to the do
+		return tx.SaveDo(&do)
+	})
+	if err != nil {
+		return do, err
+	}
+	return s.store.Do(do.ID)
+}
+
+// SetDoc replaces the documentation of a do, removing it when text is blank
+func (s *Service) SetDoc(id uint, text string) (Do, error) {
+	do, err := s.Get(id)
+	if err != nil {
+		return do, err
+	}
+
+	hooked := do
+	hooked.Doc.DoID = do.ID
+	hooked.Doc.Text = text
+	if err := s.before(OnDoc, hooked); err != nil {
+		return do, err
+	}
+
+	err = s.store.Transaction(func(tx Store) error {
+		if err := tx.SetDoc(do.ID, text); err != nil {
+			return err
+		}
+		// A new doc is a change to the do
+		return tx.SaveDo(&do)
+	})
+	if err != nil {
+		return do, err
+	}
+	return s.store.Do(do.ID)
+}
+
+// Query finds the dos matching q, with their docs, links and crew
+func (s *Service) Query(q Query) ([]Do, error) {
+	return s.store.Dos(q)
+}
+
+// Promote writes a do and its documentation to a .do file and takes it off
+// the log.
+func (s *Service) Promote(id uint, filename string) (Do, error) {
+	filename = strings.TrimSpace(filename)
+	if filename == "" {
+		return Do{}, Errorf(ErrInvalid, "filename cannot be empty")
+	}
+	if !strings.HasSuffix(filename, ".do") {
+		filename += ".do"
+	}
+
+	do, err := s.Get(id)
+	if err != nil {
+		return do, err
+	}
+	if do.Promoted {
+		return do, Errorf(ErrExists, "do %d is already promoted", do.ID)
+	}
+
+	do.Promoted = true
+	do.File = filename
+	if err := s.before(OnPromote, do); err != nil {
+		return do, err
+	}
+
+	// The description as a header and the doc as the body. The do is only
+	// promoted if its file is saved, and the file only kept if the do is.
+	content := fmt.Sprintf("# %s\n\n%s", do.Description, do.Doc.Text)
+	err = s.store.Transaction(func(tx Store) error {
+		if err := tx.WriteFile(filename, content); err != nil {
+			return err
+		}
+		return tx.SaveDo(&do)
+	})
+	if err != nil {
+		do.Promoted, do.File = false, ""
+	}
+	return do, err
+}
+
+// Template fetches a template that hasn't been deleted
+func (s *Service) Template(name string) (Template, error) {
+	template, err := s.store.Template(name)
+	return template, lookup(err, "no template named '%s'", name)
+}
+
+// Templates lists the templates by name
+func (s *Service) Templates() ([]Template, error) {
+	return s.store.Templates()
+}
+
+// checkTemplate refuses a template that is empty or can't be parsed
+func checkTemplate(content string) error {
+	if content == "" {
+		return Errorf(ErrInvalid, "template content is empty")
+	}
+	if _, err := src.ParseTemplate(content); err != nil {
+		return &Error{Kind: ErrInvalid, Msg: fmt.Sprintf("error parsing template syntax: %v", err), Err: err}
+	}
+	return nil
+}
+
+// CreateTemplate adds a template after checking its syntax
+func (s *Service) CreateTemplate(name, content string) (Template, error) {
+	template := Template{Name: name, Content: strings.TrimSpace(content)}
+	if strings.TrimSpace(name) == "" {
+		return template, Errorf(ErrInvalid, "template name can't be empty")
+	}
+	if err := checkTemplate(template.Content); err != nil {
+		return template, err
+	}
+
+	if _, err := s.store.Template(name); err == nil {
+		return template, Errorf(ErrExists, "template '%s' already exists", name)
+	} else if !errors.Is(err, ErrNotFound) {
+		return template, err
+	}
+
+	if err := s.store.CreateTemplate(&template); err != nil {
+		return template, lookup(err, "template '%s' already exists", name)
+	}
+	return template, nil
+}
+
+// UpdateTemplate replaces the content of a template after checking its
+// syntax.
+func (s *Service) UpdateTemplate(name, content string) (Template, error) {
+	template, err := s.Template(name)
+	if err != nil {
+		return template, err
+	}
+
+	template.Content = strings.TrimSpace(content)
+	if err := checkTemplate(template.Content); err != nil {
+		return template, err
+	}
+	return template, s.store.SaveTemplate(&template)
+}
+
+// DeleteTemplate soft deletes a template
+func (s *Service) DeleteTemplate(name string) (Template, error) {
+	template, err := s.Template(name)
+	if err != nil {
+		return template, err
+	}
+
+	template.Deleted = true
+	return template, s.store.SaveTemplate(&template)
+}
+
+// ApplyTemplate fills in a template, asking input for the value of each of
+// its placeholders.
+func (s *Service) ApplyTemplate(name string, input func(arg src.Argument) string) (string, error) {
+	template, err := s.Template(name)
+	if err != nil {
+		return "", err
+	}
+
+	arguments, err := src.ParseTemplate(template.Content)
+	if err != nil {
+		return "", &Error{Kind: ErrInvalid, Msg: fmt.Sprintf("error parsing template: %v", err), Err: err}
+	}
+
+	inputs := make(map[string]string)
+	for _, arg := range arguments {
+		inputs[arg.Name] = input(arg)
+	}
+	return src.FillTemplate(template.Content, arguments, inputs), nil
+}
+
+// Recruit adds someone to the crew
+func (s *Service) Recruit(name string) (Tag, error) {
+	tag := Tag{Name: name}
+	if strings.TrimSpace(name) == "" {
+		return tag, Errorf(ErrInvalid, "name can't be empty")
+	}
+
+	if _, err := s.store.Tag(name); err == nil {
+		return tag, Errorf(ErrExists, "'%s' is already in the crew", name)
+	} else if !errors.Is(err, ErrNotFound) {
+		return tag, err
+	}
+	return tag, s.store.CreateTag(&tag)
+}
+
+// Rename changes what someone in the crew is called
+func (s *Service) Rename(name, newName string) (Tag, error) {
+	tag, err := s.store.Tag(name)
+	if err != nil {
+		return tag, lookup(err, "no tag under '%s'", name)
+	}
+
+	tag.Name = newName
+	return tag, s.store.SaveTag(&tag)
+}
+
+// Crew lists everyone and how many dos they have, busiest first
+func (s *Service) Crew() ([]Mate, error) {
+	return s.store.Crew()
+}
+
+// Preference is a setting kept in the logbook, empty when it isn't set
+func (s *Service) Preference(key string) (string, error) {
+	value, err := s.store.Preference(key)
+	if errors.Is(err, ErrNotFound) {
+		return "", nil
+	}
+	return value, err
+}
+
+// SetPreference keeps a setting in the logbook
+func (s *Service) SetPreference(key, value string) error {
+	return s.store.SetPreference(key, value)
+}
@@ -0,0 +1,315 @@
+package logbook
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func setupTestService(t *testing.T) *Service {
+	conn, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	return New(NewSQLStore(conn, t.TempDir()))
+}
+
+func TestAddDo(t *testing.T) {
+	svc := setupTestService(t)
+
+	do, err := svc.AddDo(NewDo{Do: Do{Description: "Ship it"}, Doc: "# Plan"})
+	if err != nil {
+		t.Fatalf("AddDo: %v", err)
+	}
+	if do.ID == 0 || do.Type != Task || do.Priority != Medium {
+		t.Errorf("Expected a medium task, got %+v", do)
+	}
+	if do.Doc.Text != "# Plan" {
+		t.Errorf("Expected the doc to be saved, got %+v", do.Doc)
+	}
+
+	if _, err := svc.AddDo(NewDo{Do: Do{Description: "SHIP IT"}, Unique: true}); !errors.Is(err, ErrExists) {
+		t.Errorf("Expected ErrExists for a duplicate, got %v", err)
+	}
+	if _, err := svc.AddDo(NewDo{Do: Do{Description: "  "}}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected ErrInvalid for a blank description, got %v", err)
+	}
+}
+
+func TestAddDoFor(t *testing.T) {
+	svc := setupTestService(t)
+
+	if _, err := svc.AddDo(NewDo{Do: Do{Description: "Ask"}, For: "alice"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for someone not in the crew, got %v", err)
+	}
+
+	do, err := svc.AddDo(NewDo{Do: Do{Description: "Ask", Type: Ask}, For: "alice", Recruit: true})
+	if err != nil {
+		t.Fatalf("AddDo: %v", err)
+	}
+	if len(do.Tags) != 1 || do.Tags[0].Name != "alice" {
+		t.Errorf("Expected the do to be for alice, got %+v", do.Tags)
+	}
+
+	crew, err := svc.Crew()
+	if err != nil || len(crew) != 1 || crew[0].Count != 1 {
+		t.Errorf("Expected alice in the crew with one do, got %+v (%v)", crew, err)
+	}
+}
+
+func TestCompleteAndScratch(t *testing.T) {
+	svc := setupTestService(t)
+	do, _ := svc.AddDo(NewDo{Do: Do{Description: "Done"}})
+
+	done, err := svc.Complete(do.ID)
+	if err != nil || !done.Completed || done.CompletedAt == nil {
+		t.Errorf("Expected the do to be completed, got %+v (%v)", done, err)
+	}
+
+	scratched, err := svc.Scratch(do.ID, "duplicate")
+	if err != nil || !scratched.Deleted || scratched.Reason != "duplicate" {
+		t.Errorf("Expected the do to be scratched, got %+v (%v)", scratched, err)
+	}
+
+	if _, err := svc.Complete(do.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a scratched do, got %v", err)
+	}
+	if _, err := svc.Unscratch(do.ID); err != nil {
+		t.Errorf("Unscratch: %v", err)
+	}
+	if _, err := svc.Get(do.ID); err != nil {
+		t.Errorf("Expected the do back after unscratching, got %v", err)
+	}
+}
+
+func TestBeforeCancels(t *testing.T) {
+	svc := setupTestService(t)
+	do, _ := svc.AddDo(NewDo{Do: Do{Description: "Guarded"}})
+
+	refused := errors.New("not today")
+	var events []Event
+	svc.Before = func(event Event, do Do) error {
+		events = append(events, event)
+		return refused
+	}
+
+	_, err := svc.Complete(do.ID)
+	if !errors.Is(err, ErrCancelled) || !errors.Is(err, refused) {
+		t.Errorf("Expected the change to be cancelled, got %v", err)
+	}
+	if len(events) != 1 || events[0] != OnComplete {
+		t.Errorf("Expected Before to be told about the completion, got %v", events)
+	}
+
+	fetched, _ := svc.Get(do.ID)
+	if fetched.Completed {
+		t.Error("Expected a cancelled completion not to be saved")
+	}
+}
+
+// retryingStore rolls back the first try of each transaction, as if the
+// database were busy, and runs it again
+type retryingStore struct {
+	*MemStore
+}
+
+func (r retryingStore) Transaction(fn func(tx Store) error) error {
+	r.MemStore.Transaction(func(Store) error {
+		fn(r)
+		return ErrStorage
+	})
+	return r.MemStore.Transaction(func(Store) error { return fn(r) })
+}
+
+func TestTransactionTellsAfterOnceSaved(t *testing.T) {
+	svc := New(retryingStore{NewMemStore()})
+	do, _ := svc.AddDo(NewDo{Do: Do{Description: "Batched"}})
+
+	var before, after []Event
+	svc.Before = func(event Event, do Do) error {
+		before = append(before, event)
+		return nil
+	}
+	svc.After = func(event Event, do Do) {
+		if saved, _ := svc.Get(do.ID); !saved.Completed {
+			t.Error("Expected After to be called once the change is saved")
+		}
+		after = append(after, event)
+	}
+
+	err := svc.Transaction(func(tx *Service) error {
+		_, err := tx.Complete(do.ID)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Transaction: %v", err)
+	}
+	if len(before) != 0 {
+		t.Errorf("Expected Before not to be called in a transaction, got %v", before)
+	}
+	if len(after) != 1 || after[0] != OnComplete {
+		t.Errorf("Expected After told of the completion once, got %v", after)
+	}
+
+	after = nil
+	svc.Transaction(func(tx *Service) error {
+		tx.Scratch(do.ID, "")
+		return errors.New("rolled back")
+	})
+	if len(after) != 0 {
+		t.Errorf("Expected After not told of changes rolled back, got %v", after)
+	}
+}
+
+func TestAssign(t *testing.T) {
+	svc := setupTestService(t)
+	do, _ := svc.AddDo(NewDo{Do: Do{Description: "Review"}})
+
+	if _, err := svc.Assign(do.ID, "bob"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for someone not in the crew, got %v", err)
+	}
+
+	svc.Recruit("bob")
+	if _, err := svc.Recruit("bob"); !errors.Is(err, ErrExists) {
+		t.Errorf("Expected ErrExists recruiting twice, got %v", err)
+	}
+
+	assigned, err := svc.Assign(do.ID, "bob")
+	if err != nil || len(assigned.Tags) != 1 || assigned.Tags[0].Name != "bob" {
+		t.Errorf("Expected the do to be for bob, got %+v (%v)", assigned.Tags, err)
+	}
+
+	unassigned, err := svc.Unassign(do.ID)
+	if err != nil || len(unassigned.Tags) != 0 {
+		t.Errorf("Expected the do to be for no one, got %+v (%v)", unassigned.Tags, err)
+	}
+}
+
+func TestAssignAll(t *testing.T) {
+	svc := setupTestService(t)
+	do, _ := svc.AddDo(NewDo{Do: Do{Description: "Pair"}})
+	svc.Recruit("bob")
+	svc.Recruit("carol")
+
+	var hooked [][]Tag
+	svc.Before = func(event Event, do Do) error {
+		if event == OnReassign {
+			hooked = append(hooked, do.Tags)
+		}
+		return nil
+	}
+
+	assigned, err := svc.AssignAll(do.ID, "bob", "carol")
+	if err != nil || len(assigned.Tags) != 2 {
+		t.Errorf("Expected the do to be for bob and carol, got %+v (%v)", assigned.Tags, err)
+	}
+	if _, err := svc.AssignAll(do.ID, "bob", "dave"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for someone not in the crew, got %v", err)
+	}
+	if _, err := svc.Unassign(do.ID); err != nil {
+		t.Fatalf("Unassign: %v", err)
+	}
+	if len(hooked) != 2 || len(hooked[0]) != 2 || len(hooked[1]) != 0 {
+		t.Errorf("Expected Before told of both reassignments, got %v", hooked)
+	}
+}
+
+func TestSetDoc(t *testing.T) {
+	svc := setupTestService(t)
+	do, _ := svc.AddDo(NewDo{Do: Do{Description: "Write"}})
+
+	documented, err := svc.SetDoc(do.ID, "first")
+	if err != nil || documented.Doc.Text != "first" {
+		t.Fatalf("Expected a doc, got %+v (%v)", documented.Doc, err)
+	}
+
+	updated, _ := svc.SetDoc(do.ID, "second")
+	if updated.Doc.ID != documented.Doc.ID || updated.Doc.Text != "second" {
+		t.Errorf("Expected the doc to be updated in place, got %+v", updated.Doc)
+	}
+
+	cleared, _ := svc.SetDoc(do.ID, "\n")
+	if cleared.Doc.ID != 0 {
+		t.Errorf("Expected a blank doc to be removed, got %+v", cleared.Doc)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	svc := setupTestService(t)
+	svc.AddDo(NewDo{Do: Do{Description: "Fix the build", UID: "build@captain"}})
+	ask, _ := svc.AddDo(NewDo{Do: Do{Description: "Ask about the build", Type: Ask}, For: "carol", Recruit: true})
+	scratched, _ := svc.AddDo(NewDo{Do: Do{Description: "Scratched"}})
+	svc.Scratch(scratched.ID, "")
+	svc.Complete(ask.ID)
+
+	tests := []struct {
+		name  string
+		query Query
+		want  int
+	}{
+		{"everything outstanding or done", Query{}, 2},
+		{"including scratched", Query{Deleted: true}, 3},
+		{"by type", Query{Type: Ask}, 1},
+		{"by crew", Query{For: "carol"}, 1},
+		{"by search", Query{Search: "BUILD"}, 2},
+		{"by uid", Query{UID: "build@captain"}, 1},
+		{"outstanding", Query{Completed: new(bool)}, 1},
+		{"limited", Query{Limit: 1}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dos, err := svc.Query(tt.query)
+			if err != nil {
+				t.Fatalf("Query: %v", err)
+			}
+			if len(dos) != tt.want {
+				t.Errorf("Expected %d dos, got %d", tt.want, len(dos))
+			}
+		})
+	}
+}
+
+func TestPromoteNeedsFilename(t *testing.T) {
+	svc := setupTestService(t)
+	do, _ := svc.AddDo(NewDo{Do: Do{Description: "Promote me"}})
+
+	if _, err := svc.Promote(do.ID, " "); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected ErrInvalid without a filename, got %v", err)
+	}
+}
+
+func TestTemplateNotFound(t *testing.T) {
+	svc := setupTestService(t)
+
+	if _, err := svc.ApplyTemplate("missing", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestAssignCrewKeepsCrewOnFailure(t *testing.T) {
+	conn, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	do := Do{Description: "Plan", Type: Task}
+	conn.Create(&do)
+	if err := AssignCrew(conn, do.ID, "dave"); err != nil {
+		t.Fatalf("AssignCrew: %v", err)
+	}
+
+	conn.Exec("CREATE TRIGGER refuse BEFORE INSERT ON do_tags WHEN NEW.tag_id = (SELECT id FROM tags WHERE name = 'eve') BEGIN SELECT RAISE(ABORT, 'refused'); END")
+	if err := AssignCrew(conn, do.ID, "alice", "eve"); !errors.Is(err, ErrStorage) {
+		t.Fatalf("Expected ErrStorage, got %v", err)
+	}
+
+	var names []string
+	conn.Model(&Tag{}).Joins("JOIN do_tags ON do_tags.tag_id = tags.id").Where("do_tags.do_id = ?", do.ID).Pluck("name", &names)
+	if len(names) != 1 || names[0] != "dave" {
+		t.Errorf("Expected the do still for dave, got %v", names)
+	}
+	var tags int64
+	conn.Model(&Tag{}).Count(&tags)
+	if tags != 1 {
+		t.Errorf("Expected alice and eve not to be recruited, got %d tags", tags)
+	}
+}
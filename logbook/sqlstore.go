@@ -0,0 +1,303 @@
+package logbook
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// SQLStore keeps the logbook in the database opened by Open
+type SQLStore struct {
+	conn *gorm.DB
+	dir  string
+}
+
+// NewSQLStore stores the logbook in conn, and files for the browser under
+// the captain directory dir.
+func NewSQLStore(conn *gorm.DB, dir string) *SQLStore {
+	return &SQLStore{conn: conn, dir: dir}
+}
+
+// Conn is the database the store is kept in
+func (s *SQLStore) Conn() *gorm.DB {
+	return s.conn
+}
+
+// notFound turns gorm's missing record into ErrNotFound, anything else is
+// a failure of the store.
+func notFound(action string, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return StorageError(action, err)
+}
+
+func (s *SQLStore) preload() *gorm.DB {
+	return s.conn.Preload("Doc").Preload("Git").Preload("Tags")
+}
+
+func (s *SQLStore) Do(id uint) (Do, error) {
+	var do Do
+	if err := s.preload().First(&do, id).Error; err != nil {
+		return do, notFound("fetch do", err)
+	}
+	return do, nil
+}
+
+func (s *SQLStore) DoByDescription(description string) (Do, error) {
+	var do Do
+	err := s.preload().Where("LOWER(description) = ?", strings.ToLower(description)).First(&do).Error
+	if err != nil {
+		return do, notFound("fetch do", err)
+	}
+	return do, nil
+}
+
+// OrderBy is the SQL ordering for one of the sorts of a Query
+func OrderBy(sort string, asc bool) string {
+	dir := "DESC"
+	if asc {
+		dir = "ASC"
+	}
+
+	switch sort {
+	case SortCreated, SortCompleted, SortDescription, SortType:
+		return sort + " " + dir
+	case SortPriority:
+		return `
+			CASE priority
+				WHEN 'high' THEN 1
+				WHEN 'medium' THEN 2
+				WHEN 'low' THEN 3
+				ELSE 2
+			END ` + dir
+	default:
+		return `
+			completed,
+			completed_at DESC,
+			CASE priority
+				WHEN 'high' THEN 1
+				WHEN 'medium' THEN 2
+				WHEN 'low' THEN 3
+				ELSE 2
+			END, created_at DESC
+		`
+	}
+}
+
+func (s *SQLStore) Dos(q Query) ([]Do, error) {
+	query := s.preload()
+	if !q.Deleted {
+		query = query.Where("deleted = ?", false)
+	}
+	if !q.Promoted {
+		query = query.Where("promoted = ?", false)
+	}
+	if q.Completed != nil {
+		query = query.Where("completed = ?", *q.Completed)
+	}
+	if q.Pinned {
+		query = query.Where("pinned = ?", true)
+	}
+	if q.Type != "" {
+		query = query.Where("type = ?", q.Type)
+	}
+	if q.For != "" {
+		query = query.Joins("JOIN do_tags ON do_tags.do_id = dos.id").
+			Joins("JOIN tags ON tags.id = do_tags.tag_id").
+			Where("tags.name = ?", q.For)
+	}
+	if q.Search != "" {
+		query = query.Where("LOWER(description) LIKE ?", "%"+strings.ToLower(q.Search)+"%")
+	}
+	if q.UID != "" {
+		query = query.Where("uid = ?", q.UID)
+	}
+	if q.CompletedSince != nil {
+		query = query.Where("completed_at IS NULL OR completed_at >= ?", *q.CompletedSince)
+	}
+
+	query = query.Order(OrderBy(q.Sort, q.Asc))
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
+	}
+
+	dos := []Do{}
+	if err := query.Find(&dos).Error; err != nil {
+		return nil, StorageError("fetch dos", err)
+	}
+	return dos, nil
+}
+
+func (s *SQLStore) CreateDo(do *Do) error {
+	if err := s.conn.Omit("Doc", "Git", "Tags").Create(do).Error; err != nil {
+		return StorageError("insert new row", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) SaveDo(do *Do) error {
+	if err := s.conn.Omit("Doc", "Git", "Tags").Save(do).Error; err != nil {
+		return StorageError("save do", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) SetDoc(doID uint, text string) error {
+	if strings.TrimSpace(text) == "" {
+		if err := s.conn.Where("do_id = ?", doID).Delete(&DoDoc{}).Error; err != nil {
+			return StorageError("delete doc", err)
+		}
+		return nil
+	}
+
+	var doc DoDoc
+	err := s.conn.Where("do_id = ?", doID).First(&doc).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = s.conn.Create(&DoDoc{DoID: doID, Text: text}).Error
+	} else if err == nil {
+		err = s.conn.Model(&doc).Update("text", text).Error
+	}
+	if err != nil {
+		return StorageError("save doc", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Tag(name string) (Tag, error) {
+	var tag Tag
+	if err := s.conn.Where("name = ?", name).First(&tag).Error; err != nil {
+		return tag, notFound("fetch tag", err)
+	}
+	return tag, nil
+}
+
+func (s *SQLStore) CreateTag(tag *Tag) error {
+	if err := s.conn.Create(tag).Error; err != nil {
+		return StorageError("insert new row", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) SaveTag(tag *Tag) error {
+	if err := s.conn.Save(tag).Error; err != nil {
+		return StorageError("save tag", err)
+	}
+	return nil
+}
+
+// AssignCrew replaces the crew a do is for, recruiting anyone new. The do
+// keeps its old crew if any of it fails.
+func AssignCrew(conn *gorm.DB, doID uint, names ...string) error {
+	return conn.Transaction(func(tx *gorm.DB) error {
+		return assignCrew(tx, doID, names...)
+	})
+}
+
+func assignCrew(conn *gorm.DB, doID uint, names ...string) error {
+	if err := conn.Where("do_id = ?", doID).Delete(&DoTag{}).Error; err != nil {
+		return StorageError("delete existing assignments", err)
+	}
+	for _, name := range names {
+		var tag Tag
+		if err := conn.Where(Tag{Name: name}).FirstOrCreate(&tag).Error; err != nil {
+			return StorageError("create tag", err)
+		}
+		if err := conn.Create(&DoTag{DoID: doID, TagID: tag.ID}).Error; err != nil {
+			return StorageError("create do-tag relationship", err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) SetCrew(doID uint, names ...string) error {
+	return AssignCrew(s.conn, doID, names...)
+}
+
+func (s *SQLStore) Crew() ([]Mate, error) {
+	crew := []Mate{}
+	err := s.conn.Table("tags").
+		Select("tags.name, COUNT(do_tags.tag_id) AS count").
+		Joins("LEFT JOIN do_tags ON do_tags.tag_id = tags.id").
+		Group("tags.id").
+		Order("count DESC").
+		Find(&crew).Error
+	if err != nil {
+		return nil, StorageError("fetch crew", err)
+	}
+	return crew, nil
+}
+
+func (s *SQLStore) Template(name string) (Template, error) {
+	var template Template
+	err := s.conn.Where("name = ? AND deleted = ?", name, false).First(&template).Error
+	if err != nil {
+		return template, notFound("fetch template", err)
+	}
+	return template, nil
+}
+
+func (s *SQLStore) Templates() ([]Template, error) {
+	templates := []Template{}
+	if err := s.conn.Where("deleted = ?", false).Order("name").Find(&templates).Error; err != nil {
+		return nil, StorageError("fetch templates", err)
+	}
+	return templates, nil
+}
+
+func (s *SQLStore) CreateTemplate(template *Template) error {
+	if err := s.conn.Create(template).Error; err != nil {
+		return StorageError("insert new row", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) SaveTemplate(template *Template) error {
+	if err := s.conn.Save(template).Error; err != nil {
+		return StorageError("save template", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Preference(key string) (string, error) {
+	var pref UserPreference
+	if err := s.conn.Where("key = ?", key).First(&pref).Error; err != nil {
+		return "", notFound("fetch preference", err)
+	}
+	return pref.Value, nil
+}
+
+func (s *SQLStore) SetPreference(key, value string) error {
+	var pref UserPreference
+	err := s.conn.Where(UserPreference{Key: key}).Assign(UserPreference{Value: value}).FirstOrCreate(&pref).Error
+	if err != nil {
+		return StorageError("save preference", err)
+	}
+	return nil
+}
+
+// WriteFile saves a file to the VFS over the store's connection, so it's
+// part of any transaction the store is in
+func (s *SQLStore) WriteFile(name, content string) error {
+	vfsManager, err := NewVFSManager(s.conn, s.dir)
+	if err != nil {
+		return StorageError("initialize VFS", err)
+	}
+	if err := vfsManager.WriteFile(name, content); err != nil {
+		return StorageError("create file", err)
+	}
+	if err := vfsManager.Save(); err != nil {
+		return StorageError("save VFS", err)
+	}
+	return nil
+}
+
+// Transaction runs fn again when another connection kept the database busy
+func (s *SQLStore) Transaction(fn func(tx Store) error) error {
+	return retry(func() error {
+		return s.conn.Transaction(func(tx *gorm.DB) error {
+			return fn(&SQLStore{conn: tx, dir: s.dir})
+		})
+	})
+}
@@ -0,0 +1,92 @@
+package logbook
+
+import "time"
+
+// Store is where the logbook keeps its dos, crew, docs, templates and
+// preferences. SQLStore keeps them in the database and MemStore in memory,
+// for tests.
+//
+// Lookups return ErrNotFound itself when there's nothing to find, other
+// errors are failures of the store.
+type Store interface {
+	// Do fetches a do, scratched or not, with its doc, link and crew
+	Do(id uint) (Do, error)
+	// DoByDescription finds a do by its description, ignoring case
+	DoByDescription(description string) (Do, error)
+	Dos(q Query) ([]Do, error)
+	CreateDo(do *Do) error
+	// SaveDo writes a do's own fields, leaving its doc and crew as they are
+	SaveDo(do *Do) error
+
+	// SetDoc replaces the doc of a do, removing it when text is blank
+	SetDoc(doID uint, text string) error
+
+	Tag(name string) (Tag, error)
+	CreateTag(tag *Tag) error
+	SaveTag(tag *Tag) error
+	// SetCrew replaces who a do is for, recruiting anyone new
+	SetCrew(doID uint, names ...string) error
+	Crew() ([]Mate, error)
+
+	// Template fetches a template that hasn't been deleted
+	Template(name string) (Template, error)
+	// Templates lists the templates that haven't been deleted by name
+	Templates() ([]Template, error)
+	CreateTemplate(template *Template) error
+	SaveTemplate(template *Template) error
+
+	Preference(key string) (string, error)
+	SetPreference(key, value string) error
+
+	// WriteFile adds a file to the files browser
+	WriteFile(name, content string) error
+
+	// Transaction runs fn against a store whose changes are all kept or,
+	// when fn returns an error, all undone.
+	Transaction(fn func(tx Store) error) error
+}
+
+// Sorts for a Query
+const (
+	// SortDefault puts outstanding dos first, then those most recently
+	// completed, by priority and newest first.
+	SortDefault     = ""
+	SortCreated     = "created_at"
+	SortCompleted   = "completed_at"
+	SortDescription = "description"
+	SortType        = "type"
+	SortPriority    = "priority"
+)
+
+// Query selects dos from the log. The zero Query is every outstanding and
+// completed do that hasn't been scratched or promoted.
+type Query struct {
+	Type      DoType
+	For       string
+	Completed *bool
+	Pinned    bool   // only pinned dos
+	Search    string // in the description, ignoring case
+	UID       string // the do exported with this uid
+	Deleted   bool   // include scratched dos
+	Promoted  bool   // include promoted dos
+
+	// CompletedSince leaves out dos completed before it
+	CompletedSince *time.Time
+
+	// Sort is one of the sorts above, descending unless Asc
+	Sort  string
+	Asc   bool
+	Limit int
+}
+
+// PriorityRank orders priorities from high to low, for sorting by them
+func PriorityRank(prio DoPrio) int {
+	switch prio {
+	case High:
+		return 1
+	case Low:
+		return 3
+	default:
+		return 2
+	}
+}
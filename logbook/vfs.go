@@ -1,9 +1,7 @@
-package cmd
+package logbook
 
 import (
-	"fmt"
 	"path/filepath"
-	"strings"
 
 	"github.com/s3bw/vfs"
 	"gorm.io/gorm"
@@ -33,22 +31,13 @@ func NewVFSManager(db *gorm.DB, captainDir string) (*VFSManager, error) {
 	}, nil
 }
 
-// CreatePromotedFile creates a .do file with task content
-func (vm *VFSManager) CreatePromotedFile(filename, description, docContent string) error {
-	// Ensure .do extension
-	if !strings.HasSuffix(filename, ".do") {
-		filename += ".do"
-	}
-
-	// Create the file node at root
-	node, err := vm.vfs.CreateFile(filename, false)
+// WriteFile creates a file at the root with content
+func (vm *VFSManager) WriteFile(name, content string) error {
+	node, err := vm.vfs.CreateFile(name, false)
 	if err != nil {
 		return err
 	}
 
-	// Format content: description as header + doc content as body
-	content := fmt.Sprintf("# %s\n\n%s", description, docContent)
-
 	// Set file content using VFS layer (updates node size)
 	return vm.vfs.SetFileContent(node, content)
 }
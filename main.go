@@ -1,7 +1,13 @@
 package main
 
-import "captain/cmd"
+import (
+	"os"
+
+	"captain/cmd"
+)
 
 func main() {
-	cmd.RootCmd.Execute()
+	if err := cmd.Execute(); err != nil {
+		os.Exit(cmd.ExitCode(err))
+	}
 }